@@ -0,0 +1,139 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Goofygiraffe06/zinc/internal/config"
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	"github.com/Goofygiraffe06/zinc/internal/review"
+	"github.com/Goofygiraffe06/zinc/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// AdminAuth admits requests bearing token as "Authorization: Bearer <token>".
+func AdminAuth(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				logging.WarnLog("Admin request refused: bad credentials from=%s", r.RemoteAddr)
+				respondJSON(w, http.StatusUnauthorized, models.ErrorResponse{Error: "Unauthorized"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ListReviewsHandler lists held registrations. ?status= selects pending
+// (default), approved, denied or all.
+func ListReviewsHandler(userStore *store.SQLiteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "":
+			status = models.ReviewPending
+		case "all":
+			status = ""
+		case models.ReviewPending, models.ReviewApproved, models.ReviewDenied:
+		default:
+			respondJSON(w, http.StatusBadRequest, models.ErrorResponse{Error: "Invalid status"})
+			return
+		}
+		reviews, err := userStore.ListReviews(status)
+		if err != nil {
+			logging.ErrorLog("Admin review list failed: %v", err)
+			respondJSON(w, http.StatusInternalServerError, models.ErrorResponse{Error: "Review lookup failed"})
+			return
+		}
+		if reviews == nil {
+			reviews = []models.Review{}
+		}
+		respondJSON(w, http.StatusOK, reviews)
+	}
+}
+
+// AdminActor is the audit actor of decisions made through the admin API.
+// Everyone holding ADMIN_TOKEN is the same principal, so a name in the
+// request body is only kept in the note.
+const AdminActor = "admin-api"
+
+// DecideReviewHandler approves or denies the registration held under
+// {nonce}. The decision lands in the audit log under AdminActor.
+func DecideReviewHandler(userStore *store.SQLiteStore, approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nonceKey, err := nonce.Normalize(chi.URLParam(r, "nonce"), config.NonceAcceptLegacyHex())
+		if err != nil {
+			respondJSON(w, http.StatusBadRequest, models.ErrorResponse{Error: "Invalid nonce"})
+			return
+		}
+		var req models.ReviewDecisionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			respondJSON(w, http.StatusBadRequest, models.ErrorResponse{Error: "Invalid JSON"})
+			return
+		}
+		note := strings.TrimSpace(req.Note)
+		if claimed := strings.TrimSpace(req.Actor); claimed != "" {
+			note = strings.TrimSuffix(claimed+": "+note, ": ")
+		}
+
+		decide := review.Deny
+		if approve {
+			decide = review.Approve
+		}
+		decided, err := decide(userStore, nonceKey, AdminActor, note)
+		switch {
+		case err == nil:
+			respondJSON(w, http.StatusOK, decided)
+		case errors.Is(err, store.ErrReviewNotFound):
+			respondJSON(w, http.StatusNotFound, models.ErrorResponse{Error: "Review not found"})
+		case errors.Is(err, store.ErrReviewDecided):
+			respondJSON(w, http.StatusConflict, models.ErrorResponse{Error: "Review already decided"})
+		case errors.Is(err, store.ErrUserExists):
+			respondJSON(w, http.StatusConflict, models.ErrorResponse{Error: "User already registered"})
+		default:
+			logging.ErrorLog("Admin review decision failed: %v", err)
+			respondJSON(w, http.StatusInternalServerError, models.ErrorResponse{Error: "Review decision failed"})
+		}
+	}
+}
+
+// AuditLogHandler returns the most recent audit entries, newest first.
+func AuditLogHandler(userStore *store.SQLiteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entries, err := userStore.AuditLog(200)
+		if err != nil {
+			logging.ErrorLog("Admin audit log failed: %v", err)
+			respondJSON(w, http.StatusInternalServerError, models.ErrorResponse{Error: "Audit lookup failed"})
+			return
+		}
+		if entries == nil {
+			entries = []models.AuditEntry{}
+		}
+		respondJSON(w, http.StatusOK, entries)
+	}
+}
+
+// DeadLettersHandler returns the webhook deliveries that exhausted their
+// retries, newest first, so an operator can replay them by hand.
+func DeadLettersHandler(userStore *store.SQLiteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dead, err := userStore.DeadLetters(200)
+		if err != nil {
+			logging.ErrorLog("Admin dead letter list failed: %v", err)
+			respondJSON(w, http.StatusInternalServerError, models.ErrorResponse{Error: "Dead letter lookup failed"})
+			return
+		}
+		if dead == nil {
+			dead = []models.WebhookDelivery{}
+		}
+		respondJSON(w, http.StatusOK, dead)
+	}
+}
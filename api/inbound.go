@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/Goofygiraffe06/zinc/internal/inbound"
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+	"github.com/Goofygiraffe06/zinc/internal/utils"
+	smtpcore "github.com/emersion/go-smtp"
+	"github.com/go-chi/chi/v5"
+)
+
+// InboundHandler accepts verification emails that a mail provider received
+// and POSTs to /inbound/{provider}. Permanent rejections are acknowledged with
+// 200 so the provider does not retry them; temporary ones get 503.
+func InboundHandler(providers map[string]inbound.Provider, backend *smtpserver.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "provider")
+		provider, ok := providers[name]
+		if !ok {
+			respondJSON(w, http.StatusNotFound, models.ErrorResponse{Error: "Unknown inbound provider"})
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logging.WarnLog("Inbound %s: reading body failed: %v", name, err)
+			respondJSON(w, http.StatusRequestEntityTooLarge, models.ErrorResponse{Error: "Request body too large"})
+			return
+		}
+
+		msg, err := provider.Parse(r, body)
+		switch {
+		case errors.Is(err, inbound.ErrUnauthorized), errors.Is(err, inbound.ErrStale):
+			logging.WarnLog("Inbound %s rejected: %v", name, err)
+			respondJSON(w, http.StatusUnauthorized, models.ErrorResponse{Error: "Invalid signature"})
+			return
+		case err == nil && len(msg.Recipients) == 0:
+			err = errors.New("no recipients")
+			fallthrough
+		case err != nil:
+			logging.WarnLog("Inbound %s: %v", name, err)
+			respondJSON(w, http.StatusBadRequest, models.ErrorResponse{Error: "Malformed inbound message"})
+			return
+		}
+
+		errs, err := backend.Deliver(msg)
+		if err != nil {
+			logging.WarnLog("Inbound %s message refused: from=[%s]: %v", name, utils.HashEmail(msg.EnvelopeFrom), err)
+			respondJSON(w, inboundStatusCode(err), models.InboundResponse{Status: "rejected", Error: err.Error()})
+			return
+		}
+
+		res := models.InboundResponse{Status: "accepted"}
+		code := http.StatusOK
+		for i, rcpt := range msg.Recipients {
+			status := models.InboundRecipient{Address: rcpt, Status: "accepted"}
+			if errs[i] != nil {
+				status.Status, status.Error = "rejected", errs[i].Error()
+				res.Status = "rejected"
+				if c := inboundStatusCode(errs[i]); c > code {
+					code = c
+				}
+			}
+			res.Recipients = append(res.Recipients, status)
+		}
+		if code != http.StatusOK {
+			res.Status = "deferred"
+		}
+		respondJSON(w, code, res)
+	}
+}
+
+// inboundStatusCode asks the provider to retry temporary SMTP failures.
+func inboundStatusCode(err error) int {
+	var smtpErr *smtpcore.SMTPError
+	if errors.As(err, &smtpErr) && smtpErr.Temporary() {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
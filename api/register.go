@@ -8,16 +8,18 @@ import (
 	"time"
 
 	"github.com/Goofygiraffe06/zinc/internal/auth"
+	"github.com/Goofygiraffe06/zinc/internal/config"
 	"github.com/Goofygiraffe06/zinc/internal/controller"
 	"github.com/Goofygiraffe06/zinc/internal/logging"
 	"github.com/Goofygiraffe06/zinc/internal/manager"
 	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
 	"github.com/Goofygiraffe06/zinc/internal/utils"
+	"github.com/Goofygiraffe06/zinc/internal/webhook"
 	"github.com/Goofygiraffe06/zinc/store"
-	"github.com/Goofygiraffe06/zinc/store/ephemeral"
 )
 
-func RegisterHandler(userStore *store.SQLiteStore, ttlStore *ephemeral.TTLStore, registry *controller.VerificationRegistry, mgr *manager.WorkManager) http.HandlerFunc {
+func RegisterHandler(userStore *store.SQLiteStore, ttlStore controller.ProofStore, registry controller.Registry, mgr *manager.WorkManager) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
@@ -29,7 +31,12 @@ func RegisterHandler(userStore *store.SQLiteStore, ttlStore *ephemeral.TTLStore,
 		}
 
 		// Sanitize input using standard pattern
-		req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+		// Unicode and punycode spellings of a domain are one address; an
+		// address that does not normalize is left for validation to refuse
+		req.Email = strings.TrimSpace(req.Email)
+		if email, err := utils.NormalizeEmail(req.Email); err == nil {
+			req.Email = email
+		}
 		req.Username = strings.ToLower(strings.TrimSpace(req.Username))
 		req.Username = strings.ReplaceAll(req.Username, " ", "")
 		req.PublicKey = strings.ReplaceAll(req.PublicKey, "\n", "")
@@ -48,19 +55,38 @@ func RegisterHandler(userStore *store.SQLiteStore, ttlStore *ephemeral.TTLStore,
 			return
 		}
 
+		// Stored proofs are keyed by the canonical nonce; the signature still
+		// covers the nonce exactly as the client received it.
+		nonceKey, err := nonce.Normalize(req.Nonce, config.NonceAcceptLegacyHex())
+		if err != nil {
+			logging.WarnLog("Registration failed: malformed nonce [%s] nonce=[%s]: %v", emailHash, nonceHash, err)
+			respondJSON(w, http.StatusBadRequest, models.ErrorResponse{Error: "Invalid nonce"})
+			return
+		}
+
 		userExists := userStore.Exists(req.Email)
 
-		expectedEmailKey := "expected:" + req.Nonce
+		expectedEmailKey := "expected:" + nonceKey
 		if err := ttlStore.SetWithValue(expectedEmailKey, req.Email, 3*time.Minute); err != nil {
 			logging.ErrorLog("Registration failed: could not store expected email [%s]: %v", emailHash, err)
 			respondJSON(w, http.StatusInternalServerError, models.ErrorResponse{Error: "Registration initialization failed"})
 			return
 		}
 
+		// Mail written before this moment cannot be meant for this nonce
+		if err := controller.SaveIssued(ttlStore, nonceKey, time.Now(), 3*time.Minute); err != nil {
+			ttlStore.Delete(expectedEmailKey)
+			logging.ErrorLog("Registration failed: could not store issue time [%s]: %v", emailHash, err)
+			respondJSON(w, http.StatusInternalServerError, models.ErrorResponse{Error: "Registration initialization failed"})
+			return
+		}
+
 		// Register with interrupt controller to get wait channel
-		waitCh := registry.Register(req.Nonce)
-		defer registry.Delete(req.Nonce)
+		waitCh := registry.Register(nonceKey)
+		defer registry.Delete(nonceKey)
 		defer ttlStore.Delete(expectedEmailKey) // Clean up expected email on exit
+		defer ttlStore.Delete(controller.ReportKey(nonceKey))
+		defer ttlStore.Delete(controller.IssuedKey(nonceKey))
 
 		logging.DebugLog("Registration: waiting for SMTP verification [%s] nonce=[%s]", emailHash, nonceHash) // Block and wait for one of three outcomes
 		select {
@@ -70,8 +96,10 @@ func RegisterHandler(userStore *store.SQLiteStore, ttlStore *ephemeral.TTLStore,
 
 		case <-time.After(3 * time.Minute):
 			// Timeout: SMTP didn't verify within 3 minutes
-			logging.WarnLog("Registration timeout after 3m [%s] nonce=[%s]", emailHash, nonceHash)
-			respondJSON(w, http.StatusRequestTimeout, models.ErrorResponse{Error: "Registration timeout - email verification not received"})
+			// A report means a message arrived but did not verify; it says why
+			report, _ := controller.LoadReport(ttlStore, nonceKey)
+			logging.WarnLog("Registration timeout after 3m [%s] nonce=[%s] report=%t", emailHash, nonceHash, report != nil)
+			respondRegistration(w, http.StatusRequestTimeout, "Registration timeout - email verification not received", report)
 			return
 
 		case <-r.Context().Done():
@@ -81,11 +109,21 @@ func RegisterHandler(userStore *store.SQLiteStore, ttlStore *ephemeral.TTLStore,
 			return
 		} // Wake up from interrupt - now verify everything
 
+		report, _ := controller.LoadReport(ttlStore, nonceKey)
+		// A verification held for review leaves no proof, only its report
+		held := report != nil && report.Decision == models.DecisionReview
+
 		// compare SMTP-verified email with request email
-		verifiedEmail, exists := ttlStore.Get(req.Nonce)
+		verifiedEmail, exists := ttlStore.Get(nonceKey)
+		if held {
+			verifiedEmail, exists = report.EnvelopeFrom, true
+			if email, err := utils.NormalizeEmail(verifiedEmail); err == nil {
+				verifiedEmail = email
+			}
+		}
 		if !exists {
 			logging.WarnLog("Registration failed: nonce expired in TTLStore [%s] nonce=[%s]", emailHash, nonceHash)
-			respondJSON(w, http.StatusForbidden, models.ErrorResponse{Error: "Verification expired"})
+			respondRegistration(w, http.StatusForbidden, "Verification expired", report)
 			return
 		}
 
@@ -93,12 +131,12 @@ func RegisterHandler(userStore *store.SQLiteStore, ttlStore *ephemeral.TTLStore,
 		if verifiedEmail != req.Email {
 			logging.WarnLog("Registration failed: email mismatch verified=[%s] claimed=[%s] nonce=[%s]",
 				utils.HashEmail(verifiedEmail), emailHash, nonceHash)
-			respondJSON(w, http.StatusForbidden, models.ErrorResponse{Error: "Email verification mismatch"})
+			respondRegistration(w, http.StatusForbidden, "Email verification mismatch", report)
 			return
 		}
 
 		// Clean up TTLStore entry (single-use proof)
-		ttlStore.Delete(req.Nonce)
+		ttlStore.Delete(nonceKey)
 
 		// Check user existence again (could have changed during wait)
 		if userExists || userStore.Exists(req.Email) {
@@ -150,7 +188,39 @@ func RegisterHandler(userStore *store.SQLiteStore, ttlStore *ephemeral.TTLStore,
 			return
 		}
 
-		// Create user (offload to DB pool)
+		// The relying party may ask for more than the server-wide minimum
+		assurance := ""
+		if report != nil {
+			assurance = report.Assurance
+		}
+		required := auth.StricterAssurance(config.MinAssurance(), req.MinAssurance)
+		if !auth.MeetsAssurance(assurance, required) {
+			logging.WarnLog("Registration failed: assurance %q below %q [%s] nonce=[%s]", assurance, required, emailHash, nonceHash)
+			respondRegistration(w, http.StatusForbidden, "Insufficient assurance", report)
+			return
+		}
+
+		if held {
+			holdForReview(w, userStore, req, nonceKey, report)
+			return
+		}
+
+		user := models.User{
+			Email:     req.Email,
+			Username:  req.Username,
+			PublicKey: req.PublicKey,
+			// Kept with the account so support can later explain how it was verified
+			VerificationReport: report,
+			Assurance:          assurance,
+		}
+		events, err := webhook.UserEvents(webhook.EventUserRegistered, user)
+		if err != nil {
+			logging.ErrorLog("Registration failed: webhook event [%s]: %v", emailHash, err)
+			respondJSON(w, http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to save user"})
+			return
+		}
+
+		// Create user (offload to DB pool); the outbox event commits with it
 		dbStart := time.Now()
 		var dbErr error
 		dbDone := make(chan struct{})
@@ -162,11 +232,7 @@ func RegisterHandler(userStore *store.SQLiteStore, ttlStore *ephemeral.TTLStore,
 			// Since sqlite calls are blocking, we run Exec in a goroutine and wait.
 			resultCh := make(chan error, 1)
 			go func() {
-				resultCh <- userStore.AddUser(models.User{
-					Email:     req.Email,
-					Username:  req.Username,
-					PublicKey: req.PublicKey,
-				})
+				resultCh <- userStore.AddUserWithEvents(user, events...)
 			}()
 			select {
 			case <-ctx.Done():
@@ -191,6 +257,38 @@ func RegisterHandler(userStore *store.SQLiteStore, ttlStore *ephemeral.TTLStore,
 		duration := time.Since(start)
 		logging.InfoLog("Registration completed via interrupt [%s][%s] %v (db: %v, sig: %v)",
 			emailHash, usernameHash, duration, dbDuration, sigDuration)
-		respondJSON(w, http.StatusOK, models.StatusResponse{Status: "ok"})
+		respondRegistration(w, http.StatusOK, "", report)
+	}
+}
+
+// holdForReview parks a registration whose verification email soft-failed
+// until an administrator decides. The client follows it on
+// GET /register/status/{nonce}.
+func holdForReview(w http.ResponseWriter, userStore *store.SQLiteStore, req models.RegisterCompleteRequest, nonceKey string, report *models.VerificationReport) {
+	emailHash := utils.HashEmail(req.Email)
+	r := models.Review{
+		Nonce:     nonceKey,
+		Email:     req.Email,
+		Username:  req.Username,
+		PublicKey: req.PublicKey,
+		Report:    report,
+		CreatedAt: time.Now(),
+	}
+	if err := userStore.AddReview(r); err != nil {
+		logging.ErrorLog("Registration failed: review store [%s]: %v", emailHash, err)
+		respondJSON(w, http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to save user"})
+		return
+	}
+	logging.InfoLog("Registration held for review [%s] nonce=[%s]: %s", emailHash, utils.HashEmail(nonceKey), report.Reason)
+	respondJSON(w, http.StatusAccepted, models.RegistrationStatusResponse{Status: models.ReviewPending, Verification: report})
+}
+
+// respondRegistration replies with the registration outcome and, when the
+// verification email was seen, the report explaining how it was judged.
+func respondRegistration(w http.ResponseWriter, code int, errMsg string, report *models.VerificationReport) {
+	status := "ok"
+	if errMsg != "" {
+		status = "failed"
 	}
+	respondJSON(w, code, models.RegistrationStatusResponse{Status: status, Error: errMsg, Verification: report})
 }
@@ -1,19 +1,17 @@
 package api
 
 import (
-	"crypto/rand"
-	"encoding/hex"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/Goofygiraffe06/zinc/internal/logging"
 	"github.com/Goofygiraffe06/zinc/internal/models"
-	"github.com/go-playground/validator/v10"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	"github.com/Goofygiraffe06/zinc/internal/utils"
 )
 
-var validate = validator.New()
+var validate = utils.NewValidator()
 
 func RegisterInitHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -33,13 +31,9 @@ func RegisterInitHandler() http.HandlerFunc {
 	}
 }
 
-// generateRegistrationNonce creates a cryptographically secure 32-byte nonce for registration
+// generateRegistrationNonce creates a 128-bit checksummed base32 nonce for registration
 func generateRegistrationNonce() (string, error) {
-	bytes := make([]byte, 32)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", fmt.Errorf("crypto/rand failed: %w", err)
-	}
-	return hex.EncodeToString(bytes), nil
+	return nonce.Generate()
 }
 
 func respondJSON(w http.ResponseWriter, code int, payload interface{}) {
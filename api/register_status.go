@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Goofygiraffe06/zinc/internal/config"
+	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	"github.com/Goofygiraffe06/zinc/internal/utils"
+	"github.com/Goofygiraffe06/zinc/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// RegisterStatusHandler reports the outcome of a registration completed by
+// email or held for review. Only the holder of the nonce can ask; until the
+// message has been processed the answer is the same as for a nonce never used.
+func RegisterStatusHandler(ttlStore controller.ProofStore, userStore *store.SQLiteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		raw := chi.URLParam(r, "nonce")
+		nonceKey, err := nonce.Normalize(raw, config.NonceAcceptLegacyHex())
+		if err != nil {
+			logging.DebugLog("Registration status: malformed nonce: %v", err)
+			respondJSON(w, http.StatusBadRequest, models.ErrorResponse{Error: "Invalid nonce"})
+			return
+		}
+		nonceHash := utils.HashEmail(nonceKey)
+
+		// A review outlives any stored outcome and reflects the latest decision
+		review, held, err := userStore.GetReview(nonceKey)
+		if err != nil {
+			logging.ErrorLog("Registration status: review lookup failed nonce=[%s]: %v", nonceHash, err)
+			respondJSON(w, http.StatusInternalServerError, models.ErrorResponse{Error: "Status lookup failed"})
+			return
+		}
+		if held {
+			logging.DebugLog("Registration status: review %s nonce=[%s]", review.Status, nonceHash)
+			respondJSON(w, http.StatusOK, reviewStatus(review))
+			return
+		}
+
+		outcome, ok := controller.LoadOutcome(ttlStore, nonceKey)
+		if !ok {
+			respondJSON(w, http.StatusNotFound, models.RegistrationStatusResponse{Status: "pending"})
+			return
+		}
+		logging.DebugLog("Registration status: %s nonce=[%s]", outcome.Status, nonceHash)
+		respondJSON(w, http.StatusOK, outcome)
+	}
+}
+
+// reviewStatus renders a review the way /register reports its outcome.
+func reviewStatus(r models.Review) models.RegistrationStatusResponse {
+	switch r.Status {
+	case models.ReviewApproved:
+		return models.RegistrationStatusResponse{Status: "ok", Verification: r.Report}
+	case models.ReviewDenied:
+		return models.RegistrationStatusResponse{Status: "failed", Error: "Registration denied", Verification: r.Report}
+	default:
+		return models.RegistrationStatusResponse{Status: models.ReviewPending, Verification: r.Report}
+	}
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"github.com/Goofygiraffe06/zinc/internal/auth"
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+)
+
+// WebhookKeyHandler publishes the Ed25519 public key used to sign webhook deliveries.
+func WebhookKeyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := auth.GetSigningKey()
+		if key == nil || key.PublicKey == nil {
+			logging.ErrorLog("Webhook key request failed: Ed25519 key not initialized")
+			respondJSON(w, http.StatusServiceUnavailable, models.ErrorResponse{Error: "Signing key unavailable"})
+			return
+		}
+		respondJSON(w, http.StatusOK, models.WebhookKeyResponse{
+			Algorithm: "ed25519",
+			PublicKey: base64.StdEncoding.EncodeToString(key.PublicKey),
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"strings"
+
+	"github.com/Goofygiraffe06/zinc/internal/config"
+	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	"github.com/Goofygiraffe06/zinc/internal/manager"
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+	smtpcore "github.com/emersion/go-smtp"
+)
+
+// Exit codes from sysexits.h, which MTAs map to bounces or deferrals.
+const (
+	exOK       = 0
+	exUsage    = 64
+	exDataErr  = 65
+	exNoUser   = 67
+	exTempFail = 75
+	exNoPerm   = 77
+	exConfig   = 78
+)
+
+// runIngest reads one message on stdin, e.g. from a .forward pipe or procmail,
+// and verifies it like an LMTP delivery. Results reach the API process through
+// the verification service, so VERIFY_SERVICE_ADDR and VERIFY_SERVICE_SECRET
+// must be set.
+func runIngest(args []string) int {
+	fs := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	sender := fs.String("sender", os.Getenv("SENDER"), "envelope sender (default $SENDER, then Return-Path)")
+	recipient := fs.String("recipient", firstEnv("ORIGINAL_RECIPIENT", "RECIPIENT"), "envelope recipient (default $ORIGINAL_RECIPIENT or $RECIPIENT, then Delivered-To)")
+	if err := fs.Parse(args); err != nil {
+		return exUsage
+	}
+
+	addr, secret := config.VerifyServiceAddr(), config.VerifyServiceSecret()
+	if addr == "" || secret == "" {
+		logging.ErrorLog("zinc ingest requires VERIFY_SERVICE_ADDR and VERIFY_SERVICE_SECRET")
+		return exConfig
+	}
+
+	// One byte over the limit is enough to tell the message was too large
+	msg, err := io.ReadAll(io.LimitReader(os.Stdin, int64(config.SMTPMaxMessageBytes())+1))
+	if err != nil {
+		logging.ErrorLog("zinc ingest: reading message failed: %v", err)
+		return exTempFail
+	}
+	if len(msg) > config.SMTPMaxMessageBytes() {
+		logging.ErrorLog("zinc ingest: message exceeds %d bytes", config.SMTPMaxMessageBytes())
+		return exDataErr
+	}
+
+	from, rcpt := *sender, *recipient
+	if from == "" || rcpt == "" {
+		hdr, err := mail.ReadMessage(bytes.NewReader(msg))
+		if err != nil {
+			logging.ErrorLog("zinc ingest: unreadable message header: %v", err)
+			return exDataErr
+		}
+		if from == "" {
+			from = strings.Trim(strings.TrimSpace(hdr.Header.Get("Return-Path")), "<>")
+		}
+		if rcpt == "" {
+			// the topmost Delivered-To was added by the MTA that handed us the message
+			rcpt = strings.TrimSpace(hdr.Header.Get("Delivered-To"))
+		}
+	}
+	if rcpt == "" {
+		logging.ErrorLog("zinc ingest: no recipient given and no Delivered-To header")
+		return exUsage
+	}
+
+	client := controller.NewRemoteClient(addr, secret, config.VerifyServiceTimeout())
+	defer client.Close()
+	mgr := manager.NewWorkManager(manager.WithSMTPWorkers(1))
+	// Close waits for the submitted nonce to reach the verification service
+	defer mgr.Close()
+
+	backend := smtpserver.NewBackend(client, client, mgr, config.SMTPDomain())
+	errs, err := backend.Ingest(bytes.NewReader(msg), from, []string{rcpt})
+	if err == nil {
+		err = errs[0]
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "zinc ingest: %v\n", err)
+		return exitCode(err)
+	}
+	return exOK
+}
+
+// exitCode maps an SMTP reply to the sysexits code an MTA treats the same way.
+func exitCode(err error) int {
+	var smtpErr *smtpcore.SMTPError
+	if !errors.As(err, &smtpErr) || smtpErr.Temporary() {
+		return exTempFail
+	}
+	switch {
+	case smtpErr.EnhancedCode[1] == 1:
+		return exNoUser
+	case smtpErr.EnhancedCode[1] == 7:
+		return exNoPerm
+	default:
+		return exDataErr
+	}
+}
+
+func firstEnv(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -9,9 +9,13 @@ import (
 	"github.com/Goofygiraffe06/zinc/internal/auth"
 	"github.com/Goofygiraffe06/zinc/internal/config"
 	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/internal/imappoll"
+	"github.com/Goofygiraffe06/zinc/internal/inbound"
 	"github.com/Goofygiraffe06/zinc/internal/logging"
 	"github.com/Goofygiraffe06/zinc/internal/manager"
+	"github.com/Goofygiraffe06/zinc/internal/metrics"
 	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+	"github.com/Goofygiraffe06/zinc/internal/webhook"
 	"github.com/Goofygiraffe06/zinc/store"
 	"github.com/Goofygiraffe06/zinc/store/ephemeral"
 	"github.com/go-chi/chi/v5"
@@ -56,6 +60,12 @@ func MaxBytes(n int64) func(next http.Handler) http.Handler {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "ingest" {
+		os.Exit(runIngest(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "review" {
+		os.Exit(runReview(os.Args[2:]))
+	}
 	startTime := time.Now()
 
 	logFile := "zinc.log"
@@ -88,6 +98,9 @@ func main() {
 	}))
 
 	auth.InitSigningKey()
+	if min := config.MinAssurance(); min != "" && !auth.ValidAssurance(min) {
+		logging.FatalLog("CRITICAL: MIN_ASSURANCE must be low, medium or high, got %q", min)
+	}
 
 	dbFile := "zinc.db"
 	if _, err := os.Stat(dbFile); err == nil {
@@ -99,42 +112,172 @@ func main() {
 		}
 	}
 
-	ttlStore := ephemeral.NewTTLStore()
-	//nonceStore := ephemeral.NewNonceStore()
-
-	// Create the shared verification registry for interrupt-based registration
-	verificationRegistry := controller.NewVerificationRegistry()
-	logging.InfoLog("Verification registry initialized")
+	role, err := config.ZincRole()
+	if err != nil {
+		logging.FatalLog("CRITICAL: %v", err)
+	}
+	logging.InfoLog("Process role: %s", role)
 
 	mgr := manager.NewWorkManager(
 		manager.WithDBWorkers(config.DBWorkerCount()),
 		manager.WithCryptoWorkers(config.CryptoWorkerCount()),
 		manager.WithSMTPWorkers(config.SMTPWorkerCount()),
+		manager.WithWebhookWorkers(config.WebhookWorkerCount()),
 	)
 	defer mgr.Close()
 
-	userStore, err := store.NewSQLiteStore(dbFile)
-	if err != nil {
-		logging.FatalLog("CRITICAL: Database connection failed - service cannot start: %v", err)
-	}
-
 	router.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(`{"status":"ok","service":"zinc-auth","timestamp":"` + time.Now().UTC().Format(time.RFC3339) + `"}`))
 	})
 
-	// API routes - new interrupt-based registration flow
-	router.Post("/register/init", api.RegisterInitHandler())
-	router.Post("/register", api.RegisterHandler(userStore, ttlStore, verificationRegistry, mgr))
+	// Metrics have their own listener so the public port never exposes them
+	if addr, path := config.MetricsAddr(), config.MetricsPath(); addr != "" && path != "off" {
+		mux := http.NewServeMux()
+		mux.Handle(path, metrics.Handler())
+		metricsSrv := &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: config.ServerReadHeaderTimeout(),
+		}
+		go func() {
+			if err := metricsSrv.ListenAndServe(); err != nil {
+				logging.ErrorLog("Metrics listener on %s failed: %v", addr, err)
+			}
+		}()
+		logging.InfoLog("Metrics served on %s%s", addr, path)
+	}
 
-	// SMTP server with shared registry for firing interrupts
-	smtpBackend := smtpserver.NewBackend(ttlStore, verificationRegistry, mgr, config.SMTPDomain())
-	smtpSrv := smtpserver.NewServer(smtpBackend)
-	if err := smtpSrv.Start(); err != nil {
-		logging.ErrorLog("SMTP server failed to start: %v", err)
+	// The SMTP listener reports verifications through these; they are local
+	// objects unless this process only runs the SMTP side.
+	var (
+		smtpProofs   controller.ProofStore
+		smtpNotifier controller.Notifier
+		smtpQueue    smtpserver.WorkQueue
+		smtpOpts     []smtpserver.BackendOption
+	)
+
+	if role == "smtp" {
+		addr, secret := config.VerifyServiceAddr(), config.VerifyServiceSecret()
+		if addr == "" || secret == "" {
+			logging.FatalLog("CRITICAL: ZINC_ROLE=smtp requires VERIFY_SERVICE_ADDR and VERIFY_SERVICE_SECRET")
+		}
+		client := controller.NewRemoteClient(addr, secret, config.VerifyServiceTimeout())
+		defer client.Close()
+		smtpProofs, smtpNotifier = client, client
+		logging.InfoLog("Verification service client configured for %s", addr)
+
+		// Accepted nonces are queued locally until the service has them
+		queueFile := config.SMTPQueueFile()
+		queueStore, err := store.NewSQLiteStore(queueFile)
+		if err != nil {
+			logging.FatalLog("CRITICAL: Verification queue %s failed to open: %v", queueFile, err)
+		}
+		if err := os.Chmod(queueFile, 0600); err != nil {
+			logging.ErrorLog("SECURITY WARNING: Failed to set restrictive permissions on queue file %s: %v", queueFile, err)
+		}
+		smtpQueue = store.NewSQLiteWorkQueue(queueStore)
+		if config.SMTPEmailRegistration() {
+			logging.WarnLog("SMTP_EMAIL_REGISTRATION ignored: ZINC_ROLE=smtp has no users database")
+		}
 	} else {
-		defer smtpSrv.Stop()
+		userStore, err := store.NewSQLiteStore(dbFile)
+		if err != nil {
+			logging.FatalLog("CRITICAL: Database connection failed - service cannot start: %v", err)
+		}
+
+		// Webhook dispatcher drains the outbox; no events are written when no endpoint is configured
+		if urls := config.WebhookURLs(); len(urls) > 0 {
+			dispatcher := webhook.NewDispatcher(userStore, mgr)
+			dispatcher.Start()
+			defer dispatcher.Stop()
+		} else {
+			logging.InfoLog("Webhooks disabled: WEBHOOK_URLS not set")
+		}
+
+		// Proofs stay in memory when SMTP runs in-process; a split deployment
+		// keeps them in SQLite so they survive an API restart.
+		var proofs controller.ProofStore = ephemeral.NewTTLStore()
+		if role == "api" {
+			proofs = store.NewSQLiteProofStore(userStore)
+		}
+
+		// Create the shared verification registry for interrupt-based registration
+		verificationRegistry := controller.NewVerificationRegistry()
+		logging.InfoLog("Verification registry initialized")
+
+		if listen := config.VerifyServiceListen(); listen != "" {
+			ln, err := controller.ListenService(listen)
+			if err != nil {
+				logging.FatalLog("CRITICAL: Verification service listen failed on %s: %v", listen, err)
+			}
+			svc := controller.NewRemoteServer(verificationRegistry, proofs, config.VerifyServiceSecret())
+			if err := svc.Start(ln); err != nil {
+				logging.FatalLog("CRITICAL: Verification service failed to start: %v", err)
+			}
+			defer svc.Stop()
+		} else if role == "api" {
+			logging.WarnLog("ZINC_ROLE=api without VERIFY_SERVICE_LISTEN: no SMTP listener can reach this process")
+		}
+
+		// API routes - new interrupt-based registration flow
+		router.Post("/register/init", api.RegisterInitHandler())
+		router.Post("/register", api.RegisterHandler(userStore, proofs, verificationRegistry, mgr))
+		router.Get("/webhooks/key", api.WebhookKeyHandler())
+
+		// Registrations completed by email or held for review report here
+		router.Get("/register/status/{nonce}", api.RegisterStatusHandler(proofs, userStore))
+
+		// Held registrations are decided through the admin API or "zinc review"
+		if token := config.AdminToken(); token != "" {
+			router.Route("/admin", func(r chi.Router) {
+				r.Use(api.AdminAuth(token))
+				r.Get("/reviews", api.ListReviewsHandler(userStore))
+				r.Post("/reviews/{nonce}/approve", api.DecideReviewHandler(userStore, true))
+				r.Post("/reviews/{nonce}/deny", api.DecideReviewHandler(userStore, false))
+				r.Get("/audit", api.AuditLogHandler(userStore))
+				r.Get("/webhooks/dead-letters", api.DeadLettersHandler(userStore))
+			})
+			logging.InfoLog("Admin API enabled")
+		}
+
+		// Verification mail may carry the whole registration for headless clients
+		if config.SMTPEmailRegistration() {
+			smtpOpts = append(smtpOpts, smtpserver.WithRegistrar(userStore))
+			logging.InfoLog("Email registration enabled")
+		}
+
+		smtpProofs, smtpNotifier = proofs, verificationRegistry
+		smtpQueue = store.NewSQLiteWorkQueue(userStore)
+	}
+
+	// SMTP and provider webhooks share the backend and fire interrupts on the shared registry
+	smtpOpts = append(smtpOpts, smtpserver.WithWorkQueue(smtpQueue))
+	smtpBackend := smtpserver.NewBackend(smtpProofs, smtpNotifier, mgr, config.SMTPDomain(), smtpOpts...)
+	smtpBackend.StartQueue()
+	defer smtpBackend.StopQueue()
+	if providers := inbound.Providers(); len(providers) > 0 {
+		router.Post("/inbound/{provider}", api.InboundHandler(providers, smtpBackend))
+		logging.InfoLog("Inbound mail webhooks enabled for %d provider(s)", len(providers))
+	}
+	if urls := config.IMAPURLs(); len(urls) > 0 {
+		poller, err := imappoll.New(smtpBackend, urls, imappoll.OptionsFromConfig())
+		if err != nil {
+			logging.ErrorLog("IMAP polling failed to start: %v", err)
+		} else {
+			poller.Start()
+			defer poller.Stop()
+		}
+	}
+
+	if role != "api" {
+		smtpSrv := smtpserver.NewServer(smtpBackend)
+		if err := smtpSrv.Start(); err != nil {
+			logging.ErrorLog("SMTP server failed to start: %v", err)
+		} else {
+			defer smtpSrv.Stop()
+		}
 	}
 
 	port := ":" + config.GetEnv("PORT", "8080")
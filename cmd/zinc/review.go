@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/config"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	"github.com/Goofygiraffe06/zinc/internal/review"
+	"github.com/Goofygiraffe06/zinc/internal/utils"
+	"github.com/Goofygiraffe06/zinc/store"
+)
+
+const reviewUsage = "usage: zinc review [flags] list | approve <nonce> | deny <nonce> | audit"
+
+// runReview lets an operator work the queue of registrations held by
+// SMTP_VERIFICATION_MODE=review straight from the database file.
+func runReview(args []string) int {
+	fs := flag.NewFlagSet("review", flag.ContinueOnError)
+	dbFile := fs.String("db", "zinc.db", "user database")
+	actor := fs.String("actor", os.Getenv("USER"), "name recorded in the audit log (default $USER)")
+	note := fs.String("note", "", "note recorded with the decision")
+	status := fs.String("status", models.ReviewPending, "reviews to list: pending, approved, denied or all")
+	limit := fs.Int("n", 50, "audit entries to show")
+	if err := fs.Parse(args); err != nil {
+		return exUsage
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, reviewUsage)
+		return exUsage
+	}
+
+	s, err := store.NewSQLiteStore(*dbFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "zinc review: %v\n", err)
+		return exTempFail
+	}
+	defer s.Close()
+
+	switch cmd := fs.Arg(0); cmd {
+	case "list":
+		filter := *status
+		if filter == "all" {
+			filter = ""
+		}
+		reviews, err := s.ListReviews(filter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "zinc review: %v\n", err)
+			return exTempFail
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NONCE\tEMAIL\tUSERNAME\tSTATUS\tRECEIVED\tREASON")
+		for _, r := range reviews {
+			reason := ""
+			if r.Report != nil {
+				reason = r.Report.Reason
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Nonce, utils.DisplayEmail(r.Email), r.Username, r.Status, r.CreatedAt.Format(time.RFC3339), reason)
+		}
+		w.Flush()
+		return exOK
+
+	case "approve", "deny":
+		if fs.NArg() != 2 {
+			fmt.Fprintln(os.Stderr, reviewUsage)
+			return exUsage
+		}
+		n, err := nonce.Normalize(fs.Arg(1), config.NonceAcceptLegacyHex())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "zinc review: %v\n", err)
+			return exUsage
+		}
+		if *actor == "" {
+			*actor = "admin"
+		}
+		decide := review.Deny
+		if cmd == "approve" {
+			decide = review.Approve
+		}
+		r, err := decide(s, n, *actor, *note)
+		switch {
+		case errors.Is(err, store.ErrReviewNotFound):
+			fmt.Fprintf(os.Stderr, "zinc review: no registration held under %s\n", n)
+			return exNoUser
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "zinc review: %v\n", err)
+			return exDataErr
+		}
+		fmt.Printf("%s %s (%s)\n", r.Status, utils.DisplayEmail(r.Email), r.Username)
+		return exOK
+
+	case "audit":
+		entries, err := s.AuditLog(*limit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "zinc review: %v\n", err)
+			return exTempFail
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tACTOR\tACTION\tSUBJECT\tNOTE")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.At.Format(time.RFC3339), e.Actor, e.Action, e.Subject, e.Note)
+		}
+		w.Flush()
+		return exOK
+
+	default:
+		fmt.Fprintln(os.Stderr, reviewUsage)
+		return exUsage
+	}
+}
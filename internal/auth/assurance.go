@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInsufficientAssurance is returned when a verification or token falls
+// short of the assurance level a relying party asked for.
+var ErrInsufficientAssurance = errors.New("insufficient assurance")
+
+// AssuranceRank orders assurance levels. Unknown levels, including the empty
+// level of accounts created before levels were recorded, rank lowest.
+func AssuranceRank(level string) int {
+	switch level {
+	case models.AssuranceLow:
+		return 1
+	case models.AssuranceMedium:
+		return 2
+	case models.AssuranceHigh:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// ValidAssurance reports whether level names an assurance level.
+func ValidAssurance(level string) bool {
+	return AssuranceRank(level) > 0
+}
+
+// MeetsAssurance reports whether level is at least min. An empty min asks
+// for nothing.
+func MeetsAssurance(level, min string) bool {
+	return min == "" || AssuranceRank(level) >= AssuranceRank(min)
+}
+
+// StricterAssurance returns whichever of a and b demands more.
+func StricterAssurance(a, b string) string {
+	if AssuranceRank(b) > AssuranceRank(a) {
+		return b
+	}
+	return a
+}
+
+// RequireAssurance checks the acr claim of a verified token against min.
+func RequireAssurance(token *jwt.Token, min string) error {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return ErrInsufficientAssurance
+	}
+	acr, _ := claims["acr"].(string)
+	if !MeetsAssurance(acr, min) {
+		return fmt.Errorf("%w: token has %q, want %q", ErrInsufficientAssurance, acr, min)
+	}
+	return nil
+}
@@ -10,7 +10,9 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func GenerateMagicToken(email string) (string, error) {
+// GenerateMagicToken issues a token for email. acr carries the assurance
+// level of the address's verification and is omitted when empty.
+func GenerateMagicToken(email, acr string) (string, error) {
 	emailHash := utils.HashEmail(email)
 
 	key := GetSigningKey()
@@ -26,6 +28,9 @@ func GenerateMagicToken(email string) (string, error) {
 		"exp": now.Add(config.JWTRegistrationExpiresIn()).Unix(),
 		"iat": now.Unix(),
 	}
+	if acr != "" {
+		claims["acr"] = acr
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
 	tokenStr, err := token.SignedString(key.PrivateKey)
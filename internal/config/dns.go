@@ -0,0 +1,31 @@
+package config
+
+import "time"
+
+// DNSUpstream lists the recursive resolvers zinc queries, e.g.
+// "127.0.0.1:53,[::1]:53". A missing port defaults to 53. Empty uses the
+// nameservers from /etc/resolv.conf.
+func DNSUpstream() []string {
+	return GetEnvList("DNS_UPSTREAM")
+}
+
+// DNSTimeout bounds a single query to one upstream.
+func DNSTimeout() time.Duration {
+	return MustParseDuration("DNS_TIMEOUT", "2s")
+}
+
+// DNSCacheSize caps the number of cached answers.
+func DNSCacheSize() int {
+	return parseIntEnv("DNS_CACHE_SIZE", 10000)
+}
+
+// DNSCacheMaxTTL caps how long an answer is cached regardless of its record TTL.
+func DNSCacheMaxTTL() time.Duration {
+	return MustParseDuration("DNS_CACHE_MAX_TTL", "1h")
+}
+
+// DNSNegativeTTL is how long NXDOMAIN and empty answers are cached when the
+// response carries no SOA to derive it from.
+func DNSNegativeTTL() time.Duration {
+	return MustParseDuration("DNS_NEGATIVE_TTL", "1m")
+}
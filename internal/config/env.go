@@ -3,6 +3,7 @@ package config
 import (
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -43,3 +44,19 @@ func MustParseDuration(key, fallback string) time.Duration {
 	}
 	return d
 }
+
+// GetEnvList returns a comma-separated environment variable as a trimmed slice,
+// skipping empty entries. It returns nil when the variable is unset.
+func GetEnvList(key string) []string {
+	val := os.Getenv(key)
+	if val == "" {
+		return nil
+	}
+	var out []string
+	for _, part := range strings.Split(val, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
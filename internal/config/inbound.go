@@ -0,0 +1,32 @@
+package config
+
+import "time"
+
+// InboundRawSecret is the HMAC key for raw MIME posts to /inbound/raw.
+// The adapter is disabled when empty.
+func InboundRawSecret() string {
+	return GetEnv("INBOUND_RAW_SECRET", "")
+}
+
+// InboundMailgunSigningKey is the Mailgun HTTP webhook signing key.
+// The adapter is disabled when empty.
+func InboundMailgunSigningKey() string {
+	return GetEnv("INBOUND_MAILGUN_SIGNING_KEY", "")
+}
+
+// InboundSendGridPublicKey is the base64 ECDSA verification key of a signed
+// SendGrid Inbound Parse webhook. The adapter is disabled when empty.
+func InboundSendGridPublicKey() string {
+	return GetEnv("INBOUND_SENDGRID_PUBLIC_KEY", "")
+}
+
+// InboundPostmarkCredentials is the "user:password" pair put in the Postmark
+// inbound webhook URL. The adapter is disabled when empty.
+func InboundPostmarkCredentials() string {
+	return GetEnv("INBOUND_POSTMARK_CREDENTIALS", "")
+}
+
+// InboundSignatureTolerance bounds the accepted age of a signed inbound post.
+func InboundSignatureTolerance() time.Duration {
+	return MustParseDuration("INBOUND_SIGNATURE_TOLERANCE", "5m")
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// legacyHexCutover is the default NONCE_LEGACY_HEX_UNTIL. Hex nonces only
+// live as long as a pending registration, so by then none can be left.
+const legacyHexCutover = "2027-01-01"
+
+// NonceAcceptLegacyHex keeps accepting the 64-char hex nonces issued before
+// the base32 format while clients migrate. It is true until
+// NonceLegacyHexUntil passes; set NONCE_ACCEPT_LEGACY_HEX to "false" to stop
+// earlier.
+func NonceAcceptLegacyHex() bool {
+	val := strings.ToLower(strings.TrimSpace(GetEnv("NONCE_ACCEPT_LEGACY_HEX", "true")))
+	if val != "true" && val != "1" && val != "yes" {
+		return false
+	}
+	return time.Now().Before(NonceLegacyHexUntil())
+}
+
+// NonceLegacyHexUntil is when hex nonces stop being accepted, as an RFC 3339
+// date ("2027-01-01", midnight UTC) or timestamp.
+func NonceLegacyHexUntil() time.Time {
+	val := strings.TrimSpace(GetEnv("NONCE_LEGACY_HEX_UNTIL", legacyHexCutover))
+	if t, err := time.Parse(time.DateOnly, val); err == nil {
+		return t
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		log.Fatalf("config: invalid date in NONCE_LEGACY_HEX_UNTIL: %v", err)
+	}
+	return t
+}
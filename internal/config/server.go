@@ -59,23 +59,67 @@ func WorkerQueueSize() int {
 }
 
 // SMTPListenAddr returns the address the SMTP server listens on.
-// Example values: ":2525" (default), "127.0.0.1:2525".
+// Example values: ":2525" (default), "127.0.0.1:2525", or "off" to run
+// only the LMTP socket and implicit TLS listener.
 func SMTPListenAddr() string {
 	return GetEnv("SMTP_LISTEN_ADDR", ":2525")
 }
 
+// SMTPLMTPSocket is a Unix socket path on which the verification backend also
+// speaks LMTP, e.g. for a Postfix transport. Empty disables it.
+func SMTPLMTPSocket() string {
+	return GetEnv("SMTP_LMTP_SOCKET", "")
+}
+
+// SMTPLMTPSocketMode is the octal permission of the LMTP socket (default 0660).
+func SMTPLMTPSocketMode() os.FileMode {
+	val := GetEnv("SMTP_LMTP_SOCKET_MODE", "0660")
+	mode, err := strconv.ParseUint(val, 8, 32)
+	if err != nil {
+		return 0o660
+	}
+	return os.FileMode(mode)
+}
+
 // SMTPDomain returns the domain we present for SMTP and accept RCPTs for.
 // Defaults to "zinc.org".
 func SMTPDomain() string {
 	return GetEnv("SMTP_DOMAIN", "zinc.org")
 }
 
-// SMTPRecipientPrefix returns the required local-part prefix before the plus tag.
-// Only addresses of the form verify+<token>@domain are processed.
+// SMTPRecipientPrefix returns the local part verification addresses start with,
+// e.g. verify+<token>@domain. See SMTPAddressingModes for the accepted forms.
 func SMTPRecipientPrefix() string {
 	return GetEnv("SMTP_RECIPIENT_PREFIX", "verify")
 }
 
+// SMTPAddressSeparators returns the characters accepted between the recipient
+// prefix and the nonce. "+-." accepts verify+<nonce>, verify-<nonce> and
+// verify.<nonce> for systems that strip or reject plus addressing.
+func SMTPAddressSeparators() string {
+	return GetEnv("SMTP_ADDRESS_SEPARATORS", "+")
+}
+
+// SMTPAddressingModes returns the enabled verification address forms:
+//   - "subaddress": prefix<sep>nonce@domain (default)
+//   - "mailbox": prefix@domain, nonce taken from the Subject or body
+//   - "subdomain": prefix@nonce.domain (needs a wildcard MX)
+//
+// Unknown entries are ignored; an empty result falls back to "subaddress".
+func SMTPAddressingModes() []string {
+	var modes []string
+	for _, m := range GetEnvList("SMTP_ADDRESSING_MODES") {
+		switch m = strings.ToLower(m); m {
+		case "subaddress", "mailbox", "subdomain":
+			modes = append(modes, m)
+		}
+	}
+	if len(modes) == 0 {
+		return []string{"subaddress"}
+	}
+	return modes
+}
+
 // SMTPMaxRecipients limits RCPT TO count per message.
 func SMTPMaxRecipients() int {
 	return parseIntEnv("SMTP_MAX_RECIPIENTS", 5)
@@ -95,11 +139,12 @@ func SMTPMaxMessageBytes() int {
 }
 
 // SMTPVerificationMode returns the verification mode for SPF checks.
-// Valid values: "unrestricted", "warn", "strict"
+// Valid values: "unrestricted", "warn", "strict", "review". Review rejects
+// what strict does but holds soft failures for an administrator to decide.
 func SMTPVerificationMode() string {
 	mode := strings.ToLower(strings.TrimSpace(GetEnv("SMTP_VERIFICATION_MODE", "unrestricted")))
 	switch mode {
-	case "unrestricted", "warn", "strict":
+	case "unrestricted", "warn", "strict", "review":
 		return mode
 	default:
 		return "unrestricted"
@@ -111,6 +156,49 @@ func SMTPDKIMEnabled() bool {
 	return val == "true" || val == "1" || val == "yes"
 }
 
+// SMTPDMARCEnabled toggles DMARC evaluation of the header From domain.
+func SMTPDMARCEnabled() bool {
+	val := strings.ToLower(strings.TrimSpace(GetEnv("SMTP_DMARC_ENABLED", "true")))
+	return val == "true" || val == "1" || val == "yes"
+}
+
+// SMTPARCTrustedSealers lists ARC sealer domains (ARC-Seal d=) whose recorded
+// authentication results may stand in for failed local SPF/DKIM/DMARC checks,
+// e.g. "google.com,outlook.com,lists.example.org".
+func SMTPARCTrustedSealers() []string {
+	return GetEnvList("SMTP_ARC_TRUSTED_SEALERS")
+}
+
+// SMTPDNSBLZones lists DNS blocklists queried with the connecting client's IP,
+// or for mail from a trusted relay the origin it received the message from,
+// each with an optional action: "zen.example.org:reject,bl.example.net:warn".
+// Actions are reject, escalate (force strict authentication) and warn (default).
+func SMTPDNSBLZones() []string {
+	return GetEnvList("SMTP_DNSBL_ZONES")
+}
+
+// SMTPRHSBLZones lists right-hand-side blocklists queried with the envelope
+// sender's domain, in the same "zone:action" form as SMTPDNSBLZones.
+func SMTPRHSBLZones() []string {
+	return GetEnvList("SMTP_RHSBL_ZONES")
+}
+
+// SMTPBlocklistTimeout bounds all blocklist lookups for one client or sender.
+func SMTPBlocklistTimeout() time.Duration {
+	return MustParseDuration("SMTP_BLOCKLIST_TIMEOUT", "5s")
+}
+
+// SMTPPolicyFile is a JSON per-sender-domain verification policy. Empty
+// disables it and only SMTP_VERIFICATION_MODE applies.
+func SMTPPolicyFile() string {
+	return GetEnv("SMTP_POLICY_FILE", "")
+}
+
+// SMTPPolicyReloadInterval controls how often the policy file is checked for changes.
+func SMTPPolicyReloadInterval() time.Duration {
+	return MustParseDuration("SMTP_POLICY_RELOAD_INTERVAL", "30s")
+}
+
 func SMTPSPFEnabled() bool {
 	val := strings.ToLower(strings.TrimSpace(GetEnv("SMTP_SPF_ENABLED", "true")))
 	return val == "true" || val == "1" || val == "yes"
@@ -156,3 +244,129 @@ func parseBytes(s string) (int64, error) {
 	}
 	return int64(n * float64(mult)), nil
 }
+
+// SMTPProxyTrustedCIDRs lists the load balancers allowed to send PROXY protocol
+// v1/v2 headers, e.g. "10.0.0.0/8,192.0.2.10". Connections from these networks
+// must send a header; empty disables PROXY protocol.
+func SMTPProxyTrustedCIDRs() []string {
+	return GetEnvList("SMTP_PROXY_TRUSTED_CIDRS")
+}
+
+// SMTPProxyHeaderTimeout bounds how long a trusted proxy may take to send its header.
+func SMTPProxyHeaderTimeout() time.Duration {
+	return MustParseDuration("SMTP_PROXY_HEADER_TIMEOUT", "5s")
+}
+
+// SMTPTrustedRelays lists MTAs that accept mail first and relay it to zinc,
+// e.g. "10.0.0.0/8,192.0.2.25". For mail from these peers the client address
+// and HELO are taken from the Received headers the relays added.
+func SMTPTrustedRelays() []string {
+	return GetEnvList("SMTP_TRUSTED_RELAYS")
+}
+
+// SMTPTrustedRelayAuthServIDs lists the authserv-ids of Authentication-Results
+// headers stamped by the trusted relays. Their SPF and DKIM results are used
+// instead of checking again; empty means zinc always checks itself.
+func SMTPTrustedRelayAuthServIDs() []string {
+	return GetEnvList("SMTP_TRUSTED_RELAY_AUTHSERV_IDS")
+}
+
+// SMTPTLSCertFile is the PEM certificate for STARTTLS and implicit TLS.
+// TLS is disabled unless both the certificate and key are set.
+func SMTPTLSCertFile() string {
+	return GetEnv("SMTP_TLS_CERT_FILE", "")
+}
+
+// SMTPTLSKeyFile is the PEM private key matching SMTPTLSCertFile.
+func SMTPTLSKeyFile() string {
+	return GetEnv("SMTP_TLS_KEY_FILE", "")
+}
+
+// SMTPTLSListenAddr is the implicit-TLS (submissions) listener, e.g. ":465".
+// Empty disables it; STARTTLS on the main listener is unaffected.
+func SMTPTLSListenAddr() string {
+	return GetEnv("SMTP_TLS_LISTEN_ADDR", "")
+}
+
+// SMTPTLSReloadInterval controls how often the certificate files are checked for changes.
+func SMTPTLSReloadInterval() time.Duration {
+	return MustParseDuration("SMTP_TLS_RELOAD_INTERVAL", "30s")
+}
+
+// SMTPRequireTLS makes strict mode reject senders that did not negotiate TLS.
+// In warn mode plaintext delivery is only logged.
+func SMTPRequireTLS() bool {
+	val := strings.ToLower(strings.TrimSpace(GetEnv("SMTP_REQUIRE_TLS", "false")))
+	return val == "true" || val == "1" || val == "yes"
+}
+
+// MetricsAddr is the listen address for Prometheus metrics, such as
+// "127.0.0.1:9090". They are never served on the public port; empty (the
+// default) disables them.
+func MetricsAddr() string {
+	return strings.TrimSpace(GetEnv("METRICS_ADDR", ""))
+}
+
+// MetricsPath returns the route on MetricsAddr that serves Prometheus
+// metrics, or "off" to disable it.
+func MetricsPath() string {
+	return GetEnv("METRICS_PATH", "/metrics")
+}
+
+// SMTPReplayWindow is how long the Message-ID and DKIM signatures of a
+// processed message are remembered so that a re-delivered copy is refused.
+// Zero disables replay detection.
+func SMTPReplayWindow() time.Duration {
+	return MustParseDuration("SMTP_REPLAY_WINDOW", "24h")
+}
+
+// SMTPReplayClockSkew is how far a message's Date or DKIM t= may precede the
+// opening of the registration it verifies, to allow for unsynchronized clocks.
+func SMTPReplayClockSkew() time.Duration {
+	return MustParseDuration("SMTP_REPLAY_CLOCK_SKEW", "2m")
+}
+
+// SMTPSyncVerdicts makes the reply to DATA wait for nonce processing, so a
+// sender whose message did not verify gets a bounce saying why.
+func SMTPSyncVerdicts() bool {
+	val := strings.ToLower(strings.TrimSpace(GetEnv("SMTP_SYNC_VERDICTS", "false")))
+	return val == "true" || val == "1" || val == "yes"
+}
+
+// SMTPQueueFile is the SQLite database holding the verification work queue
+// when this process has no users database of its own (ZINC_ROLE=smtp).
+func SMTPQueueFile() string {
+	return GetEnv("SMTP_QUEUE_FILE", "zinc-queue.db")
+}
+
+// SMTPQueuePollInterval controls how often the verification work queue is
+// scanned for tasks to retry.
+func SMTPQueuePollInterval() time.Duration {
+	return MustParseDuration("SMTP_QUEUE_POLL_INTERVAL", "5s")
+}
+
+// SMTPEmailRegistration lets a verification email carry the username, public
+// key and signature itself, so the account is created without POST /register.
+// It needs the users database and is unavailable with ZINC_ROLE=smtp.
+func SMTPEmailRegistration() bool {
+	val := strings.ToLower(strings.TrimSpace(GetEnv("SMTP_EMAIL_REGISTRATION", "false")))
+	return val == "true" || val == "1" || val == "yes"
+}
+
+// RegistrationStatusTTL is how long the outcome of an email registration can
+// be looked up.
+func RegistrationStatusTTL() time.Duration {
+	return MustParseDuration("REGISTRATION_STATUS_TTL", "1h")
+}
+
+// MinAssurance is the weakest verification accepted for a new account:
+// "low", "medium" or "high". Empty accepts any; relying parties can still
+// ask for more per registration.
+func MinAssurance() string {
+	return strings.ToLower(strings.TrimSpace(GetEnv("MIN_ASSURANCE", "")))
+}
+
+// AdminToken is the bearer token for the /admin API; empty disables it.
+func AdminToken() string {
+	return GetEnv("ADMIN_TOKEN", "")
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ZincRole selects which components this process runs.
+// Valid values: "all" (HTTP API and SMTP listener in one process), "api"
+// (HTTP API plus the verification service) and "smtp" (SMTP listener that
+// reports to a remote verification service). Any other value is an error,
+// since running as "all" by mistake keeps proofs in memory.
+func ZincRole() (string, error) {
+	role := strings.ToLower(strings.TrimSpace(GetEnv("ZINC_ROLE", "all")))
+	switch role {
+	case "all", "api", "smtp":
+		return role, nil
+	default:
+		return "", fmt.Errorf("config: invalid ZINC_ROLE %q (want all, api or smtp)", role)
+	}
+}
+
+// VerifyServiceListen is where the API process serves its verification
+// registry, e.g. "unix:/run/zinc/verify.sock" or "tcp:10.0.0.2:7070".
+// Empty disables the service.
+func VerifyServiceListen() string {
+	return GetEnv("VERIFY_SERVICE_LISTEN", "")
+}
+
+// VerifyServiceAddr is the verification service an SMTP-only process reports to.
+func VerifyServiceAddr() string {
+	return GetEnv("VERIFY_SERVICE_ADDR", "")
+}
+
+// VerifyServiceSecret is the shared secret authenticating SMTP processes to the service.
+func VerifyServiceSecret() string {
+	return GetEnv("VERIFY_SERVICE_SECRET", "")
+}
+
+// VerifyServiceTimeout bounds each call to the verification service.
+func VerifyServiceTimeout() time.Duration {
+	return MustParseDuration("VERIFY_SERVICE_TIMEOUT", "5s")
+}
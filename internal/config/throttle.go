@@ -0,0 +1,72 @@
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+// SMTPConnRateLimit is the number of SMTP sessions one client IP may open per
+// SMTPThrottleWindow before further sessions are refused with a 421.
+func SMTPConnRateLimit() int {
+	return parseIntEnv("SMTP_CONN_RATE_LIMIT", 30)
+}
+
+// SMTPMailRateLimit is the number of MAIL transactions one client IP may start
+// per SMTPThrottleWindow, across all of its connections.
+func SMTPMailRateLimit() int {
+	return parseIntEnv("SMTP_MAIL_RATE_LIMIT", 60)
+}
+
+// SMTPThrottleWindow is the sliding window for the per-IP rate limits.
+func SMTPThrottleWindow() time.Duration {
+	return MustParseDuration("SMTP_THROTTLE_WINDOW", "1m")
+}
+
+// SMTPMaxConnsPerIP caps concurrent SMTP sessions from a single client IP.
+func SMTPMaxConnsPerIP() int {
+	return parseIntEnv("SMTP_MAX_CONNS_PER_IP", 10)
+}
+
+// SMTPGreetDelay holds back the 220 greeting on the plaintext listener. Clients
+// that talk before the greeting are rejected. Zero disables the delay.
+func SMTPGreetDelay() time.Duration {
+	return MustParseDuration("SMTP_GREET_DELAY", "0s")
+}
+
+// SMTPGreylistEnabled turns on greylisting: the first delivery attempt for an
+// unseen ip/sender/recipient triplet is deferred with a 451. The recipient is
+// the verification mailbox without its nonce, so a sender that passed once is
+// not deferred on later registrations.
+func SMTPGreylistEnabled() bool {
+	val := strings.ToLower(strings.TrimSpace(GetEnv("SMTP_GREYLIST_ENABLED", "false")))
+	return val == "true" || val == "1" || val == "yes"
+}
+
+// SMTPGreylistDelay is how long a sender must wait before a retry is accepted.
+// Keep it well below the fixed 3-minute wait in api/register.go, counting the
+// sender's own retry interval, or greylisted users cannot finish.
+func SMTPGreylistDelay() time.Duration {
+	return MustParseDuration("SMTP_GREYLIST_DELAY", "30s")
+}
+
+// SMTPGreylistRetryWindow is how long after the first attempt a retry still
+// counts; later retries start over.
+func SMTPGreylistRetryWindow() time.Duration {
+	return MustParseDuration("SMTP_GREYLIST_RETRY_WINDOW", "4h")
+}
+
+// SMTPGreylistTTL is how long a triplet that passed greylisting stays trusted.
+func SMTPGreylistTTL() time.Duration {
+	return MustParseDuration("SMTP_GREYLIST_TTL", "720h")
+}
+
+// SMTPTarpitDelay is the delay added per invalid recipient in a session. It
+// grows linearly with each invalid RCPT up to SMTPTarpitMaxDelay. Zero disables it.
+func SMTPTarpitDelay() time.Duration {
+	return MustParseDuration("SMTP_TARPIT_DELAY", "1s")
+}
+
+// SMTPTarpitMaxDelay caps the tarpit delay applied to a single RCPT command.
+func SMTPTarpitMaxDelay() time.Duration {
+	return MustParseDuration("SMTP_TARPIT_MAX_DELAY", "10s")
+}
@@ -0,0 +1,39 @@
+package config
+
+import "time"
+
+// WebhookURLs returns the endpoints that receive account lifecycle events.
+// Webhooks are disabled when empty.
+func WebhookURLs() []string {
+	return GetEnvList("WEBHOOK_URLS")
+}
+
+// WebhookWorkerCount controls the number of webhook delivery workers.
+func WebhookWorkerCount() int {
+	return parseIntEnv("WEBHOOK_WORKER_COUNT", 2)
+}
+
+// WebhookMaxAttempts is the number of delivery attempts before an event is dead-lettered.
+func WebhookMaxAttempts() int {
+	return parseIntEnv("WEBHOOK_MAX_ATTEMPTS", 8)
+}
+
+// WebhookRetryBase is the first retry delay; each later retry doubles it.
+func WebhookRetryBase() time.Duration {
+	return MustParseDuration("WEBHOOK_RETRY_BASE", "5s")
+}
+
+// WebhookRetryMax caps the exponential retry delay.
+func WebhookRetryMax() time.Duration {
+	return MustParseDuration("WEBHOOK_RETRY_MAX", "1h")
+}
+
+// WebhookTimeout bounds a single delivery request.
+func WebhookTimeout() time.Duration {
+	return MustParseDuration("WEBHOOK_TIMEOUT", "10s")
+}
+
+// WebhookPollInterval controls how often the outbox is scanned for due deliveries.
+func WebhookPollInterval() time.Duration {
+	return MustParseDuration("WEBHOOK_POLL_INTERVAL", "2s")
+}
@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"strconv"
+	"time"
+)
+
+// IssuedKey is the ProofStore key holding when the registration waiting on a
+// nonce was opened.
+func IssuedKey(nonce string) string {
+	return "issued:" + nonce
+}
+
+// SaveIssued records when the registration for a nonce was opened.
+func SaveIssued(store ProofStore, nonce string, at time.Time, ttl time.Duration) error {
+	return store.SetWithValue(IssuedKey(nonce), strconv.FormatInt(at.Unix(), 10), ttl)
+}
+
+// LoadIssued returns when the registration for a nonce was opened, if known.
+func LoadIssued(store ProofStore, nonce string) (time.Time, bool) {
+	v, ok := store.Get(IssuedKey(nonce))
+	if !ok {
+		return time.Time{}, false
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(sec, 0), true
+}
@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/models"
+)
+
+// OutcomeKey is the ProofStore key holding the result of a registration
+// completed by email, which the client looks up after sending the message.
+func OutcomeKey(nonce string) string {
+	return "outcome:" + nonce
+}
+
+// SaveOutcome stores the result of an email registration for a nonce.
+func SaveOutcome(store ProofStore, nonce string, o models.RegistrationStatusResponse, ttl time.Duration) error {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	return store.SetWithValue(OutcomeKey(nonce), string(b), ttl)
+}
+
+// LoadOutcome returns the stored email registration result for a nonce, if any.
+func LoadOutcome(store ProofStore, nonce string) (*models.RegistrationStatusResponse, bool) {
+	v, ok := store.Get(OutcomeKey(nonce))
+	if !ok {
+		return nil, false
+	}
+	var o models.RegistrationStatusResponse
+	if err := json.Unmarshal([]byte(v), &o); err != nil {
+		return nil, false
+	}
+	return &o, true
+}
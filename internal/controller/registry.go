@@ -0,0 +1,31 @@
+package controller
+
+import "time"
+
+// Notifier fires the verification interrupt for a nonce. The SMTP side only
+// needs this half of the registry, so it can live in a separate process.
+type Notifier interface {
+	Notify(nonce string)
+}
+
+// Registry hands out wait channels to registration handlers and fires them
+// when the matching verification email arrives.
+type Registry interface {
+	Notifier
+	Register(nonce string) chan struct{}
+	Delete(nonce string)
+}
+
+// ProofStore holds the short-lived verification state shared between the
+// HTTP handler and the SMTP listener: the expected email for a pending nonce
+// and the SMTP-verified proof for it.
+type ProofStore interface {
+	SetWithValue(key, value string, ttl time.Duration) error
+	Get(key string) (string, bool)
+	// Lookup is Get that tells a failed read apart from a missing key, for
+	// callers that must not mistake an outage for an expired registration.
+	Lookup(key string) (string, bool, error)
+	Delete(key string)
+}
+
+var _ Registry = (*VerificationRegistry)(nil)
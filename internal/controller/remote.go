@@ -0,0 +1,496 @@
+package controller
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	"github.com/Goofygiraffe06/zinc/internal/utils"
+)
+
+// The verification service lets the SMTP listener run in a different process
+// from the HTTP API. The API process serves its Registry and ProofStore over
+// TCP or a Unix socket; the SMTP process talks to it through a RemoteClient.
+//
+// The protocol is newline-delimited JSON. On connect the server sends a random
+// challenge and the client must answer with HMAC-SHA256(secret, challenge)
+// before any other request is served, so the secret never crosses the wire.
+// Every later request and response carries a sequence number and an
+// HMAC-SHA256 under a key derived from the secret and the challenge, so a
+// message injected, altered, replayed or reordered on the path is refused.
+// The link is not encrypted: it carries addresses, so run it over a Unix
+// socket or a private network.
+
+var (
+	ErrRemoteAuth     = errors.New("verification service: authentication failed")
+	ErrRemoteClosed   = errors.New("verification service: client closed")
+	ErrRemoteTooLarge = errors.New("verification service: request too large")
+)
+
+const (
+	opAuth   = "auth"
+	opNotify = "notify"
+	opSet    = "set"
+	opGet    = "get"
+	opDelete = "delete"
+
+	// Values include JSON verification reports, escaped once more on the
+	// wire; the client refuses larger requests rather than lose the link
+	maxRemoteLine = 1 << 20
+)
+
+type remoteRequest struct {
+	Op    string `json:"op"`
+	Seq   uint64 `json:"seq,omitempty"`
+	MAC   string `json:"mac,omitempty"`
+	Key   string `json:"key,omitempty"`
+	Value string `json:"value,omitempty"`
+	TTLMs int64  `json:"ttl_ms,omitempty"`
+}
+
+type remoteResponse struct {
+	Challenge string `json:"challenge,omitempty"`
+	Seq       uint64 `json:"seq,omitempty"`
+	MAC       string `json:"mac,omitempty"`
+	OK        bool   `json:"ok"`
+	Found     bool   `json:"found,omitempty"`
+	Value     string `json:"value,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ListenService opens a listener for addr, which is either "unix:/path/to.sock"
+// or a TCP address ("tcp:host:port" or plain "host:port").
+func ListenService(addr string) (net.Listener, error) {
+	network, address := splitServiceAddr(addr)
+	if network == "unix" {
+		// A stale socket from a previous run would make Listen fail
+		_ = os.Remove(address)
+	}
+	return net.Listen(network, address)
+}
+
+func splitServiceAddr(addr string) (network, address string) {
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		return "unix", strings.TrimPrefix(addr, "unix:")
+	case strings.HasPrefix(addr, "tcp:"):
+		return "tcp", strings.TrimPrefix(addr, "tcp:")
+	default:
+		return "tcp", addr
+	}
+}
+
+func computeMAC(secret, challenge string) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(challenge))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// sessionKey derives the key that signs one connection's messages. It differs
+// from the authentication MAC, which is sent in the clear.
+func sessionKey(secret, challenge string) []byte {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte("zinc verification session\n"))
+	m.Write([]byte(challenge))
+	return m.Sum(nil)
+}
+
+// messageMAC signs a message without its mac field. The label keeps a
+// response from being reflected back as a request.
+func messageMAC(key []byte, label string, msg interface{}) string {
+	body, _ := json.Marshal(msg)
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(label))
+	m.Write([]byte{'\n'})
+	m.Write(body)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+func requestMAC(key []byte, req remoteRequest) string {
+	req.MAC = ""
+	return messageMAC(key, "request", req)
+}
+
+func responseMAC(key []byte, resp remoteResponse) string {
+	resp.MAC = ""
+	return messageMAC(key, "response", resp)
+}
+
+// RemoteServer exposes a Registry and ProofStore to remote SMTP listeners.
+type RemoteServer struct {
+	registry Registry
+	proofs   ProofStore
+	secret   string
+	ln       net.Listener
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// NewRemoteServer constructs a server; secret must be shared with the clients.
+func NewRemoteServer(registry Registry, proofs ProofStore, secret string) *RemoteServer {
+	return &RemoteServer{
+		registry: registry,
+		proofs:   proofs,
+		secret:   secret,
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+// Start begins serving on ln in a separate goroutine.
+func (s *RemoteServer) Start(ln net.Listener) error {
+	if s.secret == "" {
+		return errors.New("verification service: empty secret")
+	}
+	s.ln = ln
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		logging.InfoLog("Verification service listening on %s", ln.Addr())
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				logging.WarnLog("Verification service accept error: %v", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			s.track(conn, true)
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				defer s.track(conn, false)
+				s.serve(conn)
+			}()
+		}
+	}()
+	return nil
+}
+
+// Stop closes the listener and all client connections.
+func (s *RemoteServer) Stop() {
+	if s == nil || s.ln == nil {
+		return
+	}
+	_ = s.ln.Close()
+	s.mu.Lock()
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *RemoteServer) track(c net.Conn, add bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if add {
+		s.conns[c] = struct{}{}
+		return
+	}
+	delete(s.conns, c)
+	_ = c.Close()
+}
+
+func (s *RemoteServer) serve(conn net.Conn) {
+	remote := conn.RemoteAddr().String()
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(make([]byte, 0, 512), maxRemoteLine)
+	enc := json.NewEncoder(conn)
+
+	challenge, err := randomHex(32)
+	if err != nil {
+		logging.ErrorLog("Verification service: challenge generation failed: %v", err)
+		return
+	}
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := enc.Encode(remoteResponse{Challenge: challenge}); err != nil {
+		return
+	}
+
+	var key []byte
+	var seq uint64
+	for sc.Scan() {
+		var req remoteRequest
+		if err := json.Unmarshal(sc.Bytes(), &req); err != nil {
+			_ = enc.Encode(remoteResponse{Error: "bad request"})
+			return
+		}
+
+		if key == nil {
+			expected := computeMAC(s.secret, challenge)
+			if req.Op != opAuth || !hmac.Equal([]byte(req.MAC), []byte(expected)) {
+				logging.WarnLog("Verification service: authentication failed from=%s", remote)
+				_ = enc.Encode(remoteResponse{Error: "unauthorized"})
+				return
+			}
+			key = sessionKey(s.secret, challenge)
+			// Authenticated connections are long-lived; only bound individual writes
+			_ = conn.SetDeadline(time.Time{})
+			logging.DebugLog("Verification service: client authenticated from=%s", remote)
+			resp := remoteResponse{OK: true}
+			resp.MAC = responseMAC(key, resp)
+			if err := enc.Encode(resp); err != nil {
+				return
+			}
+			continue
+		}
+
+		// Requests are numbered from 1; anything out of order was tampered with
+		if req.Seq != seq+1 || !hmac.Equal([]byte(req.MAC), []byte(requestMAC(key, req))) {
+			logging.WarnLog("Verification service: unsigned or out-of-sequence request from=%s", remote)
+			_ = enc.Encode(remoteResponse{Error: "unauthorized"})
+			return
+		}
+		seq = req.Seq
+
+		resp := s.handle(req)
+		resp.Seq = req.Seq
+		resp.MAC = responseMAC(key, resp)
+		_ = conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+func (s *RemoteServer) handle(req remoteRequest) remoteResponse {
+	if req.Key == "" {
+		return remoteResponse{Error: "missing key"}
+	}
+	switch req.Op {
+	case opNotify:
+		s.registry.Notify(req.Key)
+		return remoteResponse{OK: true}
+	case opSet:
+		if err := s.proofs.SetWithValue(req.Key, req.Value, time.Duration(req.TTLMs)*time.Millisecond); err != nil {
+			logging.WarnLog("Verification service: set failed [%s]: %v", utils.HashEmail(req.Key), err)
+			return remoteResponse{Error: err.Error()}
+		}
+		return remoteResponse{OK: true}
+	case opGet:
+		v, found, err := s.proofs.Lookup(req.Key)
+		if err != nil {
+			logging.WarnLog("Verification service: get failed [%s]: %v", utils.HashEmail(req.Key), err)
+			return remoteResponse{Error: err.Error()}
+		}
+		return remoteResponse{OK: true, Found: found, Value: v}
+	case opDelete:
+		s.proofs.Delete(req.Key)
+		return remoteResponse{OK: true}
+	default:
+		return remoteResponse{Error: "unknown op"}
+	}
+}
+
+// RemoteClient is the SMTP-side view of a RemoteServer. It implements
+// Notifier and ProofStore, reconnecting transparently when the link drops.
+type RemoteClient struct {
+	addr    string
+	secret  string
+	timeout time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	rd     *bufio.Scanner
+	key    []byte
+	seq    uint64
+	closed bool
+}
+
+var (
+	_ Notifier   = (*RemoteClient)(nil)
+	_ ProofStore = (*RemoteClient)(nil)
+)
+
+// NewRemoteClient constructs a client for the service at addr (see ListenService).
+// The connection is established lazily on first use.
+func NewRemoteClient(addr, secret string, timeout time.Duration) *RemoteClient {
+	return &RemoteClient{addr: addr, secret: secret, timeout: timeout}
+}
+
+// Notify fires the interrupt for nonce on the remote registry.
+func (c *RemoteClient) Notify(nonce string) {
+	if _, err := c.call(remoteRequest{Op: opNotify, Key: nonce}); err != nil {
+		logging.ErrorLog("Interrupt: remote notify failed [%s]: %v", utils.HashEmail(nonce), err)
+	}
+}
+
+// SetWithValue stores key=value on the remote proof store.
+func (c *RemoteClient) SetWithValue(key, value string, ttl time.Duration) error {
+	_, err := c.call(remoteRequest{Op: opSet, Key: key, Value: value, TTLMs: ttl.Milliseconds()})
+	return err
+}
+
+// Get reads key from the remote proof store. Transport errors read as "not
+// found"; use Lookup where that difference matters.
+func (c *RemoteClient) Get(key string) (string, bool) {
+	value, found, err := c.Lookup(key)
+	if err != nil {
+		logging.ErrorLog("Verification service: remote get failed [%s]: %v", utils.HashEmail(key), err)
+	}
+	return value, found
+}
+
+// Lookup reads key from the remote proof store, returning transport and
+// service errors.
+func (c *RemoteClient) Lookup(key string) (string, bool, error) {
+	resp, err := c.call(remoteRequest{Op: opGet, Key: key})
+	if err != nil {
+		return "", false, err
+	}
+	return resp.Value, resp.Found, nil
+}
+
+// Delete removes key from the remote proof store.
+func (c *RemoteClient) Delete(key string) {
+	if _, err := c.call(remoteRequest{Op: opDelete, Key: key}); err != nil {
+		logging.ErrorLog("Verification service: remote delete failed [%s]: %v", utils.HashEmail(key), err)
+	}
+}
+
+// Close drops the connection; later calls fail with ErrRemoteClosed.
+func (c *RemoteClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return c.resetLocked()
+}
+
+func (c *RemoteClient) call(req remoteRequest) (remoteResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return remoteResponse{}, ErrRemoteClosed
+	}
+
+	// One retry covers a connection the server closed since the last call
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		if c.conn == nil {
+			if err := c.connectLocked(); err != nil {
+				return remoteResponse{}, err
+			}
+		}
+		resp, err := c.signedRoundTripLocked(req)
+		if errors.Is(err, ErrRemoteTooLarge) {
+			return remoteResponse{}, err
+		}
+		if err == nil {
+			if resp.Error != "" {
+				return resp, errors.New(resp.Error)
+			}
+			return resp, nil
+		}
+		lastErr = err
+		_ = c.resetLocked()
+	}
+	return remoteResponse{}, lastErr
+}
+
+func (c *RemoteClient) connectLocked() error {
+	network, address := splitServiceAddr(c.addr)
+	conn, err := net.DialTimeout(network, address, c.timeout)
+	if err != nil {
+		return fmt.Errorf("verification service dial: %w", err)
+	}
+	c.conn = conn
+	c.rd = bufio.NewScanner(conn)
+	c.rd.Buffer(make([]byte, 0, 512), maxRemoteLine)
+
+	greeting, err := c.readLocked()
+	if err != nil {
+		_ = c.resetLocked()
+		return fmt.Errorf("verification service greeting: %w", err)
+	}
+	resp, err := c.roundTripLocked(remoteRequest{Op: opAuth, MAC: computeMAC(c.secret, greeting.Challenge)})
+	key := sessionKey(c.secret, greeting.Challenge)
+	if err != nil || !resp.OK || !hmac.Equal([]byte(resp.MAC), []byte(responseMAC(key, resp))) {
+		_ = c.resetLocked()
+		return ErrRemoteAuth
+	}
+	c.key, c.seq = key, 0
+	logging.DebugLog("Verification service: connected to %s", c.addr)
+	return nil
+}
+
+// signedRoundTripLocked numbers and signs req and checks that the response
+// answers it.
+func (c *RemoteClient) signedRoundTripLocked(req remoteRequest) (remoteResponse, error) {
+	req.Seq = c.seq + 1
+	req.MAC = requestMAC(c.key, req)
+	resp, err := c.roundTripLocked(req)
+	if err != nil {
+		return resp, err
+	}
+	c.seq = req.Seq
+	if resp.Seq != req.Seq || !hmac.Equal([]byte(resp.MAC), []byte(responseMAC(c.key, resp))) {
+		return remoteResponse{}, errors.New("verification service: unsigned or out-of-sequence response")
+	}
+	return resp, nil
+}
+
+func (c *RemoteClient) roundTripLocked(req remoteRequest) (remoteResponse, error) {
+	line, err := json.Marshal(req)
+	if err != nil {
+		return remoteResponse{}, err
+	}
+	// The server would drop the connection over it
+	if len(line) >= maxRemoteLine {
+		return remoteResponse{}, fmt.Errorf("%w: %d bytes", ErrRemoteTooLarge, len(line))
+	}
+	_ = c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := c.conn.Write(append(line, '\n')); err != nil {
+		return remoteResponse{}, err
+	}
+	return c.readLocked()
+}
+
+func (c *RemoteClient) readLocked() (remoteResponse, error) {
+	_ = c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+	if !c.rd.Scan() {
+		if err := c.rd.Err(); err != nil {
+			return remoteResponse{}, err
+		}
+		return remoteResponse{}, errors.New("connection closed")
+	}
+	var resp remoteResponse
+	if err := json.Unmarshal(c.rd.Bytes(), &resp); err != nil {
+		return remoteResponse{}, err
+	}
+	return resp, nil
+}
+
+func (c *RemoteClient) resetLocked() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	c.rd = nil
+	c.key, c.seq = nil, 0
+	return err
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("crypto/rand failed: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/models"
+)
+
+// ReportTTL keeps a verification report around for the rest of the
+// registration wait.
+const ReportTTL = 5 * time.Minute
+
+// ReportKey is the ProofStore key holding the verification report for a nonce.
+func ReportKey(nonce string) string {
+	return "report:" + nonce
+}
+
+// SaveReport stores the verification report for a nonce.
+func SaveReport(store ProofStore, nonce string, r models.VerificationReport) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return store.SetWithValue(ReportKey(nonce), string(b), ReportTTL)
+}
+
+// LoadReport returns the stored verification report for a nonce, if any.
+func LoadReport(store ProofStore, nonce string) (*models.VerificationReport, bool) {
+	v, ok := store.Get(ReportKey(nonce))
+	if !ok {
+		return nil, false
+	}
+	var r models.VerificationReport
+	if err := json.Unmarshal([]byte(v), &r); err != nil {
+		return nil, false
+	}
+	return &r, true
+}
@@ -0,0 +1,98 @@
+// Package filewatch polls files for changes so configuration and certificates
+// can be reloaded without a restart.
+package filewatch
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+)
+
+// Watcher calls a function whenever any of its files changes size or mtime.
+// Polling is used instead of inotify so it behaves the same on every platform
+// and across atomic renames (e.g. certbot or Kubernetes secret updates).
+type Watcher struct {
+	paths    []string
+	interval time.Duration
+	onChange func()
+
+	stamps   map[string]stamp
+	stop     chan struct{}
+	done     chan struct{}
+	shutdown sync.Once
+}
+
+type stamp struct {
+	size    int64
+	modTime time.Time
+	exists  bool
+}
+
+// New creates a watcher for paths; onChange runs on the watcher goroutine.
+func New(interval time.Duration, onChange func(), paths ...string) *Watcher {
+	w := &Watcher{
+		paths:    paths,
+		interval: interval,
+		onChange: onChange,
+		stamps:   make(map[string]stamp, len(paths)),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, p := range paths {
+		w.stamps[p] = statFile(p)
+	}
+	return w
+}
+
+// Start begins polling in a separate goroutine.
+func (w *Watcher) Start() {
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				if w.changed() {
+					w.onChange()
+				}
+			}
+		}
+	}()
+}
+
+// Stop halts polling and waits for the watcher goroutine to exit.
+func (w *Watcher) Stop() {
+	if w == nil {
+		return
+	}
+	w.shutdown.Do(func() {
+		close(w.stop)
+		<-w.done
+	})
+}
+
+func (w *Watcher) changed() bool {
+	changed := false
+	for _, p := range w.paths {
+		cur := statFile(p)
+		if cur != w.stamps[p] {
+			logging.DebugLog("filewatch: change detected on %s", p)
+			w.stamps[p] = cur
+			changed = true
+		}
+	}
+	return changed
+}
+
+func statFile(path string) stamp {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return stamp{}
+	}
+	return stamp{size: fi.Size(), modTime: fi.ModTime(), exists: true}
+}
@@ -0,0 +1,469 @@
+// Package imappoll fetches verification mail from IMAP mailboxes, such as a
+// hosted verify@ box, for deployments that cannot receive SMTP themselves.
+//
+// Each mailbox is searched for messages above the last processed UID, which
+// is kept in a state file, and waits for more with IDLE or a poll interval.
+// Handled messages are moved to a processed mailbox or flagged ProcessedFlag,
+// so neither a restart nor a lost state file processes a message twice.
+package imappoll
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/config"
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+	"github.com/Goofygiraffe06/zinc/internal/utils"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	smtpcore "github.com/emersion/go-smtp"
+)
+
+// ProcessedFlag marks messages that were handled but left in the mailbox.
+const ProcessedFlag = "$ZincProcessed"
+
+// fetchBatch bounds how many messages are held in memory at once.
+const fetchBatch = 20
+
+// Deliverer runs a message through the verification pipeline; it is
+// implemented by smtpserver.Backend.
+type Deliverer interface {
+	Deliver(msg smtpserver.InboundMessage) ([]error, error)
+}
+
+// Options configures a Poller.
+type Options struct {
+	Interval time.Duration
+	Idle     bool
+	// Processed is the mailbox handled messages are moved to; empty flags them.
+	Processed string
+	StateFile string
+	Timeout   time.Duration
+	// AllowPlaintext logs in to an imap:// server that offers no STARTTLS.
+	AllowPlaintext bool
+}
+
+// OptionsFromConfig reads the IMAP_* settings.
+func OptionsFromConfig() Options {
+	return Options{
+		Interval:  config.IMAPPollInterval(),
+		Idle:      config.IMAPIdleEnabled(),
+		Processed: config.IMAPProcessedMailbox(),
+		StateFile: config.IMAPStateFile(),
+		Timeout:   config.IMAPTimeout(),
+
+		AllowPlaintext: config.IMAPAllowPlaintext(),
+	}
+}
+
+// mailbox is one polled IMAP mailbox.
+type mailbox struct {
+	// name identifies the mailbox in logs and the state file; it has no password.
+	name        string
+	addr        string
+	host        string
+	implicitTLS bool
+	username    string
+	password    string
+	mailbox     string
+}
+
+// parseMailboxURL reads imap[s]://user:password@host[:port][/mailbox].
+func parseMailboxURL(raw string) (*mailbox, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IMAP URL: %w", err)
+	}
+	mb := &mailbox{host: u.Hostname(), mailbox: strings.TrimPrefix(u.Path, "/")}
+	port := u.Port()
+	switch u.Scheme {
+	case "imap":
+		if port == "" {
+			port = "143"
+		}
+	case "imaps":
+		mb.implicitTLS = true
+		if port == "" {
+			port = "993"
+		}
+	default:
+		return nil, fmt.Errorf("IMAP URL %q: scheme must be imap or imaps", u.Redacted())
+	}
+	if u.User == nil || mb.host == "" {
+		return nil, fmt.Errorf("IMAP URL %q: needs credentials and a host", u.Redacted())
+	}
+	mb.username = u.User.Username()
+	mb.password, _ = u.User.Password()
+	if mb.mailbox == "" {
+		mb.mailbox = "INBOX"
+	}
+	mb.addr = net.JoinHostPort(mb.host, port)
+	mb.name = mb.username + "@" + mb.addr + "/" + mb.mailbox
+	return mb, nil
+}
+
+// Poller polls a set of mailboxes, one goroutine each.
+type Poller struct {
+	backend Deliverer
+	boxes   []*mailbox
+	opts    Options
+	state   *stateFile
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// New validates the mailbox URLs and loads the UID state.
+func New(backend Deliverer, urls []string, opts Options) (*Poller, error) {
+	p := &Poller{backend: backend, opts: opts, stop: make(chan struct{})}
+	for _, raw := range urls {
+		mb, err := parseMailboxURL(raw)
+		if err != nil {
+			return nil, err
+		}
+		p.boxes = append(p.boxes, mb)
+	}
+	state, err := loadState(opts.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	p.state = state
+	return p, nil
+}
+
+// Start begins polling every mailbox in the background.
+func (p *Poller) Start() {
+	for _, mb := range p.boxes {
+		p.wg.Add(1)
+		go p.run(mb)
+	}
+}
+
+// Stop ends polling and waits for in-flight messages to be handled.
+func (p *Poller) Stop() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	p.wg.Wait()
+}
+
+func (p *Poller) stopped() bool {
+	select {
+	case <-p.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// run keeps a session open to mb, reconnecting after errors.
+func (p *Poller) run(mb *mailbox) {
+	defer p.wg.Done()
+	logging.InfoLog("IMAP polling %s (idle=%t, interval=%s)", mb.name, p.opts.Idle, p.opts.Interval)
+	for {
+		err := p.session(mb)
+		if p.stopped() {
+			return
+		}
+		logging.WarnLog("IMAP %s: %v; reconnecting in %s", mb.name, err, p.opts.Interval)
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(p.opts.Interval):
+		}
+	}
+}
+
+func (p *Poller) dial(mb *mailbox) (*client.Client, error) {
+	dialer := &net.Dialer{Timeout: p.opts.Timeout}
+	tlsConfig := &tls.Config{ServerName: mb.host, MinVersion: tls.VersionTLS12}
+	if mb.implicitTLS {
+		return client.DialWithDialerTLS(dialer, mb.addr, tlsConfig)
+	}
+	c, err := client.DialWithDialer(dialer, mb.addr)
+	if err != nil {
+		return nil, err
+	}
+	// A server without STARTTLS, or one whose offer was stripped on the way,
+	// would otherwise receive the password in the clear
+	if ok, _ := c.SupportStartTLS(); !ok {
+		if !p.opts.AllowPlaintext {
+			c.Logout()
+			return nil, errors.New("server offers no STARTTLS; set IMAP_ALLOW_PLAINTEXT=true to log in unencrypted")
+		}
+		logging.WarnLog("IMAP %s: no STARTTLS, logging in unencrypted", mb.name)
+		return c, nil
+	}
+	if err := c.StartTLS(tlsConfig); err != nil {
+		c.Logout()
+		return nil, fmt.Errorf("starttls: %w", err)
+	}
+	return c, nil
+}
+
+// session logs in, then alternates between polling and waiting for new mail
+// until an error or Stop.
+func (p *Poller) session(mb *mailbox) error {
+	c, err := p.dial(mb)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer c.Logout()
+	c.Timeout = p.opts.Timeout
+
+	if err := c.Login(mb.username, mb.password); err != nil {
+		return fmt.Errorf("login: %w", err)
+	}
+	if p.opts.Processed != "" {
+		// fails harmlessly when the mailbox already exists
+		_ = c.Create(p.opts.Processed)
+	}
+	status, err := c.Select(mb.mailbox, false)
+	if err != nil {
+		return fmt.Errorf("select %s: %w", mb.mailbox, err)
+	}
+
+	// New mail shows up as a mailbox update; the reader must never block on it
+	wake := make(chan struct{}, 1)
+	updates := make(chan client.Update, 16)
+	c.Updates = updates
+	go func() {
+		for {
+			select {
+			case u := <-updates:
+				if _, ok := u.(*client.MailboxUpdate); ok {
+					select {
+					case wake <- struct{}{}:
+					default:
+					}
+				}
+			case <-c.LoggedOut():
+				return
+			}
+		}
+	}()
+
+	for {
+		if err := p.poll(c, mb, status.UidValidity); err != nil {
+			return err
+		}
+		stopped, err := p.wait(c, wake)
+		if err != nil || stopped {
+			return err
+		}
+	}
+}
+
+// wait returns once new mail may have arrived, the interval has passed or
+// the poller is stopping.
+func (p *Poller) wait(c *client.Client, wake <-chan struct{}) (bool, error) {
+	timer := time.NewTimer(p.opts.Interval)
+	defer timer.Stop()
+	if !p.opts.Idle {
+		select {
+		case <-p.stop:
+			return true, nil
+		case <-timer.C:
+			return false, nil
+		}
+	}
+
+	// IDLE outlasts any command timeout
+	c.Timeout = 0
+	defer func() { c.Timeout = p.opts.Timeout }()
+	stopIdle := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Idle(stopIdle, &client.IdleOptions{PollInterval: p.opts.Interval})
+	}()
+	stopped := false
+	select {
+	case <-wake:
+	case <-timer.C:
+	case <-p.stop:
+		stopped = true
+	case err := <-done:
+		return false, err
+	}
+	close(stopIdle)
+	return stopped, <-done
+}
+
+// poll handles every message above the last processed UID, oldest first.
+func (p *Poller) poll(c *client.Client, mb *mailbox, validity uint32) error {
+	st := p.state.get(mb.name)
+	if st.UIDValidity != validity {
+		if st.UIDValidity != 0 {
+			logging.WarnLog("IMAP %s: UIDVALIDITY changed, rescanning unprocessed messages", mb.name)
+		}
+		st = mailboxState{UIDValidity: validity}
+		if err := p.state.set(mb.name, st); err != nil {
+			return fmt.Errorf("saving state: %w", err)
+		}
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.Uid = new(imap.SeqSet)
+	criteria.Uid.AddRange(st.LastUID+1, 0)
+	criteria.WithoutFlags = []string{ProcessedFlag}
+	found, err := c.UidSearch(criteria)
+	if err != nil {
+		return fmt.Errorf("search: %w", err)
+	}
+	// "n:*" always matches the highest UID, even when it is below n
+	uids := found[:0]
+	for _, uid := range found {
+		if uid > st.LastUID {
+			uids = append(uids, uid)
+		}
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+
+	for len(uids) > 0 {
+		batch := uids[:min(fetchBatch, len(uids))]
+		uids = uids[len(batch):]
+		bodies, err := fetchBodies(c, batch)
+		if err != nil {
+			return fmt.Errorf("fetch: %w", err)
+		}
+		for _, uid := range batch {
+			if p.stopped() {
+				return nil
+			}
+			if raw, ok := bodies[uid]; ok && p.process(mb, uid, raw) {
+				// leave it and everything after for the next poll
+				return nil
+			}
+			if err := p.markProcessed(c, uid); err != nil {
+				return fmt.Errorf("marking UID %d: %w", uid, err)
+			}
+			st.LastUID = uid
+			if err := p.state.set(mb.name, st); err != nil {
+				return fmt.Errorf("saving state: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func fetchBodies(c *client.Client, uids []uint32) (map[uint32][]byte, error) {
+	set := new(imap.SeqSet)
+	set.AddNum(uids...)
+	section := &imap.BodySectionName{Peek: true}
+	ch := make(chan *imap.Message, len(uids))
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(set, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, ch)
+	}()
+	bodies := make(map[uint32][]byte, len(uids))
+	for msg := range ch {
+		if body := msg.GetBody(section); body != nil {
+			raw, err := io.ReadAll(body)
+			if err != nil {
+				return nil, err
+			}
+			bodies[msg.Uid] = raw
+		}
+	}
+	return bodies, <-done
+}
+
+func (p *Poller) markProcessed(c *client.Client, uid uint32) error {
+	set := new(imap.SeqSet)
+	set.AddNum(uid)
+	if p.opts.Processed != "" {
+		if err := c.UidMove(set, p.opts.Processed); err == nil {
+			return nil
+		}
+		// Some servers advertise MOVE without supporting it
+		if err := c.UidCopy(set, p.opts.Processed); err != nil {
+			return err
+		}
+		deleted := []interface{}{imap.DeletedFlag}
+		if err := c.UidStore(set, imap.FormatFlagsOp(imap.AddFlags, true), deleted, nil); err != nil {
+			return err
+		}
+		return c.Expunge(nil)
+	}
+	flags := []interface{}{imap.SeenFlag, ProcessedFlag}
+	return c.UidStore(set, imap.FormatFlagsOp(imap.AddFlags, true), flags, nil)
+}
+
+// process delivers one message and reports whether it should be retried.
+func (p *Poller) process(mb *mailbox, uid uint32, raw []byte) (retry bool) {
+	msg := smtpserver.InboundMessage{
+		Source:       "imap/" + mb.name,
+		Raw:          raw,
+		EnvelopeFrom: returnPath(raw),
+		Recipients:   recipients(raw),
+	}
+	if len(msg.Recipients) == 0 {
+		logging.WarnLog("IMAP %s: UID %d has no recipient headers, skipping", mb.name, uid)
+		return false
+	}
+	errs, err := p.backend.Deliver(msg)
+	if err != nil {
+		logging.WarnLog("IMAP %s: UID %d refused from=[%s]: %v", mb.name, uid, utils.HashEmail(msg.EnvelopeFrom), err)
+		return temporary(err)
+	}
+	for i, rcptErr := range errs {
+		if rcptErr == nil {
+			logging.InfoLog("IMAP %s: UID %d accepted rcpt=[%s]", mb.name, uid, utils.HashEmail(msg.Recipients[i]))
+			continue
+		}
+		logging.DebugLog("IMAP %s: UID %d rcpt=[%s]: %v", mb.name, uid, utils.HashEmail(msg.Recipients[i]), rcptErr)
+		if temporary(rcptErr) {
+			retry = true
+		}
+	}
+	return retry
+}
+
+func temporary(err error) bool {
+	var smtpErr *smtpcore.SMTPError
+	return errors.As(err, &smtpErr) && smtpErr.Temporary()
+}
+
+func returnPath(raw []byte) string {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return ""
+	}
+	return strings.Trim(strings.TrimSpace(msg.Header.Get("Return-Path")), "<>")
+}
+
+// recipients takes the envelope recipient from the fields the delivering MTA
+// added, falling back to the To and Cc addresses.
+func recipients(raw []byte) []string {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil
+	}
+	for _, name := range []string{"Delivered-To", "X-Original-To"} {
+		if v := strings.TrimSpace(msg.Header.Get(name)); v != "" {
+			return []string{strings.Trim(v, "<>")}
+		}
+	}
+	var out []string
+	for _, name := range []string{"To", "Cc"} {
+		list, err := msg.Header.AddressList(name)
+		if err != nil {
+			continue
+		}
+		for _, a := range list {
+			out = append(out, a.Address)
+		}
+	}
+	return out
+}
@@ -0,0 +1,70 @@
+package imappoll
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// mailboxState is what survives a restart for one mailbox. UIDs are only
+// comparable within one UIDVALIDITY, so a change resets LastUID.
+type mailboxState struct {
+	UIDValidity uint32 `json:"uidvalidity"`
+	LastUID     uint32 `json:"last_uid"`
+}
+
+// stateFile is the JSON file shared by all mailboxes of a Poller.
+type stateFile struct {
+	path string
+	mu   sync.Mutex
+	m    map[string]mailboxState
+}
+
+func loadState(path string) (*stateFile, error) {
+	s := &stateFile{path: path, m: make(map[string]mailboxState)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.m); err != nil {
+		return nil, fmt.Errorf("imap state %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *stateFile) get(key string) mailboxState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.m[key]
+}
+
+// set records a mailbox's state and rewrites the file atomically.
+func (s *stateFile) set(key string, st mailboxState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[key] = st
+	data, err := json.MarshalIndent(s.m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".imap-state-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,126 @@
+// Package inbound turns the inbound-mail webhooks of cloud email providers
+// into messages for the verification backend.
+//
+// Each provider is served at POST /inbound/{name} and is enabled by setting
+// its credential:
+//
+//	raw       INBOUND_RAW_SECRET            raw MIME body, HMAC-SHA256 signed
+//	mailgun   INBOUND_MAILGUN_SIGNING_KEY   forwarded MIME ("body-mime")
+//	sendgrid  INBOUND_SENDGRID_PUBLIC_KEY   signed Inbound Parse, raw mode
+//	postmark  INBOUND_POSTMARK_CREDENTIALS  inbound JSON with RawEmail
+//
+// Verdicts the provider reports are used in place of the local SPF and DKIM
+// checks; DMARC is always evaluated by zinc.
+package inbound
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/config"
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+)
+
+var (
+	// ErrUnauthorized means the request's signature or credentials did not check out.
+	ErrUnauthorized = errors.New("inbound: request signature invalid")
+	// ErrStale means a signed request is older than the accepted tolerance.
+	ErrStale = errors.New("inbound: request signature expired")
+	// ErrMalformed means the request was authentic but carried no usable message.
+	ErrMalformed = errors.New("inbound: malformed request")
+)
+
+// Provider parses one provider's inbound webhook request.
+type Provider interface {
+	// Parse checks the request's signature over body, the raw request body,
+	// and extracts the message.
+	Parse(r *http.Request, body []byte) (smtpserver.InboundMessage, error)
+}
+
+// Providers returns the adapters whose credentials are configured, by name.
+func Providers() map[string]Provider {
+	providers := make(map[string]Provider)
+	tolerance := config.InboundSignatureTolerance()
+	if secret := config.InboundRawSecret(); secret != "" {
+		providers["raw"] = &Raw{Secret: []byte(secret), Tolerance: tolerance}
+	}
+	if key := config.InboundMailgunSigningKey(); key != "" {
+		providers["mailgun"] = &Mailgun{SigningKey: []byte(key), Tolerance: tolerance}
+	}
+	if key := config.InboundSendGridPublicKey(); key != "" {
+		p, err := NewSendGrid(key, tolerance)
+		if err != nil {
+			logging.ErrorLog("Inbound provider sendgrid disabled: %v", err)
+		} else {
+			providers["sendgrid"] = p
+		}
+	}
+	if creds := config.InboundPostmarkCredentials(); creds != "" {
+		user, pass, _ := strings.Cut(creds, ":")
+		providers["postmark"] = &Postmark{Username: user, Password: pass}
+	}
+	return providers
+}
+
+// checkTimestamp enforces the tolerance on a unix-seconds timestamp.
+func checkTimestamp(ts string, tolerance time.Duration) error {
+	unix, err := strconv.ParseInt(strings.TrimSpace(ts), 10, 64)
+	if err != nil {
+		return ErrUnauthorized
+	}
+	if tolerance > 0 {
+		skew := time.Since(time.Unix(unix, 0))
+		if skew < -tolerance || skew > tolerance {
+			return ErrStale
+		}
+	}
+	return nil
+}
+
+// formValues parses a urlencoded or multipart body that was already read.
+func formValues(r *http.Request, body []byte) (url.Values, error) {
+	clone := r.Clone(r.Context())
+	clone.Body = io.NopCloser(bytes.NewReader(body))
+	clone.Form, clone.PostForm, clone.MultipartForm = nil, nil, nil
+	if err := clone.ParseMultipartForm(int64(len(body)) + 1); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return nil, err
+	}
+	return clone.PostForm, nil
+}
+
+// headerOf returns the topmost field of name in a raw message, which is the
+// one the provider added on receipt.
+func headerOf(raw []byte, name string) string {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return ""
+	}
+	return msg.Header.Get(name)
+}
+
+// firstWord returns the verdict at the start of e.g. a Received-SPF value.
+func firstWord(v string) string {
+	if f := strings.Fields(v); len(f) > 0 {
+		return f[0]
+	}
+	return ""
+}
+
+// splitList splits a comma-separated address list.
+func splitList(v string) []string {
+	var out []string
+	for _, a := range strings.Split(v, ",") {
+		if a = strings.Trim(strings.TrimSpace(a), "<>"); a != "" {
+			out = append(out, a)
+		}
+	}
+	return out
+}
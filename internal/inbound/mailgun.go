@@ -0,0 +1,51 @@
+package inbound
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+)
+
+// Mailgun accepts a route's forward() to a URL ending in "mime", which posts
+// the message unparsed in the "body-mime" field. Mailgun signs the post with
+// HMAC-SHA256 over timestamp+token only. Its X-Mailgun-Spf and
+// X-Mailgun-Dkim-Check-Result verdicts travel inside the message, where the
+// sender can write them too, so they are ignored: DKIM is verified locally and
+// SPF is checked against the origin in the Received fields.
+type Mailgun struct {
+	SigningKey []byte
+	Tolerance  time.Duration
+}
+
+func (p *Mailgun) Parse(r *http.Request, body []byte) (smtpserver.InboundMessage, error) {
+	form, err := formValues(r, body)
+	if err != nil {
+		return smtpserver.InboundMessage{}, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	ts, token := form.Get("timestamp"), form.Get("token")
+	sig, err := hex.DecodeString(form.Get("signature"))
+	mac := hmac.New(sha256.New, p.SigningKey)
+	mac.Write([]byte(ts + token))
+	if ts == "" || token == "" || err != nil || !hmac.Equal(sig, mac.Sum(nil)) {
+		return smtpserver.InboundMessage{}, ErrUnauthorized
+	}
+	if err := checkTimestamp(ts, p.Tolerance); err != nil {
+		return smtpserver.InboundMessage{}, err
+	}
+
+	raw := []byte(form.Get("body-mime"))
+	if len(raw) == 0 {
+		return smtpserver.InboundMessage{}, fmt.Errorf("%w: no body-mime field; forward to a URL ending in \"mime\"", ErrMalformed)
+	}
+	return smtpserver.InboundMessage{
+		Source:       "inbound/mailgun",
+		Raw:          raw,
+		EnvelopeFrom: form.Get("sender"),
+		Recipients:   splitList(form.Get("recipient")),
+	}, nil
+}
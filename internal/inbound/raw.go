@@ -0,0 +1,76 @@
+package inbound
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+)
+
+// RawSignatureHeader carries the signature of a raw MIME post:
+//
+//	X-Zinc-Signature: t=<unix seconds>,sha256=<hex HMAC-SHA256>
+//
+// The HMAC covers "<t>.<raw request body>", as for zinc's own webhooks.
+const RawSignatureHeader = "X-Zinc-Signature"
+
+// Raw accepts a message posted as its raw MIME text. The envelope comes from
+// the Return-Path and Delivered-To (or X-Original-To) fields the receiving MTA
+// added, so the signature covers it too.
+type Raw struct {
+	Secret    []byte
+	Tolerance time.Duration
+}
+
+// SignRaw returns a RawSignatureHeader value for body.
+func SignRaw(secret []byte, ts time.Time, body []byte) string {
+	t := strconv.FormatInt(ts.Unix(), 10)
+	return "t=" + t + ",sha256=" + hex.EncodeToString(rawMAC(secret, t, body))
+}
+
+func rawMAC(secret []byte, t string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(t + "."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+func (p *Raw) Parse(r *http.Request, body []byte) (smtpserver.InboundMessage, error) {
+	var t, sigHex string
+	for _, part := range strings.Split(r.Header.Get(RawSignatureHeader), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			t = v
+		case "sha256":
+			sigHex = v
+		}
+	}
+	sig, err := hex.DecodeString(sigHex)
+	if t == "" || err != nil || !hmac.Equal(sig, rawMAC(p.Secret, t, body)) {
+		return smtpserver.InboundMessage{}, ErrUnauthorized
+	}
+	if err := checkTimestamp(t, p.Tolerance); err != nil {
+		return smtpserver.InboundMessage{}, err
+	}
+
+	rcpt := headerOf(body, "Delivered-To")
+	if rcpt == "" {
+		rcpt = headerOf(body, "X-Original-To")
+	}
+	if rcpt == "" {
+		return smtpserver.InboundMessage{}, fmt.Errorf("%w: no Delivered-To or X-Original-To field", ErrMalformed)
+	}
+	return smtpserver.InboundMessage{
+		Source:       "inbound/raw",
+		Raw:          body,
+		EnvelopeFrom: strings.Trim(strings.TrimSpace(headerOf(body, "Return-Path")), "<>"),
+		Recipients:   splitList(rcpt),
+	}, nil
+}
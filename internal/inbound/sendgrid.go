@@ -0,0 +1,108 @@
+package inbound
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+)
+
+// SendGrid webhook signature headers; the ECDSA signature covers the
+// timestamp followed by the raw request body.
+const (
+	SendGridSignatureHeader = "X-Twilio-Email-Event-Webhook-Signature"
+	SendGridTimestampHeader = "X-Twilio-Email-Event-Webhook-Timestamp"
+)
+
+// SendGrid accepts a signed Inbound Parse post with "POST the raw, full MIME
+// message" enabled, so the message arrives unparsed in the "email" field.
+type SendGrid struct {
+	PublicKey *ecdsa.PublicKey
+	Tolerance time.Duration
+}
+
+// NewSendGrid parses the base64 DER verification key shown in the SendGrid
+// console.
+func NewSendGrid(publicKey string, tolerance time.Duration) (*SendGrid, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil {
+		return nil, fmt.Errorf("sendgrid public key: %w", err)
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("sendgrid public key: %w", err)
+	}
+	ec, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("sendgrid public key: not an ECDSA key")
+	}
+	return &SendGrid{PublicKey: ec, Tolerance: tolerance}, nil
+}
+
+func (p *SendGrid) Parse(r *http.Request, body []byte) (smtpserver.InboundMessage, error) {
+	ts := r.Header.Get(SendGridTimestampHeader)
+	sig, err := base64.StdEncoding.DecodeString(r.Header.Get(SendGridSignatureHeader))
+	digest := sha256.Sum256(append([]byte(ts), body...))
+	if ts == "" || err != nil || !ecdsa.VerifyASN1(p.PublicKey, digest[:], sig) {
+		return smtpserver.InboundMessage{}, ErrUnauthorized
+	}
+	if err := checkTimestamp(ts, p.Tolerance); err != nil {
+		return smtpserver.InboundMessage{}, err
+	}
+
+	form, err := formValues(r, body)
+	if err != nil {
+		return smtpserver.InboundMessage{}, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	raw := []byte(form.Get("email"))
+	if len(raw) == 0 {
+		return smtpserver.InboundMessage{}, fmt.Errorf("%w: no email field; enable raw MIME in the Inbound Parse settings", ErrMalformed)
+	}
+	var envelope struct {
+		To   []string `json:"to"`
+		From string   `json:"from"`
+	}
+	if err := json.Unmarshal([]byte(form.Get("envelope")), &envelope); err != nil {
+		return smtpserver.InboundMessage{}, fmt.Errorf("%w: envelope: %v", ErrMalformed, err)
+	}
+
+	auth := &smtpserver.UpstreamResults{SPF: smtpserver.ParseSPFResult(form.Get("SPF"))}
+	auth.DKIM, auth.DKIMDomain = parseSendGridDKIM(form.Get("dkim"))
+	return smtpserver.InboundMessage{
+		Source:       "inbound/sendgrid",
+		Raw:          raw,
+		EnvelopeFrom: envelope.From,
+		Recipients:   envelope.To,
+		RemoteIP:     form.Get("sender_ip"),
+		Auth:         auth,
+	}, nil
+}
+
+// parseSendGridDKIM reads the "dkim" field, e.g. "{@example.org : pass, @esp.test : fail}".
+// As with local DKIM, any passing signature makes the message pass.
+func parseSendGridDKIM(v string) (smtpserver.DKIMResult, []string) {
+	result := smtpserver.DKIMNone
+	var domains []string
+	for _, entry := range strings.Split(strings.Trim(strings.TrimSpace(v), "{}"), ",") {
+		domain, verdict, ok := strings.Cut(entry, ":")
+		if !ok {
+			continue
+		}
+		switch r := smtpserver.ParseDKIMResult(verdict); {
+		case r == smtpserver.DKIMPass:
+			result = smtpserver.DKIMPass
+			domains = append(domains, strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+		case result != smtpserver.DKIMPass:
+			result = r
+		}
+	}
+	return result, domains
+}
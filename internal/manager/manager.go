@@ -8,22 +8,24 @@ import (
 	"github.com/Goofygiraffe06/zinc/internal/workerpool"
 )
 
-// WorkManager provides separate pools for DB, Crypto, and SMTP work.
+// WorkManager provides separate pools for DB, Crypto, SMTP and webhook work.
 // This helps to isolate heavy tasks from HTTP handlers and avoid blocking.
 type WorkManager struct {
-	db     *workerpool.Pool
-	crypto *workerpool.Pool
-	smtp   *workerpool.Pool
+	db      *workerpool.Pool
+	crypto  *workerpool.Pool
+	smtp    *workerpool.Pool
+	webhook *workerpool.Pool
 }
 
 // Option configures the WorkManager.
 type Option func(*options)
 
 type options struct {
-	dbWorkers     int
-	cryptoWorkers int
-	smtpWorkers   int
-	queueSize     int
+	dbWorkers      int
+	cryptoWorkers  int
+	smtpWorkers    int
+	webhookWorkers int
+	queueSize      int
 }
 
 // WithDBWorkers sets the DB worker count.
@@ -35,24 +37,29 @@ func WithCryptoWorkers(n int) Option { return func(o *options) { o.cryptoWorkers
 // WithSMTPWorkers sets the SMTP worker count.
 func WithSMTPWorkers(n int) Option { return func(o *options) { o.smtpWorkers = n } }
 
+// WithWebhookWorkers sets the webhook delivery worker count.
+func WithWebhookWorkers(n int) Option { return func(o *options) { o.webhookWorkers = n } }
+
 // WithQueueSize sets the shared queue size (per pool).
 func WithQueueSize(n int) Option { return func(o *options) { o.queueSize = n } }
 
 // NewWorkManager constructs the manager with the given options (or defaults from config).
 func NewWorkManager(opts ...Option) *WorkManager {
 	o := &options{
-		dbWorkers:     config.DBWorkerCount(),
-		cryptoWorkers: config.CryptoWorkerCount(),
-		smtpWorkers:   config.SMTPWorkerCount(),
-		queueSize:     config.WorkerQueueSize(),
+		dbWorkers:      config.DBWorkerCount(),
+		cryptoWorkers:  config.CryptoWorkerCount(),
+		smtpWorkers:    config.SMTPWorkerCount(),
+		webhookWorkers: config.WebhookWorkerCount(),
+		queueSize:      config.WorkerQueueSize(),
 	}
 	for _, opt := range opts {
 		opt(o)
 	}
 	return &WorkManager{
-		db:     workerpool.New("db", o.dbWorkers, o.queueSize),
-		crypto: workerpool.New("crypto", o.cryptoWorkers, o.queueSize),
-		smtp:   workerpool.New("smtp", o.smtpWorkers, o.queueSize),
+		db:      workerpool.New("db", o.dbWorkers, o.queueSize),
+		crypto:  workerpool.New("crypto", o.cryptoWorkers, o.queueSize),
+		smtp:    workerpool.New("smtp", o.smtpWorkers, o.queueSize),
+		webhook: workerpool.New("webhook", o.webhookWorkers, o.queueSize),
 	}
 }
 
@@ -64,6 +71,7 @@ func (m *WorkManager) Close() {
 	m.db.Close()
 	m.crypto.Close()
 	m.smtp.Close()
+	m.webhook.Close()
 }
 
 // SubmitDB schedules a database task with a context and optional timeout.
@@ -81,6 +89,11 @@ func (m *WorkManager) SubmitSMTP(fn func(ctx context.Context)) error {
 	return m.smtp.Submit(func(ctx context.Context) { fn(ctx) })
 }
 
+// SubmitWebhook schedules an outbound webhook delivery.
+func (m *WorkManager) SubmitWebhook(fn func(ctx context.Context)) error {
+	return m.webhook.Submit(func(ctx context.Context) { fn(ctx) })
+}
+
 // RunWithTimeout runs a function respecting a deadline and returns whether it completed.
 func RunWithTimeout(parent context.Context, d time.Duration, fn func(ctx context.Context)) bool {
 	ctx, cancel := context.WithTimeout(parent, d)
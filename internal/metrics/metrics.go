@@ -0,0 +1,31 @@
+// Package metrics holds zinc's Prometheus collectors and the handler that
+// exposes them.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var registry = prometheus.NewRegistry()
+
+// SMTPDropped counts verification messages that were accepted but discarded
+// before nonce processing, labelled by the reason they were dropped.
+var SMTPDropped = register(prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "zinc",
+	Subsystem: "smtp",
+	Name:      "dropped_messages_total",
+	Help:      "Verification messages dropped as bounces, auto-replies or list mail.",
+}, []string{"reason"}))
+
+func register[C prometheus.Collector](c C) C {
+	registry.MustRegister(c)
+	return c
+}
+
+// Handler serves every collector in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
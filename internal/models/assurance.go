@@ -0,0 +1,14 @@
+package models
+
+// Assurance levels of an email verification, weakest first. They are issued
+// as the acr claim of tokens.
+const (
+	// AssuranceLow means the address received the nonce and nothing more
+	// vouches for the sender.
+	AssuranceLow = "low"
+	// AssuranceMedium means SPF, DKIM or DMARC passed.
+	AssuranceMedium = "medium"
+	// AssuranceHigh means DMARC passed on a DKIM signature aligned with the
+	// From domain and the message arrived over TLS.
+	AssuranceHigh = "high"
+)
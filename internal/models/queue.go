@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// VerifyTask is an accepted verification message whose nonce is waiting to
+// be processed. It is persisted before the sender is acknowledged.
+type VerifyTask struct {
+	ID     int64              `json:"id"`
+	Nonce  string             `json:"nonce"`
+	Report VerificationReport `json:"report"`
+	// SentAt is the earliest time the message claims for itself; zero if unknown.
+	SentAt time.Time `json:"sent_at"`
+	// Registration is set when the message itself asks for an account.
+	Registration  *EmailRegistration `json:"registration,omitempty"`
+	Attempts      int                `json:"attempts"`
+	NextAttemptAt time.Time          `json:"next_attempt_at"`
+	LastError     string             `json:"last_error"`
+	CreatedAt     time.Time          `json:"created_at"`
+}
+
+// EmailRegistration is the account request carried in a verification email,
+// for clients that cannot keep POST /register open while the mail travels.
+type EmailRegistration struct {
+	Username  string `json:"username"`
+	PublicKey string `json:"public_key"`
+	Signature string `json:"signature"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Verification decisions recorded in a VerificationReport.
+const (
+	// DecisionAccepted means the message proved ownership of the address.
+	DecisionAccepted = "accepted"
+	// DecisionRejected means the SMTP listener refused the message.
+	DecisionRejected = "rejected"
+	// DecisionFailed means the message was received but did not match the
+	// pending registration (wrong sender, expired nonce, rate limited).
+	DecisionFailed = "failed"
+	// DecisionReview means the message only soft-failed authentication and
+	// the registration waits for an administrator.
+	DecisionReview = "review"
+)
+
+// VerificationReport records how one verification email was judged.
+type VerificationReport struct {
+	ReceivedAt   time.Time `json:"received_at"`
+	RemoteIP     string    `json:"remote_ip"`
+	HELO         string    `json:"helo"`
+	EnvelopeFrom string    `json:"envelope_from"`
+	HeaderFrom   string    `json:"header_from"`
+	SPF          AuthCheck `json:"spf"`
+	DKIM         AuthCheck `json:"dkim"`
+	DMARC        AuthCheck `json:"dmarc"`
+	ARC          AuthCheck `json:"arc"`
+	TLS          string    `json:"tls"`
+	Mode         string    `json:"mode"`
+	Policy       string    `json:"policy,omitempty"`
+	Decision     string    `json:"decision"`
+	Reason       string    `json:"reason,omitempty"`
+	// Assurance grades how much the checks above vouch for the sender.
+	Assurance string `json:"assurance,omitempty"`
+	// AuthenticationResults is the RFC 8601 rendering of the checks above.
+	AuthenticationResults string `json:"authentication_results"`
+}
+
+// AuthCheck is the outcome of one authentication method.
+type AuthCheck struct {
+	Result string `json:"result"`
+	// Domains are the identities the result applies to: the SPF domain,
+	// valid DKIM signing domains, the DMARC From domain or the ARC sealer.
+	Domains []string `json:"domains,omitempty"`
+	// Policy is the DMARC disposition requested by the domain owner.
+	Policy string `json:"policy,omitempty"`
+}
@@ -1,22 +1,24 @@
 package models
 
 type RegisterInitRequest struct {
-	Email string `json:"email" validate:"required,email"`
+	Email string `json:"email" validate:"required,mailbox"`
 }
 
 type RegisterCompleteRequest struct {
-	Email     string `json:"email" validate:"required,email"`
+	Email     string `json:"email" validate:"required,mailbox"`
 	Username  string `json:"username" validate:"required"`
 	PublicKey string `json:"public_key" validate:"required"`
 	Nonce     string `json:"nonce" validate:"required"`
 	Signature string `json:"signature" validate:"required"`
+	// MinAssurance lets the relying party refuse a weaker verification.
+	MinAssurance string `json:"min_assurance,omitempty" validate:"omitempty,oneof=low medium high"`
 }
 
 type LoginInitRequest struct {
-	Email string `json:"email" validate:"required,email"`
+	Email string `json:"email" validate:"required,mailbox"`
 }
 
 type LoginVerifyRequest struct {
-	Email     string `json:"email" validate:"required,email"`
+	Email     string `json:"email" validate:"required,mailbox"`
 	Signature string `json:"signature" validate:"required"`
 }
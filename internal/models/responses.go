@@ -4,6 +4,14 @@ type StatusResponse struct {
 	Status string `json:"status"`
 }
 
+// RegistrationStatusResponse is the outcome of /register together with the
+// report of the verification email, when one arrived.
+type RegistrationStatusResponse struct {
+	Status       string              `json:"status"`
+	Error        string              `json:"error,omitempty"`
+	Verification *VerificationReport `json:"verification,omitempty"`
+}
+
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
@@ -23,3 +31,22 @@ type VerifyResponse struct {
 type LoginInitResponse struct {
 	Nonce string `json:"nonce"`
 }
+
+type WebhookKeyResponse struct {
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"public_key"`
+}
+
+// InboundResponse is the outcome of a message posted to /inbound/{provider}.
+type InboundResponse struct {
+	Status     string             `json:"status"`
+	Error      string             `json:"error,omitempty"`
+	Recipients []InboundRecipient `json:"recipients,omitempty"`
+}
+
+// InboundRecipient is the delivery status of one recipient of an inbound message.
+type InboundRecipient struct {
+	Address string `json:"address"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
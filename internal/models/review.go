@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Review states.
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewDenied   = "denied"
+)
+
+// Review is a registration held for an administrator because its
+// verification email only soft-failed authentication. It carries everything
+// needed to create the account on approval.
+type Review struct {
+	Nonce     string              `json:"nonce"`
+	Email     string              `json:"email"`
+	Username  string              `json:"username"`
+	PublicKey string              `json:"public_key"`
+	Report    *VerificationReport `json:"report,omitempty"`
+	Status    string              `json:"status"`
+	CreatedAt time.Time           `json:"created_at"`
+	// Set once an administrator has decided
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+	DecidedBy string     `json:"decided_by,omitempty"`
+	Note      string     `json:"note,omitempty"`
+}
+
+// AuditEntry records one administrative action.
+type AuditEntry struct {
+	ID      int64     `json:"id"`
+	At      time.Time `json:"at"`
+	Actor   string    `json:"actor"`
+	Action  string    `json:"action"`
+	Subject string    `json:"subject"`
+	Note    string    `json:"note,omitempty"`
+}
+
+// ReviewDecisionRequest is the body of POST /admin/reviews/{nonce}/approve
+// and /deny. Actor is unauthenticated and only prefixes the audit note.
+type ReviewDecisionRequest struct {
+	Actor string `json:"actor"`
+	Note  string `json:"note"`
+}
@@ -4,4 +4,9 @@ type User struct {
 	Email     string `json:"email"`
 	Username  string `json:"username"`
 	PublicKey string `json:"public_key"`
+	// VerificationReport is how the signup's verification email was judged.
+	VerificationReport *VerificationReport `json:"verification_report,omitempty"`
+	// Assurance is the level the verification reached; empty for accounts
+	// created before levels were recorded.
+	Assurance string `json:"assurance,omitempty"`
 }
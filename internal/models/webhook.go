@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// OutboxEvent is an account lifecycle event persisted in the webhook outbox.
+type OutboxEvent struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Payload   string    `json:"payload"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery tracks delivery of one outbox event to one endpoint.
+type WebhookDelivery struct {
+	ID            int64     `json:"id"`
+	EventID       string    `json:"event_id"`
+	EventType     string    `json:"event_type"`
+	Endpoint      string    `json:"endpoint"`
+	Payload       string    `json:"payload"`
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	LastError     string    `json:"last_error"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
@@ -0,0 +1,117 @@
+// Package nonce generates and parses registration nonces.
+//
+// A nonce is 128 random bits in Crockford base32 (26 symbols) followed by one
+// Luhn mod 32 check symbol, 27 characters in total. That keeps "verify+<nonce>"
+// well inside the 64-octet RFC 5321 local-part limit and fits a DNS label.
+// Decoding is case-insensitive, ignores hyphens and maps the commonly confused
+// I, L and O to 1, 1 and 0. The canonical form is lower case.
+package nonce
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	alphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+	// Length is the size of an encoded nonce including the check symbol.
+	Length = 27
+	// legacyHexLength is the size of the 32-byte hex nonces issued before.
+	legacyHexLength = 64
+)
+
+var (
+	ErrInvalid  = errors.New("nonce: invalid encoding")
+	ErrChecksum = errors.New("nonce: check symbol mismatch")
+)
+
+// Generate returns a new random nonce in canonical form.
+func Generate() (string, error) {
+	var raw [16]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return "", fmt.Errorf("crypto/rand failed: %w", err)
+	}
+	body := encode(raw[:])
+	return body + string(alphabet[checkSymbol(body)]), nil
+}
+
+// Normalize validates s and returns its canonical form, so that rewritten
+// case or a stray hyphen still maps to the same stored nonce. Legacy 64-char
+// hex nonces are returned lower-cased when acceptHex is set.
+func Normalize(s string, acceptHex bool) (string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == legacyHexLength && isHex(s) {
+		if !acceptHex {
+			return "", ErrInvalid
+		}
+		return strings.ToLower(s), nil
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		switch r {
+		case '-':
+			continue
+		case 'i', 'l':
+			r = '1'
+		case 'o':
+			r = '0'
+		}
+		if !strings.ContainsRune(alphabet, r) {
+			return "", ErrInvalid
+		}
+		b.WriteRune(r)
+	}
+	canon := b.String()
+	if len(canon) != Length {
+		return "", ErrInvalid
+	}
+	if checkSymbol(canon[:Length-1]) != strings.IndexByte(alphabet, canon[Length-1]) {
+		return "", ErrChecksum
+	}
+	return canon, nil
+}
+
+// encode writes data as base32 without padding, most significant bits first.
+func encode(data []byte) string {
+	var b strings.Builder
+	var acc uint32
+	bits := 0
+	// 128 bits do not divide into 5-bit symbols; the leading symbol takes the remainder
+	if rem := (len(data) * 8) % 5; rem != 0 {
+		bits = 5 - rem
+	}
+	for _, c := range data {
+		acc = acc<<8 | uint32(c)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			b.WriteByte(alphabet[(acc>>bits)&31])
+		}
+	}
+	return b.String()
+}
+
+// checkSymbol computes the Luhn mod N check value for base32 symbols, which
+// catches every single-symbol error and most adjacent transpositions.
+func checkSymbol(body string) int {
+	const n = len(alphabet)
+	factor, sum := 2, 0
+	for i := len(body) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(alphabet, body[i])
+		factor = 3 - factor
+		sum += addend/n + addend%n
+	}
+	return (n - sum%n) % n
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package resolver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+type cacheKey struct {
+	name  string
+	qtype uint16
+}
+
+func (k cacheKey) String() string {
+	return k.name + "/" + dns.TypeToString[k.qtype]
+}
+
+type cacheEntry struct {
+	rrs      []dns.RR
+	notFound bool
+	expires  time.Time
+}
+
+// cache holds answers until their TTL runs out. When full, expired entries
+// are swept first and then arbitrary ones evicted; lookups are cheap to redo.
+type cache struct {
+	mu      sync.Mutex
+	entries map[cacheKey]cacheEntry
+	size    int
+	maxTTL  time.Duration
+	now     func() time.Time
+}
+
+func newCache(size int, maxTTL time.Duration) *cache {
+	return &cache{
+		entries: make(map[cacheKey]cacheEntry),
+		size:    size,
+		maxTTL:  maxTTL,
+		now:     time.Now,
+	}
+}
+
+func (c *cache) get(k cacheKey) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[k]
+	if !ok {
+		return cacheEntry{}, false
+	}
+	if !c.now().Before(e.expires) {
+		delete(c.entries, k)
+		return cacheEntry{}, false
+	}
+	return e, true
+}
+
+func (c *cache) put(k cacheKey, rrs []dns.RR, ttl time.Duration) {
+	c.store(k, cacheEntry{rrs: rrs}, ttl)
+}
+
+func (c *cache) putNotFound(k cacheKey, ttl time.Duration) {
+	c.store(k, cacheEntry{notFound: true}, ttl)
+}
+
+func (c *cache) store(k cacheKey, e cacheEntry, ttl time.Duration) {
+	if c.size <= 0 || ttl <= 0 {
+		return
+	}
+	if ttl > c.maxTTL {
+		ttl = c.maxTTL
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[k]; !exists && len(c.entries) >= c.size {
+		now := c.now()
+		for key, old := range c.entries {
+			if !now.Before(old.expires) {
+				delete(c.entries, key)
+			}
+		}
+		for key := range c.entries {
+			if len(c.entries) < c.size {
+				break
+			}
+			delete(c.entries, key)
+		}
+	}
+	e.expires = c.now().Add(ttl)
+	c.entries[k] = e
+}
@@ -0,0 +1,317 @@
+// Package resolver is the DNS client behind every zinc lookup (SPF, DKIM,
+// DMARC, ARC). It queries configurable upstreams with a per-query timeout and
+// caches answers for their record TTL, so a burst of mail from one domain
+// costs one round trip instead of one per message.
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/config"
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	"github.com/miekg/dns"
+	"golang.org/x/sync/singleflight"
+)
+
+// Resolver is the lookup interface zinc code depends on. Its method set
+// matches blitiri.com.ar/go/spf.DNSResolver so it plugs into SPF directly.
+// Errors are *net.DNSError with IsNotFound, IsTimeout and IsTemporary set
+// the way the standard library sets them.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// Client is the caching Resolver backed by miekg/dns.
+type Client struct {
+	upstreams   []string
+	timeout     time.Duration
+	negativeTTL time.Duration
+	cache       *cache
+	group       singleflight.Group
+}
+
+// Option configures the Client.
+type Option func(*options)
+
+type options struct {
+	upstreams   []string
+	timeout     time.Duration
+	cacheSize   int
+	maxTTL      time.Duration
+	negativeTTL time.Duration
+}
+
+// WithUpstream sets the recursive resolvers to query, tried in order.
+func WithUpstream(addrs ...string) Option { return func(o *options) { o.upstreams = addrs } }
+
+// WithTimeout sets the per-query timeout.
+func WithTimeout(d time.Duration) Option { return func(o *options) { o.timeout = d } }
+
+// WithCacheSize sets the maximum number of cached answers; zero disables caching.
+func WithCacheSize(n int) Option { return func(o *options) { o.cacheSize = n } }
+
+// WithMaxTTL caps how long any answer is cached.
+func WithMaxTTL(d time.Duration) Option { return func(o *options) { o.maxTTL = d } }
+
+// WithNegativeTTL sets the cache time for NXDOMAIN/NODATA answers without an SOA.
+func WithNegativeTTL(d time.Duration) Option { return func(o *options) { o.negativeTTL = d } }
+
+// New constructs a Client with the given options (or defaults from config).
+func New(opts ...Option) *Client {
+	o := &options{
+		upstreams:   config.DNSUpstream(),
+		timeout:     config.DNSTimeout(),
+		cacheSize:   config.DNSCacheSize(),
+		maxTTL:      config.DNSCacheMaxTTL(),
+		negativeTTL: config.DNSNegativeTTL(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if len(o.upstreams) == 0 {
+		o.upstreams = systemUpstreams()
+	}
+	for i, addr := range o.upstreams {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			o.upstreams[i] = net.JoinHostPort(strings.Trim(addr, "[]"), "53")
+		}
+	}
+	return &Client{
+		upstreams:   o.upstreams,
+		timeout:     o.timeout,
+		negativeTTL: o.negativeTTL,
+		cache:       newCache(o.cacheSize, o.maxTTL),
+	}
+}
+
+func systemUpstreams() []string {
+	conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+	if err != nil || len(conf.Servers) == 0 {
+		logging.WarnLog("resolver: no usable /etc/resolv.conf, falling back to 127.0.0.1:53")
+		return []string{"127.0.0.1:53"}
+	}
+	out := make([]string, 0, len(conf.Servers))
+	for _, s := range conf.Servers {
+		out = append(out, net.JoinHostPort(s, conf.Port))
+	}
+	return out
+}
+
+// LookupTXT returns the TXT records for name, one string per record with its
+// character-strings concatenated, as net.LookupTXT does.
+func (c *Client) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	rrs, err := c.query(ctx, name, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, rr := range rrs {
+		if txt, ok := rr.(*dns.TXT); ok {
+			out = append(out, strings.Join(txt.Txt, ""))
+		}
+	}
+	return out, nil
+}
+
+// LookupMX returns the MX records for name sorted by preference.
+func (c *Client) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	rrs, err := c.query(ctx, name, dns.TypeMX)
+	if err != nil {
+		return nil, err
+	}
+	var out []*net.MX
+	for _, rr := range rrs {
+		if mx, ok := rr.(*dns.MX); ok {
+			out = append(out, &net.MX{Host: mx.Mx, Pref: mx.Preference})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Pref < out[j].Pref })
+	return out, nil
+}
+
+// LookupIPAddr returns the A and AAAA addresses of host.
+func (c *Client) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IPAddr{{IP: ip}}, nil
+	}
+	var (
+		out     []net.IPAddr
+		lastErr error
+	)
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		rrs, err := c.query(ctx, host, qtype)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, rr := range rrs {
+			switch v := rr.(type) {
+			case *dns.A:
+				out = append(out, net.IPAddr{IP: v.A})
+			case *dns.AAAA:
+				out = append(out, net.IPAddr{IP: v.AAAA})
+			}
+		}
+	}
+	if len(out) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return out, nil
+}
+
+// LookupAddr returns the PTR names for addr.
+func (c *Client) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	arpa, err := dns.ReverseAddr(addr)
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: addr}
+	}
+	rrs, err := c.query(ctx, arpa, dns.TypePTR)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, rr := range rrs {
+		if ptr, ok := rr.(*dns.PTR); ok {
+			out = append(out, ptr.Ptr)
+		}
+	}
+	return out, nil
+}
+
+// query returns the answer records of qtype for name, from cache when fresh.
+// Concurrent misses for the same question share one upstream query.
+func (c *Client) query(ctx context.Context, name string, qtype uint16) ([]dns.RR, error) {
+	fqdn := dns.Fqdn(strings.ToLower(name))
+	key := cacheKey{name: fqdn, qtype: qtype}
+	if e, ok := c.cache.get(key); ok {
+		if e.notFound {
+			return nil, notFoundError(name)
+		}
+		return e.rrs, nil
+	}
+
+	v, err, _ := c.group.Do(key.String(), func() (any, error) {
+		return c.exchange(ctx, fqdn, qtype)
+	})
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return nil, notFoundError(name)
+		}
+		return nil, err
+	}
+	return v.([]dns.RR), nil
+}
+
+// exchange queries each upstream in turn until one answers authoritatively
+// (NOERROR or NXDOMAIN), retrying over TCP when a UDP answer is truncated.
+func (c *Client) exchange(ctx context.Context, fqdn string, qtype uint16) ([]dns.RR, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(fqdn, qtype)
+	m.SetEdns0(4096, false)
+	key := cacheKey{name: fqdn, qtype: qtype}
+
+	var lastErr error
+	for _, upstream := range c.upstreams {
+		resp, err := c.exchangeOne(ctx, m, upstream)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		switch resp.Rcode {
+		case dns.RcodeSuccess:
+			rrs := filterAnswers(resp.Answer, qtype)
+			if len(rrs) == 0 {
+				c.cache.putNotFound(key, negativeTTL(resp, c.negativeTTL))
+				return nil, notFoundError(fqdn)
+			}
+			c.cache.put(key, rrs, minTTL(rrs))
+			return rrs, nil
+		case dns.RcodeNameError:
+			c.cache.putNotFound(key, negativeTTL(resp, c.negativeTTL))
+			return nil, notFoundError(fqdn)
+		default:
+			lastErr = &net.DNSError{
+				Err:         fmt.Sprintf("server misbehaving: %s", dns.RcodeToString[resp.Rcode]),
+				Name:        fqdn,
+				Server:      upstream,
+				IsTemporary: true,
+			}
+		}
+	}
+	if lastErr == nil {
+		lastErr = &net.DNSError{Err: "no upstream resolvers configured", Name: fqdn, IsTemporary: true}
+	}
+	logging.DebugLog("resolver: query %s %s failed: %v", fqdn, dns.TypeToString[qtype], lastErr)
+	return nil, lastErr
+}
+
+func (c *Client) exchangeOne(ctx context.Context, m *dns.Msg, upstream string) (*dns.Msg, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	client := &dns.Client{Net: "udp", Timeout: c.timeout}
+	resp, _, err := client.ExchangeContext(ctx, m, upstream)
+	if err == nil && resp.Truncated {
+		client.Net = "tcp"
+		resp, _, err = client.ExchangeContext(ctx, m, upstream)
+	}
+	if err != nil {
+		var netErr net.Error
+		timeout := errors.As(err, &netErr) && netErr.Timeout() || errors.Is(err, context.DeadlineExceeded)
+		return nil, &net.DNSError{
+			Err:         err.Error(),
+			Name:        m.Question[0].Name,
+			Server:      upstream,
+			IsTimeout:   timeout,
+			IsTemporary: true,
+		}
+	}
+	return resp, nil
+}
+
+// filterAnswers drops records of other types, such as the CNAMEs a recursive
+// resolver includes when following an alias.
+func filterAnswers(answer []dns.RR, qtype uint16) []dns.RR {
+	var out []dns.RR
+	for _, rr := range answer {
+		if rr.Header().Rrtype == qtype {
+			out = append(out, rr)
+		}
+	}
+	return out
+}
+
+func minTTL(rrs []dns.RR) time.Duration {
+	ttl := rrs[0].Header().Ttl
+	for _, rr := range rrs[1:] {
+		if rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+// negativeTTL follows RFC 2308: the lesser of the SOA TTL and its MINIMUM field.
+func negativeTTL(resp *dns.Msg, fallback time.Duration) time.Duration {
+	for _, rr := range resp.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return time.Duration(min(soa.Hdr.Ttl, soa.Minttl)) * time.Second
+		}
+	}
+	return fallback
+}
+
+func notFoundError(name string) error {
+	return &net.DNSError{Err: "no such host", Name: strings.TrimSuffix(name, "."), IsNotFound: true}
+}
@@ -0,0 +1,80 @@
+// Package review decides registrations held for an administrator because
+// their verification email only soft-failed authentication.
+package review
+
+import (
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/utils"
+	"github.com/Goofygiraffe06/zinc/internal/webhook"
+	"github.com/Goofygiraffe06/zinc/store"
+)
+
+// Approve creates the account held under nonce and returns the decided
+// review. The account, its user.registered event and the audit entry commit
+// together.
+func Approve(s *store.SQLiteStore, nonce, actor, note string) (models.Review, error) {
+	r, err := pending(s, nonce)
+	if err != nil {
+		return models.Review{}, err
+	}
+
+	var report *models.VerificationReport
+	if r.Report != nil {
+		accepted := *r.Report
+		accepted.Decision, accepted.Reason = models.DecisionAccepted, "approved after review: "+r.Report.Reason
+		report = &accepted
+	}
+	user := models.User{
+		Email:              r.Email,
+		Username:           r.Username,
+		PublicKey:          r.PublicKey,
+		VerificationReport: report,
+	}
+	if report != nil {
+		user.Assurance = report.Assurance
+	}
+	events, err := webhook.UserEvents(webhook.EventUserRegistered, user)
+	if err != nil {
+		return models.Review{}, err
+	}
+	if err := s.DecideReview(nonce, models.ReviewApproved, actor, note, time.Now(), &user, events...); err != nil {
+		return models.Review{}, err
+	}
+	logging.InfoLog("Review approved by %s [%s] nonce=[%s]", actor, utils.HashEmail(r.Email), utils.HashEmail(nonce))
+	return decided(s, nonce)
+}
+
+// Deny refuses the registration held under nonce and returns the decided review.
+func Deny(s *store.SQLiteStore, nonce, actor, note string) (models.Review, error) {
+	r, err := pending(s, nonce)
+	if err != nil {
+		return models.Review{}, err
+	}
+	if err := s.DecideReview(nonce, models.ReviewDenied, actor, note, time.Now(), nil); err != nil {
+		return models.Review{}, err
+	}
+	logging.InfoLog("Review denied by %s [%s] nonce=[%s]", actor, utils.HashEmail(r.Email), utils.HashEmail(nonce))
+	return decided(s, nonce)
+}
+
+func pending(s *store.SQLiteStore, nonce string) (models.Review, error) {
+	r, ok, err := s.GetReview(nonce)
+	if err != nil {
+		return models.Review{}, err
+	}
+	if !ok {
+		return models.Review{}, store.ErrReviewNotFound
+	}
+	if r.Status != models.ReviewPending {
+		return models.Review{}, store.ErrReviewDecided
+	}
+	return r, nil
+}
+
+func decided(s *store.SQLiteStore, nonce string) (models.Review, error) {
+	r, _, err := s.GetReview(nonce)
+	return r, err
+}
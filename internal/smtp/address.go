@@ -0,0 +1,180 @@
+package smtpserver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/Goofygiraffe06/zinc/internal/config"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+)
+
+// addressMode identifies which verification address form a recipient used.
+type addressMode int
+
+const (
+	// addressSubaddress is prefix<sep>nonce@domain.
+	addressSubaddress addressMode = iota
+	// addressMailbox is prefix@domain with the nonce in the Subject or body.
+	addressMailbox
+	// addressSubdomain is prefix@nonce.domain.
+	addressSubdomain
+)
+
+func (m addressMode) String() string {
+	switch m {
+	case addressSubaddress:
+		return "subaddress"
+	case addressMailbox:
+		return "mailbox"
+	case addressSubdomain:
+		return "subdomain"
+	default:
+		return "unknown"
+	}
+}
+
+// nonceToken matches candidate registration nonces in free text: the base32
+// form or a legacy hex nonce. Candidates are confirmed by nonce.Normalize.
+var nonceToken = regexp.MustCompile(`\b(?:[0-9A-Za-z]{27}|[0-9a-fA-F]{64})\b`)
+
+// maxTokenScanBytes bounds how much decoded body text is searched for a nonce.
+const maxTokenScanBytes = 64 << 10
+
+// verifyRecipient is an accepted RCPT and the raw nonce token it carries, if
+// any. Mailbox-mode recipients have an empty token until Data extracts it.
+type verifyRecipient struct {
+	addr  string
+	mode  addressMode
+	token string
+}
+
+// addressing recognizes verification recipients for the enabled modes.
+type addressing struct {
+	domain     string
+	prefix     string
+	separators string
+	subaddress bool
+	mailbox    bool
+	subdomain  bool
+}
+
+func newAddressing(domain, prefix, separators string, modes []string) addressing {
+	a := addressing{domain: asciiDomain(domain), prefix: strings.ToLower(prefix), separators: separators}
+	for _, m := range modes {
+		switch m {
+		case "subaddress":
+			a.subaddress = true
+		case "mailbox":
+			a.mailbox = true
+		case "subdomain":
+			a.subdomain = true
+		}
+	}
+	return a
+}
+
+// match reports whether rcpt is a verification address and which form it uses.
+func (a addressing) match(rcpt string) (verifyRecipient, bool) {
+	local, dom := splitAddress(rcpt)
+	r := verifyRecipient{addr: rcpt}
+
+	if domainEquals(dom, a.domain) {
+		lower := strings.ToLower(local)
+		if a.mailbox && lower == a.prefix {
+			r.mode = addressMailbox
+			return r, true
+		}
+		if a.subaddress && len(lower) > len(a.prefix)+1 && strings.HasPrefix(lower, a.prefix) &&
+			strings.ContainsRune(a.separators, rune(local[len(a.prefix)])) {
+			r.mode, r.token = addressSubaddress, strings.TrimSpace(local[len(a.prefix)+1:])
+			return r, r.token != ""
+		}
+		return r, false
+	}
+
+	// prefix@<nonce>.<domain>; DNS labels are case-insensitive so the nonce is too
+	if a.subdomain && strings.EqualFold(local, a.prefix) {
+		dom = strings.TrimSuffix(strings.TrimSpace(dom), ".")
+		suffix := "." + strings.ToLower(a.domain)
+		if label, ok := strings.CutSuffix(strings.ToLower(dom), suffix); ok && label != "" && !strings.Contains(label, ".") {
+			r.mode, r.token = addressSubdomain, label
+			return r, true
+		}
+	}
+	return r, false
+}
+
+// bareAddress is the verification address with no token, which every form
+// resolves to.
+func (a addressing) bareAddress() string {
+	return a.prefix + "@" + a.domain
+}
+
+// extractNonceToken finds the nonce for a mailbox-mode message, preferring the
+// Subject and falling back to the first text part of the body. Only the first
+// match is used so one message cannot probe several pending registrations.
+func extractNonceToken(messageData []byte) string {
+	msg, err := mail.ReadMessage(bytes.NewReader(messageData))
+	if err != nil {
+		return ""
+	}
+	dec := new(mime.WordDecoder)
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	if tok := firstNonce(subject); tok != "" {
+		return tok
+	}
+	return firstNonce(bodyText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body, 0))
+}
+
+// firstNonce returns the first candidate in text with a valid encoding and check symbol.
+func firstNonce(text string) string {
+	for _, tok := range nonceToken.FindAllString(text, 10) {
+		if _, err := nonce.Normalize(tok, config.NonceAcceptLegacyHex()); err == nil {
+			return tok
+		}
+	}
+	return ""
+}
+
+// bodyText decodes the first text/* part of an entity, descending into multiparts.
+func bodyText(contentType, encoding string, body io.Reader, depth int) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") && depth < 5 {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err != nil {
+				return ""
+			}
+			text := bodyText(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part, depth+1)
+			if text != "" {
+				return text
+			}
+		}
+	}
+	if !strings.HasPrefix(mediaType, "text/") {
+		return ""
+	}
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, _ := io.ReadAll(io.LimitReader(body, maxTokenScanBytes))
+	return string(data)
+}
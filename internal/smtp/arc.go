@@ -0,0 +1,435 @@
+package smtpserver
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	"github.com/emersion/go-msgauth/authres"
+)
+
+// ARCResult represents the chain validation status (cv=) of an ARC chain.
+type ARCResult int
+
+const (
+	ARCNone ARCResult = iota
+	ARCPass
+	ARCFail
+)
+
+func (r ARCResult) String() string {
+	switch r {
+	case ARCNone:
+		return "none"
+	case ARCPass:
+		return "pass"
+	case ARCFail:
+		return "fail"
+	default:
+		return "unknown"
+	}
+}
+
+// maxARCInstances is the RFC 8617 upper bound on i=.
+const maxARCInstances = 50
+
+// minRSAKeyBits is the smallest RSA key whose signatures are accepted
+// (RFC 8301 section 3.2).
+const minRSAKeyBits = 1024
+
+// ARCEvaluation is the outcome of validating an ARC chain.
+type ARCEvaluation struct {
+	Result ARCResult
+	// Instances is the number of ARC sets on the message.
+	Instances int
+	// Sealer is the d= of the most recent ARC-Seal.
+	Sealer string
+	// Trusted is set when the chain passed and Sealer is a configured trusted sealer.
+	Trusted bool
+	// Upstream holds the results the most recent sealer recorded in its
+	// ARC-Authentication-Results. Only meaningful when Trusted.
+	Upstream UpstreamResults
+	// Reason explains a failed chain for logging.
+	Reason string
+}
+
+// UpstreamResults are authentication results asserted by another server.
+type UpstreamResults struct {
+	SPF        SPFResult
+	SPFDomain  string
+	DKIM       DKIMResult
+	DKIMDomain []string
+	DMARC      DMARCResult
+}
+
+type arcSet struct {
+	aar, ams, seal rawField
+}
+
+// CheckARC validates the ARC chain of a message (RFC 8617 section 5.2) and,
+// when the latest sealer is in trustedSealers, returns the results it recorded.
+func (d *DKIMChecker) CheckARC(ctx context.Context, messageData []byte, trustedSealers []string) ARCEvaluation {
+	fields, body := splitMessage(messageData)
+
+	sets, err := collectARCSets(fields)
+	if err != nil {
+		logging.DebugLog("ARC check: malformed chain: %v", err)
+		return ARCEvaluation{Result: ARCFail, Reason: err.Error()}
+	}
+	if len(sets) == 0 {
+		return ARCEvaluation{Result: ARCNone}
+	}
+
+	n := len(sets)
+	latest := parseTagList(sets[n-1].seal.value())
+	eval := ARCEvaluation{Result: ARCFail, Instances: n, Sealer: strings.ToLower(latest["d"])}
+
+	if err := validateARCStructure(sets); err != nil {
+		eval.Reason = err.Error()
+		logging.DebugLog("ARC check: invalid chain: %v", err)
+		return eval
+	}
+	// Only the most recent message signature has to verify; older ones were
+	// expected to break when intermediaries modified the message.
+	if err := d.verifyARCMessageSignature(ctx, fields, body, sets[n-1].ams); err != nil {
+		eval.Reason = fmt.Sprintf("ams i=%d: %v", n, err)
+		logging.DebugLog("ARC check: %s", eval.Reason)
+		return eval
+	}
+	for i := n; i >= 1; i-- {
+		if err := d.verifyARCSeal(ctx, sets[:i]); err != nil {
+			eval.Reason = fmt.Sprintf("seal i=%d: %v", i, err)
+			logging.DebugLog("ARC check: %s", eval.Reason)
+			return eval
+		}
+	}
+
+	eval.Result = ARCPass
+	for _, s := range trustedSealers {
+		if strings.EqualFold(strings.TrimSuffix(s, "."), eval.Sealer) {
+			eval.Trusted = true
+			break
+		}
+	}
+	if eval.Trusted {
+		eval.Upstream = parseUpstreamResults(sets[n-1].aar.value())
+	}
+
+	logging.DebugLog("ARC check result=%s instances=%d sealer=%s trusted=%t",
+		eval.Result.String(), n, eval.Sealer, eval.Trusted)
+	return eval
+}
+
+func collectARCSets(fields []rawField) ([]arcSet, error) {
+	byInstance := make(map[int]*arcSet)
+	max := 0
+	for _, f := range fields {
+		var slot *rawField
+		name := f.name()
+		switch name {
+		case "arc-authentication-results", "arc-message-signature", "arc-seal":
+		default:
+			continue
+		}
+
+		i, err := arcInstance(f)
+		if err != nil {
+			return nil, err
+		}
+		set := byInstance[i]
+		if set == nil {
+			set = &arcSet{}
+			byInstance[i] = set
+		}
+		switch name {
+		case "arc-authentication-results":
+			slot = &set.aar
+		case "arc-message-signature":
+			slot = &set.ams
+		case "arc-seal":
+			slot = &set.seal
+		}
+		if *slot != "" {
+			return nil, fmt.Errorf("duplicate %s for i=%d", name, i)
+		}
+		*slot = f
+		if i > max {
+			max = i
+		}
+	}
+
+	sets := make([]arcSet, 0, max)
+	for i := 1; i <= max; i++ {
+		set := byInstance[i]
+		if set == nil || set.aar == "" || set.ams == "" || set.seal == "" {
+			return nil, fmt.Errorf("incomplete ARC set i=%d", i)
+		}
+		sets = append(sets, *set)
+	}
+	return sets, nil
+}
+
+// arcInstance reads i= from an ARC header. The AAR value is not a tag list,
+// but it must begin with "i=N;".
+func arcInstance(f rawField) (int, error) {
+	var v string
+	if f.name() == "arc-authentication-results" {
+		first, _, _ := strings.Cut(f.value(), ";")
+		if k, val, ok := strings.Cut(first, "="); ok && strings.TrimSpace(k) == "i" {
+			v = val
+		}
+	} else {
+		v = parseTagList(f.value())["i"]
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || i < 1 || i > maxARCInstances {
+		return 0, fmt.Errorf("%s has invalid instance %q", f.name(), v)
+	}
+	return i, nil
+}
+
+func validateARCStructure(sets []arcSet) error {
+	for idx, set := range sets {
+		cv := strings.ToLower(parseTagList(set.seal.value())["cv"])
+		switch {
+		case cv == "fail":
+			return fmt.Errorf("sealer recorded cv=fail at i=%d", idx+1)
+		case idx == 0 && cv != "none":
+			return fmt.Errorf("first seal must have cv=none, got %q", cv)
+		case idx > 0 && cv != "pass":
+			return fmt.Errorf("seal i=%d must have cv=pass, got %q", idx+1, cv)
+		}
+	}
+	return nil
+}
+
+func (d *DKIMChecker) verifyARCMessageSignature(ctx context.Context, fields []rawField, body []byte, ams rawField) error {
+	tags := parseTagList(ams.value())
+	for _, t := range []string{"a", "b", "bh", "d", "h", "s"} {
+		if tags[t] == "" {
+			return fmt.Errorf("missing %s= tag", t)
+		}
+	}
+
+	headerCanon, bodyCanon, _ := strings.Cut(strings.ToLower(tags["c"]), "/")
+	relaxedHeader := headerCanon == "relaxed"
+	relaxedBody := bodyCanon == "relaxed"
+
+	canonBody := canonicalizeBody(body, relaxedBody)
+	if l, ok := tags["l"]; ok {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 || n > len(canonBody) {
+			return errors.New("invalid l= tag")
+		}
+		canonBody = canonBody[:n]
+	}
+	bodyHash := sha256.Sum256(canonBody)
+	if base64.StdEncoding.EncodeToString(bodyHash[:]) != stripWhitespace(tags["bh"]) {
+		return errors.New("body hash mismatch")
+	}
+
+	h := sha256.New()
+	for _, f := range selectSignedHeaders(fields, strings.Split(tags["h"], ":")) {
+		h.Write([]byte(canonicalizeHeader(f, relaxedHeader)))
+	}
+	h.Write([]byte(strings.TrimSuffix(canonicalizeHeader(removeSignatureValue(ams), relaxedHeader), "\r\n")))
+
+	return d.verifyARCSignature(ctx, tags, h.Sum(nil))
+}
+
+// verifyARCSeal checks the seal of the last set in sets, which covers every
+// set up to and including its own (RFC 8617 section 5.1.1).
+func (d *DKIMChecker) verifyARCSeal(ctx context.Context, sets []arcSet) error {
+	last := sets[len(sets)-1].seal
+	tags := parseTagList(last.value())
+	for _, t := range []string{"a", "b", "d", "s"} {
+		if tags[t] == "" {
+			return fmt.Errorf("missing %s= tag", t)
+		}
+	}
+
+	h := sha256.New()
+	for idx, set := range sets {
+		h.Write([]byte(canonicalizeHeader(set.aar, true)))
+		h.Write([]byte(canonicalizeHeader(set.ams, true)))
+		if idx == len(sets)-1 {
+			h.Write([]byte(strings.TrimSuffix(canonicalizeHeader(removeSignatureValue(set.seal), true), "\r\n")))
+		} else {
+			h.Write([]byte(canonicalizeHeader(set.seal, true)))
+		}
+	}
+	return d.verifyARCSignature(ctx, tags, h.Sum(nil))
+}
+
+func (d *DKIMChecker) verifyARCSignature(ctx context.Context, tags map[string]string, digest []byte) error {
+	sig, err := base64.StdEncoding.DecodeString(stripWhitespace(tags["b"]))
+	if err != nil {
+		return errors.New("invalid b= tag")
+	}
+	pub, err := d.lookupKey(ctx, tags["s"], tags["d"])
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(tags["a"]) {
+	case "rsa-sha256":
+		key, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("key type does not match a=rsa-sha256")
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig); err != nil {
+			return errors.New("signature mismatch")
+		}
+	case "ed25519-sha256":
+		key, ok := pub.(ed25519.PublicKey)
+		if !ok {
+			return errors.New("key type does not match a=ed25519-sha256")
+		}
+		if !ed25519.Verify(key, digest, sig) {
+			return errors.New("signature mismatch")
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %q", tags["a"])
+	}
+	return nil
+}
+
+// lookupKey fetches and parses the DKIM key record <selector>._domainkey.<domain>.
+func (d *DKIMChecker) lookupKey(ctx context.Context, selector, domain string) (crypto.PublicKey, error) {
+	txts, err := d.resolver.LookupTXT(ctx, selector+"._domainkey."+domain)
+	if err != nil {
+		return nil, fmt.Errorf("key lookup: %w", err)
+	}
+
+	tags := parseTagList(strings.Join(txts, ""))
+	p := stripWhitespace(tags["p"])
+	if p == "" {
+		return nil, errors.New("key revoked or missing")
+	}
+	raw, err := base64.StdEncoding.DecodeString(p)
+	if err != nil {
+		return nil, errors.New("invalid key encoding")
+	}
+
+	switch strings.ToLower(tags["k"]) {
+	case "", "rsa":
+		var rsaPub *rsa.PublicKey
+		if pub, err := x509.ParsePKIXPublicKey(raw); err == nil {
+			var ok bool
+			if rsaPub, ok = pub.(*rsa.PublicKey); !ok {
+				return nil, errors.New("key is not RSA")
+			}
+		} else if rsaPub, err = x509.ParsePKCS1PublicKey(raw); err != nil {
+			return nil, errors.New("invalid RSA key")
+		}
+		if rsaPub.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key too short (%d bits)", rsaPub.N.BitLen())
+		}
+		return rsaPub, nil
+	case "ed25519":
+		if len(raw) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(raw), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", tags["k"])
+	}
+}
+
+// parseUpstreamResults maps an ARC-Authentication-Results value
+// ("i=N; authserv-id; spf=pass ...") onto zinc's result types.
+func parseUpstreamResults(value string) UpstreamResults {
+	_, rest, ok := strings.Cut(value, ";")
+	if !ok {
+		return UpstreamResults{SPF: SPFNone, DKIM: DKIMNone, DMARC: DMARCNone}
+	}
+	_, results, err := authres.Parse(rest)
+	if err != nil {
+		logging.DebugLog("ARC upstream results parse error: %v", err)
+	}
+	return upstreamFromResults(results)
+}
+
+// upstreamFromResults maps parsed RFC 8601 results onto zinc's result types.
+func upstreamFromResults(results []authres.Result) UpstreamResults {
+	up := UpstreamResults{SPF: SPFNone, DKIM: DKIMNone, DMARC: DMARCNone}
+	for _, r := range results {
+		switch res := r.(type) {
+		case *authres.SPFResult:
+			up.SPF = spfResultFromAuthres(res.Value)
+			_, up.SPFDomain = splitAddress(res.From)
+			if up.SPFDomain == "" {
+				up.SPFDomain = res.From
+			}
+		case *authres.DKIMResult:
+			// Any passing upstream signature counts, as with local DKIM
+			if res.Value == authres.ResultPass {
+				up.DKIM = DKIMPass
+				up.DKIMDomain = append(up.DKIMDomain, res.Domain)
+			} else if up.DKIM != DKIMPass {
+				up.DKIM = dkimResultFromAuthres(res.Value)
+			}
+		case *authres.DMARCResult:
+			up.DMARC = dmarcResultFromAuthres(res.Value)
+		}
+	}
+	return up
+}
+
+func spfResultFromAuthres(v authres.ResultValue) SPFResult {
+	switch v {
+	case authres.ResultPass:
+		return SPFPass
+	case authres.ResultFail, authres.ResultHardFail:
+		return SPFFail
+	case authres.ResultSoftFail:
+		return SPFSoftFail
+	case authres.ResultNeutral:
+		return SPFNeutral
+	case authres.ResultTempError:
+		return SPFTempError
+	case authres.ResultPermError:
+		return SPFPermError
+	default:
+		return SPFNone
+	}
+}
+
+func dkimResultFromAuthres(v authres.ResultValue) DKIMResult {
+	switch v {
+	case authres.ResultPass:
+		return DKIMPass
+	case authres.ResultFail, authres.ResultPolicy, authres.ResultNeutral:
+		return DKIMFail
+	case authres.ResultTempError:
+		return DKIMTempError
+	case authres.ResultPermError:
+		return DKIMPermError
+	default:
+		return DKIMNone
+	}
+}
+
+func dmarcResultFromAuthres(v authres.ResultValue) DMARCResult {
+	switch v {
+	case authres.ResultPass:
+		return DMARCPass
+	case authres.ResultFail:
+		return DMARCFail
+	case authres.ResultTempError:
+		return DMARCTempError
+	case authres.ResultPermError:
+		return DMARCPermError
+	default:
+		return DMARCNone
+	}
+}
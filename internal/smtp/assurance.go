@@ -0,0 +1,29 @@
+package smtpserver
+
+import (
+	"strings"
+
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/emersion/go-msgauth/dmarc"
+)
+
+// assuranceLevel grades how much a report vouches for its sender. Only
+// passing checks count, so unrestricted mode, which skips them, yields
+// AssuranceLow.
+func assuranceLevel(r models.VerificationReport) string {
+	dmarcPass := r.DMARC.Result == "pass"
+	dkimPass := r.DKIM.Result == "pass"
+	if dmarcPass && dkimPass && r.TLS != "" && r.TLS != "none" {
+		_, fromDomain := splitAddress(r.HeaderFrom)
+		fromDomain = strings.ToLower(fromDomain)
+		for _, d := range r.DKIM.Domains {
+			if aligned(fromDomain, d, dmarc.AlignmentRelaxed) {
+				return models.AssuranceHigh
+			}
+		}
+	}
+	if dmarcPass || dkimPass || r.SPF.Result == "pass" {
+		return models.AssuranceMedium
+	}
+	return models.AssuranceLow
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 
 	"github.com/Goofygiraffe06/zinc/internal/logging"
+	"github.com/Goofygiraffe06/zinc/internal/resolver"
 	"github.com/emersion/go-msgauth/dkim"
 )
 
@@ -37,41 +38,50 @@ func (r DKIMResult) String() string {
 }
 
 // using the emersion/go-msgauth library.
-type DKIMChecker struct{}
+type DKIMChecker struct {
+	resolver resolver.Resolver
+}
 
-// NewDKIMChecker creates a new DKIM checker.
-func NewDKIMChecker() *DKIMChecker {
-	return &DKIMChecker{}
+// NewDKIMChecker creates a new DKIM checker that fetches keys through res.
+func NewDKIMChecker(res resolver.Resolver) *DKIMChecker {
+	return &DKIMChecker{resolver: res}
 }
 
 // CheckDKIM performs DKIM verification on the email message.
 // messageData should contain the full email including headers and body.
-func (d *DKIMChecker) CheckDKIM(ctx context.Context, messageData []byte) (DKIMResult, error) {
+// It also returns the signing domains (d=) of every valid signature, which
+// DMARC needs for identifier alignment.
+func (d *DKIMChecker) CheckDKIM(ctx context.Context, messageData []byte) (DKIMResult, []string, error) {
 	// Create a reader from the message data
 	r := bytes.NewReader(messageData)
 
 	// Verify DKIM signatures using the library
-	verifications, err := dkim.Verify(r)
+	verifications, err := dkim.VerifyWithOptions(r, &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			return d.resolver.LookupTXT(ctx, domain)
+		},
+	})
 	if err != nil {
 		logging.WarnLog("DKIM check error: %v", err)
-		return DKIMTempError, err
+		return DKIMTempError, nil, err
 	}
 
 	// Check if we have any verifications
 	if len(verifications) == 0 {
 		logging.DebugLog("DKIM check: no DKIM signatures found")
-		return DKIMNone, nil
+		return DKIMNone, nil, nil
 	}
 
 	// Check verification results - if at least one signature is valid, consider it passed
-	hasValidSignature := false
-	var lastErr error
+	var (
+		validDomains []string
+		lastErr      error
+	)
 
 	for _, verification := range verifications {
 		if verification.Err == nil {
-			hasValidSignature = true
+			validDomains = append(validDomains, verification.Domain)
 			logging.DebugLog("DKIM check: valid signature found for domain=%s", verification.Domain)
-			break
 		} else {
 			lastErr = verification.Err
 			logging.DebugLog("DKIM check: signature verification failed for domain=%s: %v",
@@ -79,17 +89,17 @@ func (d *DKIMChecker) CheckDKIM(ctx context.Context, messageData []byte) (DKIMRe
 		}
 	}
 
-	if hasValidSignature {
-		return DKIMPass, nil
+	if len(validDomains) > 0 {
+		return DKIMPass, validDomains, nil
 	}
 
 	// All signatures failed
 	if lastErr != nil {
 		logging.WarnLog("DKIM check: all signatures failed, last error: %v", lastErr)
-		return DKIMFail, lastErr
+		return DKIMFail, nil, lastErr
 	}
 
-	return DKIMFail, nil
+	return DKIMFail, nil, nil
 }
 
 // readMessageData reads the complete message data from an io.Reader.
@@ -0,0 +1,190 @@
+package smtpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	"github.com/Goofygiraffe06/zinc/internal/resolver"
+	"github.com/emersion/go-msgauth/dmarc"
+	"golang.org/x/net/publicsuffix"
+)
+
+// DMARCResult represents the outcome of a DMARC evaluation.
+type DMARCResult int
+
+const (
+	DMARCNone DMARCResult = iota
+	DMARCPass
+	DMARCFail
+	DMARCTempError
+	DMARCPermError
+)
+
+func (r DMARCResult) String() string {
+	switch r {
+	case DMARCNone:
+		return "none"
+	case DMARCPass:
+		return "pass"
+	case DMARCFail:
+		return "fail"
+	case DMARCTempError:
+		return "temperror"
+	case DMARCPermError:
+		return "permerror"
+	default:
+		return "unknown"
+	}
+}
+
+// DMARCEvaluation carries the result together with the policy that applies to it.
+type DMARCEvaluation struct {
+	Result DMARCResult
+	// Domain is the RFC 5322 From domain the policy was evaluated for.
+	Domain string
+	// Policy is the requested disposition ("none", "quarantine", "reject"),
+	// already resolved to the subdomain policy where applicable.
+	Policy      string
+	SPFAligned  bool
+	DKIMAligned bool
+}
+
+// Enforced reports whether the sender asked receivers to act on a failure.
+func (e DMARCEvaluation) Enforced() bool {
+	return e.Result == DMARCFail && (e.Policy == string(dmarc.PolicyReject) || e.Policy == string(dmarc.PolicyQuarantine))
+}
+
+// DMARCChecker evaluates DMARC (RFC 7489) for a message whose SPF and DKIM
+// outcomes are already known.
+type DMARCChecker struct {
+	resolver resolver.Resolver
+}
+
+// NewDMARCChecker creates a new DMARC checker that looks up policies through res.
+func NewDMARCChecker(res resolver.Resolver) *DMARCChecker {
+	return &DMARCChecker{resolver: res}
+}
+
+// CheckDMARC looks up the policy for fromDomain and checks whether a passing
+// SPF identity (spfDomain) or DKIM signature (dkimDomains) aligns with it.
+func (d *DMARCChecker) CheckDMARC(ctx context.Context, fromDomain string, spfResult SPFResult, spfDomain string, dkimDomains []string) (DMARCEvaluation, error) {
+	fromDomain = strings.ToLower(strings.TrimSuffix(fromDomain, "."))
+	eval := DMARCEvaluation{Result: DMARCNone, Domain: fromDomain, Policy: string(dmarc.PolicyNone)}
+	if fromDomain == "" {
+		return eval, nil
+	}
+
+	record, policy, err := d.lookupPolicy(ctx, fromDomain)
+	if err != nil {
+		if errors.Is(err, dmarc.ErrNoPolicy) {
+			logging.DebugLog("DMARC check: no policy for domain=%s", fromDomain)
+			return eval, nil
+		}
+		if dmarc.IsTempFail(err) {
+			eval.Result = DMARCTempError
+		} else {
+			eval.Result = DMARCPermError
+		}
+		logging.WarnLog("DMARC lookup error for domain=%s: %v", fromDomain, err)
+		return eval, err
+	}
+	eval.Policy = string(policy)
+
+	if spfResult == SPFPass {
+		eval.SPFAligned = aligned(fromDomain, spfDomain, record.SPFAlignment)
+	}
+	for _, dom := range dkimDomains {
+		if aligned(fromDomain, dom, record.DKIMAlignment) {
+			eval.DKIMAligned = true
+			break
+		}
+	}
+
+	if eval.SPFAligned || eval.DKIMAligned {
+		eval.Result = DMARCPass
+	} else {
+		eval.Result = DMARCFail
+	}
+
+	logging.DebugLog("DMARC check result=%s domain=%s policy=%s spf_aligned=%t dkim_aligned=%t",
+		eval.Result.String(), fromDomain, eval.Policy, eval.SPFAligned, eval.DKIMAligned)
+	return eval, nil
+}
+
+// lookupPolicy queries _dmarc.<domain>, falling back to the organizational
+// domain, whose sp= (or p=) then governs the subdomain.
+func (d *DMARCChecker) lookupPolicy(ctx context.Context, domain string) (*dmarc.Record, dmarc.Policy, error) {
+	opts := &dmarc.LookupOptions{LookupTXT: func(name string) ([]string, error) {
+		return d.resolver.LookupTXT(ctx, name)
+	}}
+
+	record, err := dmarc.LookupWithOptions(domain, opts)
+	if err == nil {
+		return record, record.Policy, nil
+	}
+	if !errors.Is(err, dmarc.ErrNoPolicy) {
+		return nil, "", err
+	}
+
+	org := organizationalDomain(domain)
+	if org == domain {
+		return nil, "", err
+	}
+	record, err = dmarc.LookupWithOptions(org, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	policy := record.Policy
+	if record.SubdomainPolicy != "" {
+		policy = record.SubdomainPolicy
+	}
+	return record, policy, nil
+}
+
+// aligned implements identifier alignment: strict requires an exact match,
+// relaxed only that both share an organizational domain.
+func aligned(fromDomain, authDomain string, mode dmarc.AlignmentMode) bool {
+	authDomain = strings.ToLower(strings.TrimSuffix(authDomain, "."))
+	if authDomain == "" {
+		return false
+	}
+	if mode == dmarc.AlignmentStrict {
+		return authDomain == fromDomain
+	}
+	return organizationalDomain(authDomain) == organizationalDomain(fromDomain)
+}
+
+func organizationalDomain(domain string) string {
+	org, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return domain
+	}
+	return org
+}
+
+// parseHeaderFrom extracts the single RFC 5322 From address of a message.
+func parseHeaderFrom(messageData []byte) (string, error) {
+	fields, _ := splitMessage(messageData)
+	// RFC 5322 allows one From field; a second one would let the author the
+	// user sees differ from the one checked here
+	values := headerValues(fields, "From")
+	switch {
+	case len(values) > 1:
+		return "", fmt.Errorf("message has %d From fields", len(values))
+	case len(values) == 0 || values[0] == "":
+		return "", errors.New("missing From header")
+	}
+	addrs, err := mail.ParseAddressList(values[0])
+	if err != nil {
+		return "", fmt.Errorf("parse From header: %w", err)
+	}
+	// RFC 7489 section 6.6.1: multiple authors cannot be evaluated reliably
+	if len(addrs) != 1 {
+		return "", fmt.Errorf("From header has %d addresses", len(addrs))
+	}
+	return addrs[0].Address, nil
+}
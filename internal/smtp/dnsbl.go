@@ -0,0 +1,194 @@
+package smtpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	"github.com/Goofygiraffe06/zinc/internal/resolver"
+)
+
+// BlocklistAction is what a listing in a zone does to the session.
+type BlocklistAction int
+
+const (
+	// BlocklistWarn only logs the listing.
+	BlocklistWarn BlocklistAction = iota
+	// BlocklistEscalate evaluates in strict mode regardless of
+	// SMTP_VERIFICATION_MODE, so the sender must pass authentication. A
+	// listed client escalates its connection; a listed sender domain or relay
+	// origin only the current transaction.
+	BlocklistEscalate
+	// BlocklistReject refuses the client or sender outright.
+	BlocklistReject
+)
+
+func (a BlocklistAction) String() string {
+	switch a {
+	case BlocklistWarn:
+		return "warn"
+	case BlocklistEscalate:
+		return "escalate"
+	case BlocklistReject:
+		return "reject"
+	default:
+		return "unknown"
+	}
+}
+
+// BlocklistZone is one DNSBL or RHSBL zone and the action for its listings.
+type BlocklistZone struct {
+	Zone   string
+	Action BlocklistAction
+}
+
+// ParseBlocklistZones parses "zone[:action]" entries. The action defaults to
+// warn; entries with an unknown action are skipped and logged.
+func ParseBlocklistZones(entries []string) []BlocklistZone {
+	var zones []BlocklistZone
+	for _, entry := range entries {
+		zone, action, _ := strings.Cut(entry, ":")
+		zone = strings.Trim(strings.ToLower(strings.TrimSpace(zone)), ".")
+		if zone == "" {
+			continue
+		}
+		z := BlocklistZone{Zone: zone}
+		switch strings.ToLower(strings.TrimSpace(action)) {
+		case "", "warn":
+			z.Action = BlocklistWarn
+		case "escalate":
+			z.Action = BlocklistEscalate
+		case "reject":
+			z.Action = BlocklistReject
+		default:
+			logging.ErrorLog("blocklist zone %s ignored: unknown action %q", zone, action)
+			continue
+		}
+		zones = append(zones, z)
+	}
+	return zones
+}
+
+// BlocklistHit is a listing found in one zone.
+type BlocklistHit struct {
+	Zone  BlocklistZone
+	Codes []string
+}
+
+// BlocklistChecker queries DNS blocklists for client IPs (DNSBL) and sender
+// domains (RHSBL).
+type BlocklistChecker struct {
+	resolver    resolver.Resolver
+	ipZones     []BlocklistZone
+	domainZones []BlocklistZone
+	timeout     time.Duration
+}
+
+// NewBlocklistChecker creates a checker that queries the zones through res.
+func NewBlocklistChecker(res resolver.Resolver, ipZones, domainZones []BlocklistZone, timeout time.Duration) *BlocklistChecker {
+	return &BlocklistChecker{resolver: res, ipZones: ipZones, domainZones: domainZones, timeout: timeout}
+}
+
+// CheckIP looks up ip in every DNSBL zone.
+func (c *BlocklistChecker) CheckIP(ctx context.Context, ip string) []BlocklistHit {
+	if len(c.ipZones) == 0 {
+		return nil
+	}
+	label, err := reverseIP(ip)
+	if err != nil {
+		logging.DebugLog("DNSBL check skipped: %v", err)
+		return nil
+	}
+	return c.check(ctx, label, c.ipZones)
+}
+
+// CheckDomain looks up domain in every RHSBL zone.
+func (c *BlocklistChecker) CheckDomain(ctx context.Context, domain string) []BlocklistHit {
+	domain = strings.Trim(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if len(c.domainZones) == 0 || domain == "" {
+		return nil
+	}
+	return c.check(ctx, domain, c.domainZones)
+}
+
+func (c *BlocklistChecker) check(ctx context.Context, label string, zones []BlocklistZone) []BlocklistHit {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var hits []BlocklistHit
+	for _, z := range zones {
+		addrs, err := c.resolver.LookupIPAddr(ctx, label+"."+z.Zone)
+		if err != nil {
+			var dnsErr *net.DNSError
+			if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+				logging.WarnLog("blocklist lookup failed zone=%s: %v", z.Zone, err)
+			}
+			continue
+		}
+		var codes []string
+		for _, a := range addrs {
+			v4 := a.IP.To4()
+			// Only 127.0.0.0/8 answers are listings; 127.255.255.x is how
+			// several operators signal a refused or rate-limited query.
+			if v4 == nil || v4[0] != 127 {
+				continue
+			}
+			if v4[1] == 255 && v4[2] == 255 {
+				logging.WarnLog("blocklist zone=%s refused query: %s", z.Zone, v4)
+				continue
+			}
+			codes = append(codes, v4.String())
+		}
+		if len(codes) > 0 {
+			hits = append(hits, BlocklistHit{Zone: z, Codes: codes})
+		}
+	}
+	return hits
+}
+
+// strongestAction returns the most severe action among hits.
+func strongestAction(hits []BlocklistHit) BlocklistAction {
+	action := BlocklistWarn
+	for _, h := range hits {
+		if h.Zone.Action > action {
+			action = h.Zone.Action
+		}
+	}
+	return action
+}
+
+// describeHits formats hits for logs, e.g. "zen.example[127.0.0.2]".
+func describeHits(hits []BlocklistHit) string {
+	parts := make([]string, 0, len(hits))
+	for _, h := range hits {
+		parts = append(parts, fmt.Sprintf("%s[%s]", h.Zone.Zone, strings.Join(h.Codes, ",")))
+	}
+	return strings.Join(parts, " ")
+}
+
+// reverseIP returns the DNSBL query label for ip: reversed octets for IPv4
+// and reversed nibbles for IPv6.
+func reverseIP(ip string) (string, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", fmt.Errorf("invalid IP address %q", ip)
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d", v4[3], v4[2], v4[1], v4[0]), nil
+	}
+	const hexDigits = "0123456789abcdef"
+	var b strings.Builder
+	for i := len(parsed) - 1; i >= 0; i-- {
+		b.WriteByte(hexDigits[parsed[i]&0x0f])
+		b.WriteByte('.')
+		b.WriteByte(hexDigits[parsed[i]>>4])
+		if i > 0 {
+			b.WriteByte('.')
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,198 @@
+package smtpserver
+
+import (
+	"bytes"
+	"strings"
+)
+
+// rawField is one header field exactly as received, folding included,
+// terminated by CRLF. Signature schemes need the original bytes.
+type rawField string
+
+func (f rawField) name() string {
+	name, _, _ := strings.Cut(string(f), ":")
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func (f rawField) value() string {
+	_, v, _ := strings.Cut(string(f), ":")
+	return strings.TrimSpace(unfold(v))
+}
+
+// splitMessage normalizes line endings to CRLF and splits a message into its
+// raw header fields (top to bottom) and body.
+func splitMessage(data []byte) ([]rawField, []byte) {
+	data = toCRLF(data)
+
+	var header, body []byte
+	if i := bytes.Index(data, []byte("\r\n\r\n")); i >= 0 {
+		header, body = data[:i+2], data[i+4:]
+	} else {
+		header = data
+	}
+
+	var fields []rawField
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1] += rawField(line)
+			continue
+		}
+		fields = append(fields, rawField(line))
+	}
+	return fields, body
+}
+
+// headerValues returns the unfolded values of every field named name, top to bottom.
+func headerValues(fields []rawField, name string) []string {
+	name = strings.ToLower(name)
+	var out []string
+	for _, f := range fields {
+		if f.name() == name {
+			out = append(out, f.value())
+		}
+	}
+	return out
+}
+
+func toCRLF(data []byte) []byte {
+	if !bytes.Contains(data, []byte("\n")) || (bytes.Count(data, []byte("\r\n")) == bytes.Count(data, []byte("\n"))) {
+		return data
+	}
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
+
+func unfold(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "")
+	return strings.ReplaceAll(s, "\n", "")
+}
+
+// parseTagList parses a DKIM-style "k=v; k=v" list. Values keep interior
+// whitespace; callers strip it where the spec says FWS is insignificant.
+func parseTagList(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(unfold(s), ";") {
+		k, v, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		tags[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return tags
+}
+
+func stripWhitespace(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// canonicalizeHeader applies the RFC 6376 "simple" or "relaxed" header algorithm.
+func canonicalizeHeader(f rawField, relaxed bool) string {
+	if !relaxed {
+		return string(f)
+	}
+	name, value, _ := strings.Cut(string(f), ":")
+	value = compressWSP(unfold(value))
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(value) + "\r\n"
+}
+
+// canonicalizeBody applies the RFC 6376 "simple" or "relaxed" body algorithm.
+func canonicalizeBody(body []byte, relaxed bool) []byte {
+	lines := strings.SplitAfter(string(body), "\r\n")
+	var b strings.Builder
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		if relaxed {
+			content := strings.TrimSuffix(line, "\r\n")
+			content = strings.TrimRight(compressWSP(content), " ")
+			if strings.HasSuffix(line, "\r\n") {
+				content += "\r\n"
+			}
+			line = content
+		}
+		b.WriteString(line)
+	}
+	out := b.String()
+	if out != "" && !strings.HasSuffix(out, "\r\n") {
+		out += "\r\n"
+	}
+	// Trailing empty lines are ignored by both algorithms
+	for strings.HasSuffix(out, "\r\n\r\n") {
+		out = strings.TrimSuffix(out, "\r\n")
+	}
+	// A body of only empty lines is empty: "\r\n" under simple, "" under relaxed
+	switch {
+	case relaxed && out == "\r\n":
+		out = ""
+	case !relaxed && out == "":
+		out = "\r\n"
+	}
+	return []byte(out)
+}
+
+func compressWSP(s string) string {
+	var b strings.Builder
+	inWSP := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' {
+			if !inWSP {
+				b.WriteByte(' ')
+			}
+			inWSP = true
+			continue
+		}
+		inWSP = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// removeSignatureValue empties the b= tag of a signature field, leaving every
+// other byte intact as required when verifying the field's own signature.
+func removeSignatureValue(f rawField) rawField {
+	name, value, ok := strings.Cut(string(f), ":")
+	if !ok {
+		return f
+	}
+	parts := strings.Split(value, ";")
+	for i, part := range parts {
+		k, _, ok := strings.Cut(part, "=")
+		if ok && strings.TrimSpace(k) == "b" {
+			eq := strings.Index(part, "=")
+			parts[i] = part[:eq+1]
+			// Keep the field's line terminator if b= was the last tag
+			if strings.HasSuffix(part, "\r\n") {
+				parts[i] += "\r\n"
+			}
+		}
+	}
+	return rawField(name + ":" + strings.Join(parts, ";"))
+}
+
+// selectSignedHeaders picks the fields listed in h=, consuming instances from
+// the bottom up as RFC 6376 section 5.4.2 requires. Missing names are skipped.
+func selectSignedHeaders(fields []rawField, names []string) []rawField {
+	used := make(map[int]bool)
+	var out []rawField
+	for _, n := range names {
+		n = strings.ToLower(strings.TrimSpace(n))
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && fields[i].name() == n {
+				used[i] = true
+				out = append(out, fields[i])
+				break
+			}
+		}
+	}
+	return out
+}
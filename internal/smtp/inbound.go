@@ -0,0 +1,94 @@
+package smtpserver
+
+import (
+	"io"
+	"strings"
+
+	"github.com/Goofygiraffe06/zinc/internal/config"
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	"github.com/emersion/go-msgauth/authres"
+	smtpcore "github.com/emersion/go-smtp"
+)
+
+// InboundMessage is a message that reached zinc other than over SMTP: piped
+// in by the local MTA or posted by a mail provider's inbound webhook.
+type InboundMessage struct {
+	// Source names the hand-off in logs, e.g. "ingest" or "inbound/mailgun".
+	Source       string
+	Raw          []byte
+	EnvelopeFrom string
+	Recipients   []string
+	// RemoteIP and HELO describe the host that delivered the message to the
+	// provider. When empty they are taken from the Received fields.
+	RemoteIP string
+	HELO     string
+	// Auth holds the provider's own SPF and DKIM verdicts. Checks it leaves
+	// at none are run locally.
+	Auth *UpstreamResults
+}
+
+// Deliver runs a handed-over message through the same checks and nonce
+// processing as an LMTP delivery. It returns an error per recipient, nil for
+// those that were accepted, or an error for the whole message.
+func (b *Backend) Deliver(msg InboundMessage) ([]error, error) {
+	sess := b.newSession(msg.Source, msg.RemoteIP, true, true, config.SMTPVerificationMode(), msg.HELO, "none")
+	defer sess.Logout()
+	if msg.RemoteIP != "" || msg.Auth != nil {
+		sess.handoff = &relayOrigin{ip: msg.RemoteIP, helo: msg.HELO, auth: msg.Auth, authServID: msg.Source}
+	}
+
+	if int64(len(msg.Raw)) > sess.maxMessageBytes {
+		logging.WarnLog("Inbound message from %s exceeds %d bytes", msg.Source, sess.maxMessageBytes)
+		return nil, &smtpcore.SMTPError{Code: 552, EnhancedCode: smtpcore.EnhancedCode{5, 3, 4}, Message: "Message too big"}
+	}
+	if err := sess.Mail(msg.EnvelopeFrom, nil); err != nil {
+		return nil, err
+	}
+	// An empty sender here is one the hand-off didn't know; a real bounce
+	// still shows as Return-Path: <>
+	sess.nullSender = false
+	errs := make([]error, len(msg.Recipients))
+	accepted := 0
+	for i, rcpt := range msg.Recipients {
+		if errs[i] = sess.Rcpt(rcpt, nil); errs[i] == nil {
+			accepted++
+		}
+	}
+	if accepted == 0 {
+		return errs, nil
+	}
+
+	statuses, _ := sess.deliver(msg.Raw)
+	byAddr := make(map[string]error, len(statuses))
+	for _, st := range statuses {
+		byAddr[st.addr] = st.err
+	}
+	for i, rcpt := range msg.Recipients {
+		if errs[i] == nil {
+			errs[i] = byAddr[rcpt]
+		}
+	}
+	return errs, nil
+}
+
+// Ingest reads one message handed over by a local delivery agent, such as a
+// .forward pipe, and delivers it like Deliver.
+func (b *Backend) Ingest(r io.Reader, envelopeFrom string, rcpts []string) ([]error, error) {
+	messageData, err := readMessageData(r, int64(config.SMTPMaxMessageBytes()))
+	if err != nil && err != io.EOF {
+		logging.WarnLog("Ingest: error reading message: %v", err)
+		return nil, &smtpcore.SMTPError{Code: 451, EnhancedCode: smtpcore.EnhancedCode{4, 3, 0}, Message: "error reading message"}
+	}
+	return b.Deliver(InboundMessage{Source: "ingest", Raw: messageData, EnvelopeFrom: envelopeFrom, Recipients: rcpts})
+}
+
+// ParseSPFResult maps a provider's SPF verdict, e.g. "Pass" or "softfail",
+// to an SPFResult. Anything unrecognized is none.
+func ParseSPFResult(v string) SPFResult {
+	return spfResultFromAuthres(authres.ResultValue(strings.ToLower(strings.TrimSpace(v))))
+}
+
+// ParseDKIMResult maps a provider's DKIM verdict to a DKIMResult.
+func ParseDKIMResult(v string) DKIMResult {
+	return dkimResultFromAuthres(authres.ResultValue(strings.ToLower(strings.TrimSpace(v))))
+}
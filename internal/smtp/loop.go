@@ -0,0 +1,104 @@
+package smtpserver
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+)
+
+// Reasons a message is dropped as machine-generated. They double as the
+// reason label on the dropped-messages metric.
+const (
+	dropNullSender     = "null_sender"
+	dropAutoSubmitted  = "auto_submitted"
+	dropPrecedence     = "precedence"
+	dropListID         = "list_id"
+	dropDeliveryStatus = "delivery_status"
+)
+
+// maxMIMEDepth bounds how far nested multiparts are searched for a
+// delivery-status part.
+const maxMIMEDepth = 4
+
+// automatedReason reports why a message is a bounce, auto-reply or list
+// delivery rather than a user's verification mail, or "" if it is none of
+// those. Answering such mail in kind risks a loop, and counting it could
+// verify an address on behalf of a robot.
+func automatedReason(nullSender bool, messageData []byte) string {
+	if nullSender {
+		return dropNullSender
+	}
+	fields, body := splitMessage(messageData)
+	// After final delivery the envelope only survives as Return-Path
+	for _, v := range headerValues(fields, "Return-Path") {
+		if strings.TrimSpace(v) == "<>" {
+			return dropNullSender
+		}
+	}
+	for _, v := range headerValues(fields, "Auto-Submitted") {
+		// RFC 3834: anything but "no" is automatic
+		if kw := strings.ToLower(firstToken(v)); kw != "" && kw != "no" {
+			return dropAutoSubmitted
+		}
+	}
+	for _, v := range headerValues(fields, "Precedence") {
+		switch strings.ToLower(firstToken(v)) {
+		case "bulk", "list", "junk":
+			return dropPrecedence
+		}
+	}
+	if len(headerValues(fields, "List-Id")) > 0 {
+		return dropListID
+	}
+	ctypes := headerValues(fields, "Content-Type")
+	if len(ctypes) > 0 && hasDeliveryStatus(ctypes[0], body, 0) {
+		return dropDeliveryStatus
+	}
+	return ""
+}
+
+// hasDeliveryStatus reports whether a part with the given Content-Type is,
+// or contains, a delivery status notification (RFC 3464, RFC 6533).
+func hasDeliveryStatus(contentType string, body []byte, depth int) bool {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "message/delivery-status", "message/global-delivery-status":
+		return true
+	case "multipart/report":
+		if strings.EqualFold(params["report-type"], "delivery-status") {
+			return true
+		}
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" || depth >= maxMIMEDepth {
+		return false
+	}
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := mr.NextRawPart()
+		if err != nil {
+			return false
+		}
+		partBody, err := io.ReadAll(part)
+		if err != nil {
+			return false
+		}
+		// Parts without a Content-Type are text/plain, or message/rfc822
+		// in a digest; neither is a report
+		if ct := part.Header.Get("Content-Type"); ct != "" && hasDeliveryStatus(ct, partBody, depth+1) {
+			return true
+		}
+	}
+}
+
+// firstToken returns v up to its first parameter or comment.
+func firstToken(v string) string {
+	if i := strings.IndexAny(v, ";( \t"); i >= 0 {
+		v = v[:i]
+	}
+	return strings.TrimSpace(v)
+}
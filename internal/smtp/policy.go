@@ -0,0 +1,261 @@
+package smtpserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/filewatch"
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	"github.com/Goofygiraffe06/zinc/internal/utils"
+	"github.com/emersion/go-msgauth/dmarc"
+	smtpcore "github.com/emersion/go-smtp"
+)
+
+// Checks a policy rule can require.
+const (
+	RequireSPF         = "spf"          // SPF pass
+	RequireDKIM        = "dkim"         // any valid DKIM signature
+	RequireDKIMAligned = "dkim_aligned" // DKIM pass aligned (relaxed) with the header From domain
+	RequireDMARC       = "dmarc"        // DMARC pass
+	RequireTLS         = "tls"          // delivered over STARTTLS or implicit TLS
+)
+
+var knownRequirements = map[string]bool{
+	RequireSPF: true, RequireDKIM: true, RequireDKIMAligned: true, RequireDMARC: true, RequireTLS: true,
+}
+
+// PolicyRule lists the checks required of senders whose domain matches one of
+// Domains. Patterns use shell wildcards: "*.example.org" matches subdomains
+// only and "*" matches every domain. When IPs is set the client address must
+// fall inside one of the listed networks.
+type PolicyRule struct {
+	Name    string   `json:"name"`
+	Domains []string `json:"domains"`
+	Require []string `json:"require"`
+	IPs     []string `json:"ips,omitempty"`
+	// Action is "reject" (default) to refuse unmet rules or "warn" to log them.
+	Action string `json:"action,omitempty"`
+
+	networks []*net.IPNet
+}
+
+// Policy is a per-sender-domain verification policy. Rules are tried in file
+// order and the first match applies; domains matching no rule fall back to
+// SMTP_VERIFICATION_MODE alone.
+type Policy struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// LoadPolicy reads and validates a JSON policy file.
+func LoadPolicy(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read policy: %w", err)
+	}
+	return ParsePolicy(data)
+}
+
+// ParsePolicy decodes and validates a JSON policy. Unknown fields, unknown
+// requirements, bad wildcard patterns and bad networks are errors.
+func ParsePolicy(data []byte) (*Policy, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var p Policy
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("decode policy: %w", err)
+	}
+	if len(p.Rules) == 0 {
+		return nil, errors.New("policy has no rules")
+	}
+	for i := range p.Rules {
+		if err := p.Rules[i].compile(i); err != nil {
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+func (r *PolicyRule) compile(i int) error {
+	if r.Name == "" {
+		r.Name = fmt.Sprintf("rule %d", i+1)
+	}
+	if len(r.Domains) == 0 {
+		return fmt.Errorf("policy %s: no domains", r.Name)
+	}
+	for j, d := range r.Domains {
+		d = asciiPattern(strings.Trim(strings.ToLower(strings.TrimSpace(d)), "."))
+		if _, err := path.Match(d, ""); err != nil || d == "" {
+			return fmt.Errorf("policy %s: invalid domain pattern %q", r.Name, r.Domains[j])
+		}
+		r.Domains[j] = d
+	}
+	for _, req := range r.Require {
+		if !knownRequirements[req] {
+			return fmt.Errorf("policy %s: unknown requirement %q", r.Name, req)
+		}
+	}
+	nets, err := parseNetworks(r.IPs)
+	if err != nil {
+		return fmt.Errorf("policy %s: %w", r.Name, err)
+	}
+	r.networks = nets
+	switch r.Action {
+	case "":
+		r.Action = "reject"
+	case "reject", "warn":
+	default:
+		return fmt.Errorf("policy %s: unknown action %q", r.Name, r.Action)
+	}
+	return nil
+}
+
+// asciiPattern writes the IDN labels of a domain pattern as A-labels, the
+// form sender domains are matched in. Labels holding wildcards stay as given.
+func asciiPattern(pattern string) string {
+	labels := strings.Split(pattern, ".")
+	for i, l := range labels {
+		if !strings.ContainsAny(l, "*?[") {
+			labels[i] = asciiDomain(l)
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// Match returns the first rule whose patterns match domain, or nil.
+func (p *Policy) Match(domain string) *PolicyRule {
+	if p == nil {
+		return nil
+	}
+	domain = strings.Trim(strings.ToLower(domain), ".")
+	for i := range p.Rules {
+		for _, pattern := range p.Rules[i].Domains {
+			if ok, _ := path.Match(pattern, domain); ok {
+				return &p.Rules[i]
+			}
+		}
+	}
+	return nil
+}
+
+// unmet returns the requirements of r that the message did not satisfy.
+func (r *PolicyRule) unmet(out authOutcome, fromDomain, tlsVersion string) []string {
+	var missing []string
+	for _, req := range r.Require {
+		ok := false
+		switch req {
+		case RequireSPF:
+			ok = out.spf == SPFPass
+		case RequireDKIM:
+			ok = out.dkim == DKIMPass
+		case RequireDKIMAligned:
+			if out.dkim == DKIMPass {
+				for _, d := range out.dkimDomains {
+					if aligned(fromDomain, d, dmarc.AlignmentRelaxed) {
+						ok = true
+						break
+					}
+				}
+			}
+		case RequireDMARC:
+			ok = out.dmarc.Result == DMARCPass
+		case RequireTLS:
+			ok = tlsVersion != "none"
+		}
+		if !ok {
+			missing = append(missing, req)
+		}
+	}
+	if len(r.networks) > 0 && !containsIP(r.networks, net.ParseIP(out.senderIP)) {
+		missing = append(missing, "ip")
+	}
+	return missing
+}
+
+// applyPolicy evaluates the sender policy for the header From domain (or the
+// envelope domain when the header is unusable) and logs the rule that fired.
+func (s *verifyMailboxSession) applyPolicy(out *authOutcome, headerFrom string) error {
+	addr := headerFrom
+	if addr == "" {
+		addr = s.from
+	}
+	_, domain := splitAddress(addr)
+	domain = strings.ToLower(domain)
+	rule := s.policy.Match(domain)
+	if rule == nil {
+		return nil
+	}
+	out.policyRule = rule.Name
+
+	missing := rule.unmet(*out, domain, s.tlsVersion)
+	if len(missing) == 0 {
+		logging.InfoLog("SMTP policy rule=%q satisfied: domain=%s from=[%s]", rule.Name, domain, utils.HashEmail(s.from))
+		return nil
+	}
+	if rule.Action == "warn" {
+		logging.WarnLog("SMTP policy rule=%q not satisfied (action=warn): domain=%s missing=%s from=[%s]",
+			rule.Name, domain, strings.Join(missing, ","), utils.HashEmail(s.from))
+		return nil
+	}
+	logging.WarnLog("SMTP policy rule=%q not satisfied: domain=%s missing=%s from=[%s] - rejecting",
+		rule.Name, domain, strings.Join(missing, ","), utils.HashEmail(s.from))
+	return &smtpcore.SMTPError{
+		Code:         550,
+		EnhancedCode: smtpcore.EnhancedCode{5, 7, 1},
+		Message:      "Sender policy not satisfied: requires " + strings.Join(missing, ", "),
+	}
+}
+
+// policyReloader keeps the current policy and swaps it when the file changes.
+// A file that fails validation is logged and the previous policy is kept.
+type policyReloader struct {
+	file    string
+	policy  atomic.Pointer[Policy]
+	watcher *filewatch.Watcher
+}
+
+func newPolicyReloader(file string, interval time.Duration) (*policyReloader, error) {
+	r := &policyReloader{file: file}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	r.watcher = filewatch.New(interval, func() {
+		if err := r.reload(); err != nil {
+			logging.ErrorLog("SMTP policy reload failed, keeping previous policy: %v", err)
+			return
+		}
+		logging.InfoLog("SMTP policy reloaded from %s (%d rules)", r.file, len(r.current().Rules))
+	}, file)
+	r.watcher.Start()
+	return r, nil
+}
+
+func (r *policyReloader) reload() error {
+	p, err := LoadPolicy(r.file)
+	if err != nil {
+		return err
+	}
+	r.policy.Store(p)
+	return nil
+}
+
+// current returns the active policy; nil when no policy file is configured.
+func (r *policyReloader) current() *Policy {
+	if r == nil {
+		return nil
+	}
+	return r.policy.Load()
+}
+
+func (r *policyReloader) stop() {
+	if r != nil {
+		r.watcher.Stop()
+	}
+}
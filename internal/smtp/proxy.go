@@ -0,0 +1,64 @@
+package smtpserver
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// newProxyListener accepts PROXY protocol v1/v2 headers from the trusted
+// networks, so the client address in the header becomes the connection's
+// RemoteAddr. Connections from trusted proxies must send a header; everyone
+// else is served as a plain SMTP client and never has a header parsed, since a
+// direct client waits for our greeting and would stall the header read.
+func newProxyListener(ln net.Listener, trusted []string, headerTimeout time.Duration) (net.Listener, error) {
+	nets, err := parseNetworks(trusted)
+	if err != nil {
+		return nil, fmt.Errorf("proxy protocol: %w", err)
+	}
+	return &proxyproto.Listener{
+		Listener:          ln,
+		ReadHeaderTimeout: headerTimeout,
+		Policy: func(upstream net.Addr) (proxyproto.Policy, error) {
+			if tcp, ok := upstream.(*net.TCPAddr); ok && containsIP(nets, tcp.IP) {
+				return proxyproto.REQUIRE, nil
+			}
+			return proxyproto.SKIP, nil
+		},
+	}, nil
+}
+
+// parseNetworks parses CIDRs and bare addresses, which are taken as /32 or /128.
+func parseNetworks(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * len(ip)
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", entry)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,226 @@
+package smtpserver
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/config"
+	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	"github.com/Goofygiraffe06/zinc/internal/manager"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/utils"
+)
+
+// WorkQueue persists accepted nonces until they have been processed.
+// store.SQLiteWorkQueue implements it.
+type WorkQueue interface {
+	Enqueue(t models.VerifyTask) (int64, error)
+	Claim(now time.Time, lease time.Duration, limit int) ([]models.VerifyTask, error)
+	Release(now time.Time) error
+	Complete(id int64) error
+	Retry(id int64, attempts int, next time.Time, lastErr string) error
+}
+
+const (
+	// queueLease must outlive one processing attempt so a task in flight is
+	// not claimed twice.
+	queueLease       = 30 * time.Second
+	queueBatch       = 100
+	queueMaxAttempts = 5
+	queueRetryBase   = 5 * time.Second
+	// verifyTimeout bounds the processing of one nonce.
+	verifyTimeout = 5 * time.Second
+)
+
+// verifyQueue runs nonce processing on the SMTP pool. With a WorkQueue every
+// task is written down before the sender is acknowledged and removed once
+// processed, giving at-least-once processing across a full pool or a crash;
+// processVerifyNonce is idempotent to match. Without one, tasks live only in
+// the pool.
+type verifyQueue struct {
+	store       WorkQueue
+	ttlStore    controller.ProofStore
+	registry    controller.Notifier
+	rateLimiter *rateLimiter
+	registrar   Registrar
+	mgr         *manager.WorkManager
+	poll        time.Duration
+
+	startOnce sync.Once
+	running   atomic.Bool
+	stop      chan struct{}
+	done      chan struct{}
+	shutdown  sync.Once
+}
+
+// submit hands a task to the pool. In synchronous mode it waits for the
+// verdict; otherwise it returns once the task is safely queued, or
+// errVerifyUnavailable if it could be neither stored nor scheduled.
+func (q *verifyQueue) submit(t models.VerifyTask, wait bool) error {
+	if q.store != nil {
+		// Not due before the in-line attempt has had its chance
+		t.NextAttemptAt = time.Now().Add(queueLease)
+		id, err := q.store.Enqueue(t)
+		if err != nil {
+			logging.ErrorLog("SMTP verify queue write failed nonce=[%s]: %v", utils.HashEmail(t.Nonce), err)
+			return errVerifyUnavailable
+		}
+		t.ID = id
+	}
+
+	// Room for a late result after a timeout, so the worker never blocks
+	result := make(chan error, 2)
+	err := q.mgr.SubmitSMTP(func(ctx context.Context) { result <- q.run(ctx, t) })
+	if err != nil {
+		if q.store != nil {
+			q.postpone(t, err)
+		} else {
+			logging.ErrorLog("SMTP nonce processing dropped nonce=[%s]: %v", utils.HashEmail(t.Nonce), err)
+		}
+		// Without a store nothing will pick the task up later
+		if wait || q.store == nil {
+			return errVerifyUnavailable
+		}
+		return nil
+	}
+	if !wait {
+		return nil
+	}
+	return <-result
+}
+
+// run processes one task with a bounded timeout and settles it in the store.
+func (q *verifyQueue) run(ctx context.Context, t models.VerifyTask) error {
+	verdict := make(chan error, 1)
+	if !manager.RunWithTimeout(ctx, verifyTimeout, func(ctx context.Context) {
+		if q.emailRegistration(t) {
+			verdict <- processEmailRegistration(t, q.ttlStore, q.rateLimiter, q.registrar)
+			return
+		}
+		if t.Report.Decision == models.DecisionRejected {
+			recordRejection(t.Nonce, t.Report, q.ttlStore)
+			verdict <- nil
+			return
+		}
+		verdict <- processVerifyNonce(ctx, t.Nonce, t.Report, t.SentAt, q.ttlStore, q.registry, q.rateLimiter)
+	}) {
+		// Left leased in the store; it is retried when the lease runs out
+		logging.WarnLog("SMTP nonce processing timeout nonce=%s", utils.HashEmail(t.Nonce))
+		return errVerifyUnavailable
+	}
+	err := <-verdict
+	q.settle(t, err)
+	return err
+}
+
+// emailRegistration reports whether t completes a registration by itself. A
+// registration already waiting on POST /register for the nonce takes
+// precedence, and the message only verifies it.
+func (q *verifyQueue) emailRegistration(t models.VerifyTask) bool {
+	if t.Registration == nil || q.registrar == nil {
+		return false
+	}
+	_, pending := q.ttlStore.Get("expected:" + t.Nonce)
+	return !pending
+}
+
+func (q *verifyQueue) settle(t models.VerifyTask, err error) {
+	if q.store == nil {
+		return
+	}
+	attempts := t.Attempts + 1
+	if err != nil && isTemporary(err) && attempts < queueMaxAttempts {
+		next := time.Now().Add(queueRetryBase << (attempts - 1))
+		if serr := q.store.Retry(t.ID, attempts, next, err.Error()); serr != nil {
+			logging.ErrorLog("SMTP verify queue retry failed nonce=[%s]: %v", utils.HashEmail(t.Nonce), serr)
+		}
+		return
+	}
+	if err != nil && isTemporary(err) {
+		logging.WarnLog("SMTP verify queue giving up after %d attempts nonce=[%s]: %v", attempts, utils.HashEmail(t.Nonce), err)
+	}
+	if serr := q.store.Complete(t.ID); serr != nil {
+		logging.ErrorLog("SMTP verify queue completion failed nonce=[%s]: %v", utils.HashEmail(t.Nonce), serr)
+	}
+}
+
+// start begins replaying queued tasks: everything left by a previous process
+// at once, then whatever falls due.
+func (q *verifyQueue) start() {
+	if q.store == nil {
+		return
+	}
+	q.startOnce.Do(func() {
+		q.running.Store(true)
+		go func() {
+			defer close(q.done)
+			logging.InfoLog("SMTP verify queue started")
+			// Nothing else uses the queue, so every lease found now is orphaned
+			if err := q.store.Release(time.Now()); err != nil {
+				logging.ErrorLog("SMTP verify queue release failed: %v", err)
+			}
+			q.sweep(time.Now())
+			ticker := time.NewTicker(q.poll)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-q.stop:
+					return
+				case <-ticker.C:
+					q.sweep(time.Now())
+				}
+			}
+		}()
+	})
+}
+
+// stopLoop halts replaying. Tasks already on the pool are left to finish.
+func (q *verifyQueue) stopLoop() {
+	q.shutdown.Do(func() {
+		close(q.stop)
+		if q.running.Load() {
+			<-q.done
+		}
+	})
+}
+
+func (q *verifyQueue) sweep(now time.Time) {
+	tasks, err := q.store.Claim(now, queueLease, queueBatch)
+	if err != nil {
+		logging.ErrorLog("SMTP verify queue claim failed: %v", err)
+		return
+	}
+	for _, t := range tasks {
+		t := t
+		logging.InfoLog("SMTP verify queue replaying nonce=[%s] attempt=%d", utils.HashEmail(t.Nonce), t.Attempts+1)
+		if err := q.mgr.SubmitSMTP(func(ctx context.Context) { q.run(ctx, t) }); err != nil {
+			q.postpone(t, err)
+		}
+	}
+}
+
+// postpone leaves a task the pool had no room for due, without counting an
+// attempt, so the next sweep tries again.
+func (q *verifyQueue) postpone(t models.VerifyTask, err error) {
+	logging.WarnLog("SMTP nonce processing deferred nonce=[%s]: %v", utils.HashEmail(t.Nonce), err)
+	if serr := q.store.Retry(t.ID, t.Attempts, time.Now(), err.Error()); serr != nil {
+		logging.ErrorLog("SMTP verify queue retry failed nonce=[%s]: %v", utils.HashEmail(t.Nonce), serr)
+	}
+}
+
+func newVerifyQueue(store WorkQueue, ttl controller.ProofStore, registry controller.Notifier, rl *rateLimiter, registrar Registrar, mgr *manager.WorkManager) *verifyQueue {
+	return &verifyQueue{
+		store:       store,
+		ttlStore:    ttl,
+		registry:    registry,
+		rateLimiter: rl,
+		registrar:   registrar,
+		mgr:         mgr,
+		poll:        config.SMTPQueuePollInterval(),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
@@ -0,0 +1,282 @@
+package smtpserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/auth"
+	"github.com/Goofygiraffe06/zinc/internal/config"
+	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/utils"
+	"github.com/Goofygiraffe06/zinc/internal/webhook"
+	smtpcore "github.com/emersion/go-smtp"
+)
+
+// RegistrationContentType marks a MIME part carrying an email registration.
+const RegistrationContentType = "application/zinc-registration"
+
+var (
+	errBadRegistration       = &smtpcore.SMTPError{Code: 550, EnhancedCode: smtpcore.EnhancedCode{5, 6, 0}, Message: "Malformed registration"}
+	errRegistrationSignature = &smtpcore.SMTPError{Code: 550, EnhancedCode: smtpcore.EnhancedCode{5, 7, 1}, Message: "Invalid registration signature"}
+	errAlreadyRegistered     = &smtpcore.SMTPError{Code: 550, EnhancedCode: smtpcore.EnhancedCode{5, 7, 1}, Message: "Address already registered"}
+	errInsufficientAssurance = &smtpcore.SMTPError{Code: 550, EnhancedCode: smtpcore.EnhancedCode{5, 7, 1}, Message: "Message authentication too weak for registration"}
+)
+
+var validate = utils.NewValidator()
+
+// Registrar creates the accounts requested by email. *store.SQLiteStore
+// implements it.
+type Registrar interface {
+	Exists(email string) bool
+	AddUserWithEvents(user models.User, events ...models.OutboxEvent) error
+	AddReview(r models.Review) error
+}
+
+// WithRegistrar completes registrations carried in verification mail through
+// r, so clients need not hold POST /register open while the message travels.
+func WithRegistrar(r Registrar) BackendOption {
+	return func(o *backendOptions) { o.registrar = r }
+}
+
+// parseRegistration returns the registration a message asks for, or nil. It
+// is read from an application/zinc-registration part if there is one, and
+// otherwise from a text/plain body, as "Username:", "Public-Key:" and
+// "Signature:" lines. All three are required.
+func parseRegistration(messageData []byte) *models.EmailRegistration {
+	fields, body := splitMessage(messageData)
+	h := textproto.MIMEHeader{}
+	for _, f := range fields {
+		h.Add(f.name(), f.value())
+	}
+	reg, _ := findRegistration(h, body, 0)
+	return reg
+}
+
+// findRegistration searches one part. The flag reports whether the result
+// came from a dedicated part, which wins over any text body.
+func findRegistration(h textproto.MIMEHeader, body []byte, depth int) (*models.EmailRegistration, bool) {
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	switch {
+	case mediaType == RegistrationContentType:
+		return registrationFields(decodePart(h, body)), true
+	case mediaType == "text/plain":
+		return registrationFields(decodePart(h, body)), false
+	case !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" || depth >= maxMIMEDepth:
+		return nil, false
+	}
+
+	var text *models.EmailRegistration
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := mr.NextRawPart()
+		if err != nil {
+			return text, false
+		}
+		partBody, err := io.ReadAll(part)
+		if err != nil {
+			return text, false
+		}
+		reg, dedicated := findRegistration(part.Header, partBody, depth+1)
+		if dedicated {
+			return reg, true
+		}
+		if text == nil {
+			text = reg
+		}
+	}
+}
+
+// decodePart undoes the part's Content-Transfer-Encoding.
+func decodePart(h textproto.MIMEHeader, body []byte) []byte {
+	var r io.Reader
+	switch strings.ToLower(strings.TrimSpace(h.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, bytes.NewReader(bytes.Join(bytes.Fields(body), nil)))
+	case "quoted-printable":
+		r = quotedprintable.NewReader(bytes.NewReader(body))
+	default:
+		return body
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		return nil
+	}
+	return decoded
+}
+
+// registrationFields reads the registration lines of a decoded body. Lines
+// that start with white space continue the previous value, since mail
+// clients wrap long keys and signatures.
+func registrationFields(body []byte) *models.EmailRegistration {
+	values := make(map[string]string)
+	last := ""
+	sc := bufio.NewScanner(bytes.NewReader(body))
+	for sc.Scan() {
+		line := sc.Text()
+		if line != "" && (line[0] == ' ' || line[0] == '\t') && last != "" {
+			values[last] += strings.TrimSpace(line)
+			continue
+		}
+		last = ""
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "username", "public-key", "signature":
+			if _, seen := values[name]; !seen {
+				values[name] = strings.TrimSpace(value)
+				last = name
+			}
+		}
+	}
+	if values["username"] == "" || values["public-key"] == "" || values["signature"] == "" {
+		return nil
+	}
+	return &models.EmailRegistration{
+		Username:  values["username"],
+		PublicKey: values["public-key"],
+		Signature: values["signature"],
+	}
+}
+
+// processEmailRegistration creates the account a verification email asks for
+// and records the outcome for GET /register/status. It returns nil on
+// success, or the verdict to give the sender.
+func processEmailRegistration(t models.VerifyTask, ttlStore controller.ProofStore, rateLimiter *rateLimiter, registrar Registrar) error {
+	report := t.Report
+	sender := normalizeEmail(report.EnvelopeFrom)
+	emailHash := utils.HashEmail(sender)
+	nonceHash := utils.HashEmail(t.Nonce)
+
+	// A task replayed from the work queue may already have created the account
+	if o, ok := controller.LoadOutcome(ttlStore, t.Nonce); ok && o.Status == "ok" {
+		logging.DebugLog("SMTP registration: outcome already stored nonce=[%s]", nonceHash)
+		return nil
+	}
+
+	saveOutcome := func(status, reason string) {
+		o := models.RegistrationStatusResponse{Status: status, Error: reason, Verification: &report}
+		if err := controller.SaveOutcome(ttlStore, t.Nonce, o, config.RegistrationStatusTTL()); err != nil {
+			logging.ErrorLog("SMTP registration outcome store failed nonce=[%s]: %v", nonceHash, err)
+		}
+	}
+	fail := func(verdict error, reason string) error {
+		logging.WarnLog("SMTP registration failed: %s [%s] nonce=[%s]", reason, emailHash, nonceHash)
+		report.Decision, report.Reason = models.DecisionFailed, reason
+		saveOutcome("failed", reason)
+		return verdict
+	}
+
+	// The sender has already been told why the message was refused
+	if report.Decision == models.DecisionRejected {
+		logging.WarnLog("SMTP registration failed: message rejected [%s] nonce=[%s]", emailHash, nonceHash)
+		saveOutcome("failed", report.Reason)
+		return nil
+	}
+
+	if sender == "" {
+		logging.WarnLog("SMTP registration failed: invalid sender email from=%s", report.RemoteIP)
+		return errInvalidSender
+	}
+
+	if !rateLimiter.allow(sender) {
+		logging.WarnLog("SMTP registration failed: rate limit exceeded [%s] from=%s", emailHash, report.RemoteIP)
+		return errVerifyRateLimited
+	}
+
+	// Without a pending registration there is no expected address, so the
+	// header From is held to the envelope sender instead
+	if normalizeEmail(report.HeaderFrom) != sender {
+		return fail(errHeaderFromMismatch, "header From does not match the envelope sender")
+	}
+
+	// Sanitize as POST /register does
+	username := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(t.Registration.Username)), " ", "")
+	req := models.RegisterCompleteRequest{
+		Email:     sender,
+		Username:  username,
+		PublicKey: strings.Join(strings.Fields(t.Registration.PublicKey), ""),
+		Nonce:     t.Nonce,
+		Signature: strings.Join(strings.Fields(t.Registration.Signature), ""),
+	}
+	if err := validate.Struct(req); err != nil {
+		return fail(errBadRegistration, "registration is incomplete or malformed")
+	}
+
+	// The nonce in the address is canonical, and so is what the client signs
+	if valid, err := auth.VerifySignature(req.PublicKey, req.Nonce, req.Signature); err != nil || !valid {
+		return fail(errRegistrationSignature, "invalid signature")
+	}
+
+	if min := config.MinAssurance(); !auth.MeetsAssurance(report.Assurance, min) {
+		return fail(errInsufficientAssurance, "assurance "+report.Assurance+" is below the required "+min)
+	}
+
+	if registrar.Exists(sender) {
+		return fail(errAlreadyRegistered, "user already registered")
+	}
+
+	// A soft failure waits for an administrator, who creates the account
+	if report.Decision == models.DecisionReview {
+		r := models.Review{
+			Nonce:     t.Nonce,
+			Email:     sender,
+			Username:  req.Username,
+			PublicKey: req.PublicKey,
+			Report:    &report,
+			CreatedAt: time.Now(),
+		}
+		if err := registrar.AddReview(r); err != nil {
+			logging.ErrorLog("SMTP registration failed: review store [%s]: %v", emailHash, err)
+			return errVerifyUnavailable
+		}
+		logging.InfoLog("SMTP registration held for review [%s] nonce=[%s]: %s", emailHash, nonceHash, report.Reason)
+		return nil
+	}
+
+	report.Decision, report.Reason = models.DecisionAccepted, ""
+	user := models.User{
+		Email:              sender,
+		Username:           req.Username,
+		PublicKey:          req.PublicKey,
+		VerificationReport: &report,
+		Assurance:          report.Assurance,
+	}
+	events, err := webhook.UserEvents(webhook.EventUserRegistered, user)
+	if err != nil {
+		logging.ErrorLog("SMTP registration failed: webhook event [%s]: %v", emailHash, err)
+		return errVerifyUnavailable
+	}
+	if err := registrar.AddUserWithEvents(user, events...); err != nil {
+		// Someone else took the address while this message was processed
+		if registrar.Exists(sender) {
+			return fail(errAlreadyRegistered, "user already registered")
+		}
+		logging.ErrorLog("SMTP registration failed: database [%s]: %v", emailHash, err)
+		return errVerifyUnavailable
+	}
+
+	saveOutcome("ok", "")
+	logging.InfoLog("SMTP registration success [%s][%s] nonce=[%s] tls=%s",
+		emailHash, utils.HashUsername(req.Username), nonceHash, report.TLS)
+	return nil
+}
@@ -0,0 +1,110 @@
+package smtpserver
+
+import (
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/emersion/go-msgauth/authres"
+)
+
+// receivedIP matches the bracketed address MTAs record for the connecting
+// host, e.g. "(mail.example.org [192.0.2.1])" or "[IPv6:2001:db8::1]".
+var receivedIP = regexp.MustCompile(`\[(?:[Ii][Pp][Vv]6:)?([0-9A-Fa-f:.]+)\]`)
+
+// receivedHELO matches Exim's "(helo=name)" comment.
+var receivedHELO = regexp.MustCompile(`\(helo=([^)\s]+)\)`)
+
+// relayOrigin is what our trusted relays recorded about the host that handed
+// them the message.
+type relayOrigin struct {
+	ip   string
+	helo string
+	// auth holds the results from the relays' Authentication-Results, when one
+	// with a trusted authserv-id was found.
+	auth *UpstreamResults
+	// authServID is the authserv-id of the trusted Authentication-Results.
+	authServID string
+}
+
+// findRelayOrigin walks the Received fields top down, skipping hops between
+// trusted relays, and returns the first untrusted hop. Authentication-Results
+// fields are only trusted above that hop's Received field: anything below it
+// came from the sender, who can write whatever it likes.
+func findRelayOrigin(messageData []byte, relays []*net.IPNet, authServIDs []string) (relayOrigin, bool) {
+	fields, _ := splitMessage(messageData)
+
+	var (
+		origin relayOrigin
+		found  bool
+		arAt   = -1
+	)
+	for i, f := range fields {
+		switch f.name() {
+		case "authentication-results":
+			if arAt < 0 && !found {
+				id, _, err := authres.Parse(f.value())
+				if err == nil && containsFold(authServIDs, id) {
+					arAt = i
+				}
+			}
+		case "received":
+			if found {
+				continue
+			}
+			ip, helo, ok := parseReceived(f.value())
+			if !ok {
+				// a hop we cannot read breaks the chain of trust
+				return relayOrigin{}, false
+			}
+			if containsIP(relays, net.ParseIP(ip)) {
+				continue
+			}
+			origin.ip, origin.helo, found = ip, helo, true
+		}
+	}
+	if !found {
+		return relayOrigin{}, false
+	}
+	if arAt >= 0 {
+		id, results, _ := authres.Parse(fields[arAt].value())
+		up := upstreamFromResults(results)
+		origin.auth, origin.authServID = &up, id
+	}
+	return origin, true
+}
+
+// parseReceived extracts the connecting host's address and HELO name from the
+// "from" clause of a Received field value.
+func parseReceived(v string) (ip, helo string, ok bool) {
+	lower := strings.ToLower(v)
+	if !strings.HasPrefix(lower, "from ") {
+		return "", "", false
+	}
+	clause := v[len("from "):]
+	if i := strings.Index(strings.ToLower(clause), " by "); i >= 0 {
+		clause = clause[:i]
+	}
+
+	m := receivedIP.FindStringSubmatch(clause)
+	if m == nil || net.ParseIP(m[1]) == nil {
+		return "", "", false
+	}
+	ip = m[1]
+
+	if h := receivedHELO.FindStringSubmatch(clause); h != nil {
+		helo = h[1]
+	} else if fields := strings.Fields(clause); len(fields) > 0 && !strings.HasPrefix(fields[0], "[") && !strings.HasPrefix(fields[0], "(") {
+		helo = fields[0]
+	}
+	return ip, helo, true
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
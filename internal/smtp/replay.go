@@ -0,0 +1,87 @@
+package smtpserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	smtpcore "github.com/emersion/go-smtp"
+)
+
+var errReplayed = &smtpcore.SMTPError{Code: 550, EnhancedCode: smtpcore.EnhancedCode{5, 7, 1}, Message: "Message already delivered"}
+
+// replayKeys returns the ProofStore keys that identify a message: its
+// Message-ID and the b= value of every DKIM signature. A captured message
+// re-sent later keeps its signatures, since altering them breaks DKIM.
+func replayKeys(fields []rawField) []string {
+	var keys []string
+	for _, id := range headerValues(fields, "Message-ID") {
+		if id != "" {
+			keys = append(keys, replayKey("mid", id))
+		}
+	}
+	for _, sig := range headerValues(fields, "DKIM-Signature") {
+		if b := strings.Join(strings.Fields(parseTagList(sig)["b"]), ""); b != "" {
+			keys = append(keys, replayKey("dkim", b))
+		}
+	}
+	return keys
+}
+
+func replayKey(kind, value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "replay:" + kind + ":" + hex.EncodeToString(sum[:])
+}
+
+// claimedSendTime returns the earliest time a message claims for itself,
+// from its Date field and the t= of its DKIM signatures. It is zero when the
+// message carries neither.
+func claimedSendTime(fields []rawField) time.Time {
+	var earliest time.Time
+	consider := func(t time.Time) {
+		if earliest.IsZero() || t.Before(earliest) {
+			earliest = t
+		}
+	}
+	for _, v := range headerValues(fields, "Date") {
+		if t, err := mail.ParseDate(v); err == nil {
+			consider(t)
+		}
+	}
+	for _, sig := range headerValues(fields, "DKIM-Signature") {
+		if sec, err := strconv.ParseInt(strings.TrimSpace(parseTagList(sig)["t"]), 10, 64); err == nil {
+			consider(time.Unix(sec, 0))
+		}
+	}
+	return earliest
+}
+
+// replayed reports whether any of keys belongs to a message already processed
+// within the replay window.
+func (s *verifyMailboxSession) replayed(keys []string) bool {
+	if s.replayWindow <= 0 {
+		return false
+	}
+	for _, k := range keys {
+		if _, ok := s.ttlStore.Get(k); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// rememberMessage records keys so that later copies are refused.
+func (s *verifyMailboxSession) rememberMessage(keys []string) {
+	if s.replayWindow <= 0 {
+		return
+	}
+	for _, k := range keys {
+		if err := s.ttlStore.SetWithValue(k, s.remoteAddr, s.replayWindow); err != nil {
+			logging.ErrorLog("SMTP replay record failed from=%s: %v", s.remoteAddr, err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package smtpserver
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/emersion/go-msgauth/authres"
+)
+
+// newReport captures the session state and authentication outcome of the
+// current message. Decision and Reason are filled in per nonce.
+func (s *verifyMailboxSession) newReport(out authOutcome, headerFrom string) models.VerificationReport {
+	r := models.VerificationReport{
+		ReceivedAt:   time.Now().UTC(),
+		RemoteIP:     out.senderIP,
+		HELO:         out.helo,
+		EnvelopeFrom: strings.Trim(strings.TrimSpace(s.from), "<>"),
+		HeaderFrom:   headerFrom,
+		SPF:          models.AuthCheck{Result: out.spf.String()},
+		DKIM:         models.AuthCheck{Result: out.dkim.String(), Domains: out.dkimDomains},
+		DMARC:        models.AuthCheck{Result: out.dmarc.Result.String(), Policy: out.dmarc.Policy},
+		ARC:          models.AuthCheck{Result: out.arc.Result.String()},
+		TLS:          s.tlsVersion,
+		Mode:         s.mode(),
+		Policy:       out.policyRule,
+	}
+	if out.spfDomain != "" {
+		r.SPF.Domains = []string{out.spfDomain}
+	}
+	if out.dmarc.Domain != "" {
+		r.DMARC.Domains = []string{out.dmarc.Domain}
+	}
+	if out.arc.Sealer != "" {
+		r.ARC.Domains = []string{out.arc.Sealer}
+	}
+	r.Assurance = assuranceLevel(r)
+	r.AuthenticationResults = authenticationResults(s.domain, r)
+	return r
+}
+
+// authenticationResults renders a report as an RFC 8601 header value with
+// authServID as the authserv-id.
+func authenticationResults(authServID string, r models.VerificationReport) string {
+	results := []authres.Result{
+		&authres.SPFResult{Value: authres.ResultValue(r.SPF.Result), From: r.EnvelopeFrom, Helo: r.HELO},
+	}
+	if len(r.DKIM.Domains) > 0 {
+		for _, d := range r.DKIM.Domains {
+			results = append(results, &authres.DKIMResult{Value: authres.ResultPass, Domain: d})
+		}
+	} else {
+		results = append(results, &authres.DKIMResult{Value: authres.ResultValue(r.DKIM.Result)})
+	}
+	dmarcFrom := ""
+	if len(r.DMARC.Domains) > 0 {
+		dmarcFrom = r.DMARC.Domains[0]
+	}
+	results = append(results, &authres.DMARCResult{Value: authres.ResultValue(r.DMARC.Result), From: dmarcFrom})
+	if r.ARC.Result != ARCNone.String() {
+		results = append(results, &authres.GenericResult{
+			Method: "arc",
+			Value:  authres.ResultValue(r.ARC.Result),
+			Params: map[string]string{"smtp.remote-ip": r.RemoteIP},
+		})
+	}
+	// authres leaves a trailing space after results without properties
+	return strings.TrimSpace(strings.ReplaceAll(authres.Format(authServID, results), " ;", ";"))
+}
@@ -3,10 +3,13 @@ package smtpserver
 import (
 	"context"
 	"crypto/rand"
+	"crypto/tls"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -15,8 +18,11 @@ import (
 	"github.com/Goofygiraffe06/zinc/internal/controller"
 	"github.com/Goofygiraffe06/zinc/internal/logging"
 	"github.com/Goofygiraffe06/zinc/internal/manager"
+	"github.com/Goofygiraffe06/zinc/internal/metrics"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	"github.com/Goofygiraffe06/zinc/internal/resolver"
 	"github.com/Goofygiraffe06/zinc/internal/utils"
-	"github.com/Goofygiraffe06/zinc/store/ephemeral"
 	smtpcore "github.com/emersion/go-smtp"
 )
 
@@ -85,208 +91,441 @@ func (rl *rateLimiter) cleanup() {
 type verifyMailboxSession struct {
 	remoteAddr      string
 	from            string
-	recipients      []string
-	ttlStore        *ephemeral.TTLStore
-	registry        *controller.VerificationRegistry
+	nullSender      bool
+	utf8            bool
+	recipients      []verifyRecipient
+	ttlStore        controller.ProofStore
+	registry        controller.Notifier
 	mgr             *manager.WorkManager
+	queue           *verifyQueue
 	rateLimiter     *rateLimiter
+	throttle        *throttle
+	clientIP        string
+	released        bool
+	trustedRelay    bool
+	lmtp            bool
+	relays          []*net.IPNet
+	relayAuthIDs    []string
+	origin          *relayOrigin
+	handoff         *relayOrigin
+	invalidRcpts    int
 	acceptedCount   int
 	maxRecipients   int
 	maxMessageBytes int64
 	domain          string
-	recipientPrefix string
+	addressing      addressing
 	spfChecker      *SPFChecker
 	dkimChecker     *DKIMChecker
+	dmarcChecker    *DMARCChecker
+	arcSealers      []string
+	blocklists      *BlocklistChecker
+	policy          *Policy
 	verifyMode      string
+	escalated       bool
 	spfEnabled      bool
 	dkimEnabled     bool
+	dmarcEnabled    bool
+	requireTLS      bool
+	replayWindow    time.Duration
+	syncVerdicts    bool
+	helo            string
+	tlsVersion      string
 	messageData     []byte
 }
 
 func (s *verifyMailboxSession) Reset() {
 	s.from = ""
+	s.nullSender = false
+	s.utf8 = false
 	s.recipients = s.recipients[:0]
 	s.acceptedCount = 0
 	s.messageData = nil
+	s.origin = nil
+	s.escalated = false
 }
 
-func (s *verifyMailboxSession) Logout() error { return nil }
+// mode is the verification mode of the current transaction: the
+// connection's, or strict once a blocklist escalated this message.
+func (s *verifyMailboxSession) mode() string {
+	if s.escalated {
+		return "strict"
+	}
+	return s.verifyMode
+}
+
+// Logout frees the session's concurrency slot. go-smtp calls it on STARTTLS
+// as well as on close, and the next EHLO takes a new slot.
+func (s *verifyMailboxSession) Logout() error {
+	if !s.released {
+		s.released = true
+		s.throttle.conns.release(s.clientIP)
+	}
+	return nil
+}
 
 func (s *verifyMailboxSession) Mail(from string, opts *smtpcore.MailOptions) error {
+	// The hop from the local MTA over LMTP or a pipe never carries TLS
+	if s.requireTLS && !s.lmtp && s.tlsVersion == "none" {
+		switch s.mode() {
+		case "strict":
+			logging.WarnLog("SMTP MAIL rejected: plaintext transport (mode=strict) from=%s", s.remoteAddr)
+			return &smtpcore.SMTPError{Code: 530, EnhancedCode: smtpcore.EnhancedCode{5, 7, 0}, Message: "Must issue a STARTTLS command first"}
+		case "warn", "review":
+			// review mode holds the message for an administrator instead
+			logging.WarnLog("SMTP MAIL over plaintext transport (mode=%s) from=%s", s.mode(), s.remoteAddr)
+		}
+	}
+	// RFC 6531: a UTF-8 address is only allowed once the client has asked
+	// for SMTPUTF8; hand-offs without an SMTP dialogue pass nil options
+	s.utf8 = opts == nil || opts.UTF8
+	if !s.utf8 && !utils.IsASCII(from) {
+		logging.WarnLog("SMTP MAIL rejected: UTF-8 sender without SMTPUTF8 from=%s", s.remoteAddr)
+		return errUTF8Required
+	}
+	if !s.trustedRelay && !s.throttle.mailRate.allow(s.clientIP) {
+		logging.WarnLog("SMTP MAIL throttled: per-IP transaction rate exceeded from=%s", s.remoteAddr)
+		return &smtpcore.SMTPError{Code: 451, EnhancedCode: smtpcore.EnhancedCode{4, 7, 1}, Message: "Too many messages, slow down"}
+	}
+	_, senderDomain := splitAddress(from)
+	if hits := s.blocklists.CheckDomain(context.Background(), senderDomain); len(hits) > 0 {
+		action := strongestAction(hits)
+		logging.WarnLog("SMTP sender domain listed: action=%s zones=%s sender=[%s] from=%s",
+			action, describeHits(hits), utils.HashEmail(from), s.remoteAddr)
+		switch action {
+		case BlocklistReject:
+			return &smtpcore.SMTPError{Code: 550, EnhancedCode: smtpcore.EnhancedCode{5, 7, 1}, Message: "Sender domain blocked by DNS blocklist"}
+		case BlocklistEscalate:
+			s.escalated = true
+		}
+	}
 	s.from = from
+	s.nullSender = from == ""
 	return nil
 }
 
 func (s *verifyMailboxSession) Rcpt(to string, _ *smtpcore.RcptOptions) error {
-	// Accept only addresses verify+<nonce>@domain
-	// We ignore case for local-part prefix, but require domain match.
-	local, dom := splitAddress(to)
-	if !domainEquals(dom, s.domain) {
-		// Fail gracefully: pretend accepted to avoid enumeration but do not process
-		logging.DebugLog("SMTP RCPT ignored: wrong domain=%s from=%s", dom, s.remoteAddr)
-		return nil
+	if !s.utf8 && !utils.IsASCII(to) {
+		logging.DebugLog("SMTP RCPT rejected: UTF-8 recipient without SMTPUTF8 from=%s", s.remoteAddr)
+		return errUTF8Required
 	}
-
-	// local should be like: prefix+nonce
-	prefixLower := strings.ToLower(s.recipientPrefix)
-	parts := strings.SplitN(local, "+", 2)
-	if len(parts) != 2 || strings.ToLower(parts[0]) != prefixLower {
-		logging.DebugLog("SMTP RCPT ignored: not a verify address local=%s", utils.HashEmail(local))
+	// Accept only verification addresses in one of the enabled forms.
+	// Anything else is accepted silently to avoid enumeration but never processed.
+	rcpt, ok := s.addressing.match(to)
+	if !ok && s.lmtp {
+		// the MTA in front already accepted the message; let it bounce
+		logging.DebugLog("LMTP RCPT rejected: not a verify address rcpt=%s", utils.HashEmail(to))
+		return &smtpcore.SMTPError{Code: 550, EnhancedCode: smtpcore.EnhancedCode{5, 1, 1}, Message: "No such verification address"}
+	}
+	if !ok {
+		s.invalidRcpts++
+		logging.DebugLog("SMTP RCPT ignored: not a verify address rcpt=%s from=%s", utils.HashEmail(to), s.remoteAddr)
+		if d := tarpitDelay(s.invalidRcpts, s.throttle.tarpitStep, s.throttle.tarpitMax); d > 0 {
+			logging.InfoLog("SMTP RCPT tarpitted: invalid recipient #%d delay=%s from=%s", s.invalidRcpts, d, s.remoteAddr)
+			time.Sleep(d)
+		}
 		return nil
 	}
 	if s.acceptedCount >= s.maxRecipients {
 		return &smtpcore.SMTPError{Code: 452, EnhancedCode: smtpcore.EnhancedCode{4, 5, 3}, Message: "too many recipients"}
 	}
-	s.recipients = append(s.recipients, to)
+	if g := s.throttle.greylist; g != nil && !s.trustedRelay {
+		// Keyed on the bare mailbox: the token differs per registration, so a
+		// triplet with it would defer every first delivery
+		if pass, wait := g.check(s.clientIP, s.from, s.addressing.bareAddress()); !pass {
+			logging.InfoLog("SMTP RCPT greylisted: retry in %s rcpt=%s from=%s", wait.Round(time.Second), utils.HashEmail(to), s.remoteAddr)
+			return &smtpcore.SMTPError{Code: 451, EnhancedCode: smtpcore.EnhancedCode{4, 7, 1}, Message: "Greylisted, please try again later"}
+		}
+	}
+	s.recipients = append(s.recipients, rcpt)
 	s.acceptedCount++
 	return nil
 }
 
 func (s *verifyMailboxSession) Data(r io.Reader) error {
+	messageData, err := s.readData(r)
+	if err != nil {
+		return err
+	}
+	// Over SMTP the whole message shares one reply; per-recipient problems
+	// are not revealed so addresses cannot be probed
+	statuses, authErr := s.deliver(messageData)
+	if authErr != nil {
+		return authErr
+	}
+	if !s.syncVerdicts {
+		// A nonce that could not be queued is lost unless the sender retries
+		for _, st := range statuses {
+			if st.err == errVerifyUnavailable {
+				return st.err
+			}
+		}
+		return nil
+	}
+	// Nothing was addressed to a verification mailbox, or the message was
+	// dropped; answer as the asynchronous mode does
+	if len(statuses) == 0 {
+		return nil
+	}
+	// In synchronous mode the sender learns why, unless some address verified
+	for _, st := range statuses {
+		if st.err == nil {
+			return nil
+		}
+	}
+	return statuses[0].err
+}
+
+// LMTPData is Data with a reply per recipient (RFC 2033), so the relaying MTA
+// can bounce a bad verification address without failing the others.
+func (s *verifyMailboxSession) LMTPData(r io.Reader, status smtpcore.StatusCollector) error {
+	messageData, err := s.readData(r)
+	if err != nil {
+		return err
+	}
+	statuses, authErr := s.deliver(messageData)
+	for _, st := range statuses {
+		status.SetStatus(st.addr, st.err)
+	}
+	return authErr
+}
+
+func (s *verifyMailboxSession) readData(r io.Reader) ([]byte, error) {
 	// Read message data for SPF/DKIM verification
 	messageData, err := readMessageData(r, s.maxMessageBytes)
 	if err != nil && err != io.EOF {
 		logging.WarnLog("SMTP DATA: error reading message from=%s: %v", s.remoteAddr, err)
-		return &smtpcore.SMTPError{Code: 451, EnhancedCode: smtpcore.EnhancedCode{4, 3, 0}, Message: "error reading message"}
+		return nil, &smtpcore.SMTPError{Code: 451, EnhancedCode: smtpcore.EnhancedCode{4, 3, 0}, Message: "error reading message"}
 	}
 
 	if int64(len(messageData)) >= s.maxMessageBytes {
 		logging.WarnLog("SMTP DATA: message size limit exceeded from=%s", s.remoteAddr)
 	}
+	return messageData, nil
+}
+
+// recipientStatus is the delivery outcome for one accepted recipient.
+type recipientStatus struct {
+	addr string
+	err  error
+}
+
+var (
+	errNoNonce       = &smtpcore.SMTPError{Code: 550, EnhancedCode: smtpcore.EnhancedCode{5, 1, 1}, Message: "No verification nonce found"}
+	errInvalidNonce  = &smtpcore.SMTPError{Code: 550, EnhancedCode: smtpcore.EnhancedCode{5, 1, 1}, Message: "Invalid verification nonce"}
+	errUTF8Required  = &smtpcore.SMTPError{Code: 553, EnhancedCode: smtpcore.EnhancedCode{5, 6, 7}, Message: "Non-ASCII address requires SMTPUTF8"}
+	errOriginBlocked = &smtpcore.SMTPError{Code: 550, EnhancedCode: smtpcore.EnhancedCode{5, 7, 1}, Message: "Originating host blocked by DNS blocklist"}
+
+	// Verdicts of nonce processing, returned to the sender in synchronous
+	// mode. None of them tells an unknown nonce apart from an expired one.
+	errInvalidSender        = &smtpcore.SMTPError{Code: 550, EnhancedCode: smtpcore.EnhancedCode{5, 1, 7}, Message: "Invalid sender address"}
+	errVerifyRateLimited    = &smtpcore.SMTPError{Code: 450, EnhancedCode: smtpcore.EnhancedCode{4, 7, 1}, Message: "Too many verification attempts, try again later"}
+	errVerifyExpired        = &smtpcore.SMTPError{Code: 550, EnhancedCode: smtpcore.EnhancedCode{5, 7, 1}, Message: "Verification expired"}
+	errPredatesRegistration = &smtpcore.SMTPError{Code: 550, EnhancedCode: smtpcore.EnhancedCode{5, 7, 1}, Message: "Message is dated before the registration was opened"}
+	errSenderMismatch       = &smtpcore.SMTPError{Code: 550, EnhancedCode: smtpcore.EnhancedCode{5, 7, 1}, Message: "Sender does not match pending registration"}
+	errHeaderFromMismatch   = &smtpcore.SMTPError{Code: 550, EnhancedCode: smtpcore.EnhancedCode{5, 7, 1}, Message: "From header does not match pending registration"}
+	errVerifyUnavailable    = &smtpcore.SMTPError{Code: 451, EnhancedCode: smtpcore.EnhancedCode{4, 3, 0}, Message: "Verification temporarily unavailable"}
+)
 
+// deliver authenticates a received message and hands each recipient's nonce to
+// processVerifyNonce on the SMTP pool. It returns a status per recipient and
+// the message-level rejection, if any, then resets the transaction.
+func (s *verifyMailboxSession) deliver(messageData []byte) ([]recipientStatus, error) {
 	s.messageData = messageData
 
-	// Perform SPF/DKIM verification if not in unrestricted mode
-	if s.verifyMode != "unrestricted" {
-		// Extract sender IP from remote address
-		senderIP := s.remoteAddr
-		if idx := strings.LastIndex(senderIP, ":"); idx >= 0 {
-			senderIP = senderIP[:idx]
+	// Bounces and auto-replies are accepted and discarded so nothing answers
+	// them and they never count as a verification
+	if reason := automatedReason(s.nullSender, messageData); reason != "" {
+		logging.InfoLog("SMTP DATA dropped: reason=%s sender=[%s] from=%s", reason, utils.HashEmail(s.from), s.remoteAddr)
+		metrics.SMTPDropped.WithLabelValues(reason).Inc()
+		statuses := make([]recipientStatus, len(s.recipients))
+		for i, rcpt := range s.recipients {
+			statuses[i] = recipientStatus{addr: rcpt.addr}
 		}
-		// Remove brackets from IPv6 addresses
-		senderIP = strings.Trim(senderIP, "[]")
-
-		var spfResult SPFResult = SPFNone
-		var dkimResult DKIMResult = DKIMNone
-		var verificationFailed bool
-
-		// Perform SPF check
-		if s.spfEnabled && s.from != "" {
-			ctx := context.Background()
-			spfResult, err = s.spfChecker.CheckSPF(ctx, senderIP, s.from)
-			if err != nil {
-				logging.WarnLog("SMTP SPF check error for from=%s ip=%s: %v", utils.HashEmail(s.from), senderIP, err)
-			}
+		return statuses, nil
+	}
 
-			if spfResult == SPFFail || spfResult == SPFSoftFail {
-				verificationFailed = true
-				if s.verifyMode == "warn" {
-					logging.WarnLog("SMTP SPF verification failed (mode=warn): from=[%s] ip=%s result=%s",
-						utils.HashEmail(s.from), senderIP, spfResult.String())
-				} else if s.verifyMode == "strict" {
-					logging.WarnLog("SMTP SPF verification failed (mode=strict): from=[%s] ip=%s result=%s - rejecting",
-						utils.HashEmail(s.from), senderIP, spfResult.String())
-					return &smtpcore.SMTPError{
-						Code:         550,
-						EnhancedCode: smtpcore.EnhancedCode{5, 7, 1},
-						Message:      "SPF verification failed",
-					}
-				}
-			} else {
-				logging.DebugLog("SMTP SPF check passed: from=[%s] ip=%s result=%s",
-					utils.HashEmail(s.from), senderIP, spfResult.String())
+	// Behind a trusted relay the peer is our own MTA; judge the host it heard from
+	var listedErr error
+	if s.trustedRelay {
+		origin, ok := findRelayOrigin(messageData, s.relays, s.relayAuthIDs)
+		if h := s.handoff; h != nil {
+			// what the provider saw of the sender beats its own Received lines
+			if h.ip != "" {
+				origin.ip, origin.helo = h.ip, h.helo
+			}
+			if h.auth != nil {
+				origin.auth, origin.authServID = h.auth, h.authServID
 			}
+			ok = ok || origin.ip != "" || origin.auth != nil
 		}
+		if ok {
+			s.origin = &origin
+			logging.InfoLog("SMTP DATA via trusted relay: peer=%s origin=%s helo=%s", s.remoteAddr, origin.ip, origin.helo)
+			listedErr = s.checkOriginBlocklists(origin.ip)
+		} else {
+			logging.WarnLog("SMTP DATA via trusted relay without a readable untrusted hop: peer=%s", s.remoteAddr)
+		}
+	}
 
-		// Perform DKIM check
-		if s.dkimEnabled && len(s.messageData) > 0 {
-			ctx := context.Background()
-			dkimResult, err = s.dkimChecker.CheckDKIM(ctx, s.messageData)
-			if err != nil {
-				logging.WarnLog("SMTP DKIM check error for from=%s: %v", utils.HashEmail(s.from), err)
-			}
+	// The RFC 5322 author is what the user's client displays; it must match the
+	// pending registration just like the envelope sender.
+	headerFrom, err := parseHeaderFrom(messageData)
+	if err != nil {
+		logging.WarnLog("SMTP DATA: unusable From header from=%s: %v", s.remoteAddr, err)
+	}
 
-			if dkimResult == DKIMFail {
-				verificationFailed = true
-				if s.verifyMode == "warn" {
-					logging.WarnLog("SMTP DKIM verification failed (mode=warn): from=[%s] result=%s",
-						utils.HashEmail(s.from), dkimResult.String())
-				} else if s.verifyMode == "strict" {
-					logging.WarnLog("SMTP DKIM verification failed (mode=strict): from=[%s] result=%s - rejecting",
-						utils.HashEmail(s.from), dkimResult.String())
-					return &smtpcore.SMTPError{
-						Code:         550,
-						EnhancedCode: smtpcore.EnhancedCode{5, 7, 1},
-						Message:      "DKIM verification failed",
-					}
-				}
-			} else {
-				logging.DebugLog("SMTP DKIM check passed: from=[%s] result=%s",
-					utils.HashEmail(s.from), dkimResult.String())
-			}
-		}
+	// A copy of a message already seen is refused before any other check; a
+	// DKIM signature that still verifies proves nothing about the sender now
+	fields, _ := splitMessage(messageData)
+	replay := replayKeys(fields)
+	sentAt := claimedSendTime(fields)
 
-		// Log verification summary
-		if verificationFailed && s.verifyMode == "warn" {
-			logging.InfoLog("SMTP verification warning: from=[%s] ip=%s spf=%s dkim=%s - accepting anyway (mode=warn)",
-				utils.HashEmail(s.from), senderIP, spfResult.String(), dkimResult.String())
-		}
+	// Only read when something can act on it
+	var registration *models.EmailRegistration
+	if s.queue.registrar != nil {
+		registration = parseRegistration(messageData)
 	}
 
-	// Process each accepted verify address independently.
-	if len(s.recipients) == 0 {
-		return nil
+	var out authOutcome
+	var authErr error
+	if s.replayed(replay) {
+		logging.WarnLog("SMTP DATA rejected: replayed message sender=[%s] from=%s", utils.HashEmail(s.from), s.remoteAddr)
+		authErr = errReplayed
+	} else if listedErr != nil {
+		authErr = listedErr
+	} else {
+		// Perform SPF/DKIM/DMARC verification; unrestricted mode only records defaults
+		out, authErr = s.authenticate(context.Background(), headerFrom)
+		if authErr == nil {
+			authErr = s.applyPolicy(&out, headerFrom)
+		}
 	}
 
+	// Process each accepted verify address independently. A rejected message
+	// still leaves a report behind so the user can be told why.
+	statuses := make([]recipientStatus, 0, len(s.recipients))
+	verdicts := make(map[string]error)
+	retryable := false
 	for _, rcpt := range s.recipients {
-		local, dom := splitAddress(rcpt)
-		if !domainEquals(dom, s.domain) {
-			continue
+		token := rcpt.token
+		if rcpt.mode == addressMailbox {
+			token = extractNonceToken(messageData)
 		}
-		parts := strings.SplitN(local, "+", 2)
-		if len(parts) != 2 {
+		if token == "" {
+			logging.DebugLog("SMTP DATA: no nonce found for mode=%s from=%s", rcpt.mode, s.remoteAddr)
+			statuses = append(statuses, recipientStatus{rcpt.addr, errNoNonce})
 			continue
 		}
-		nonce := strings.TrimSpace(parts[1])
-		if nonce == "" {
+		// Catch typos and case rewriting before any lookup
+		nonceKey, err := nonce.Normalize(token, config.NonceAcceptLegacyHex())
+		if err != nil {
+			logging.DebugLog("SMTP DATA: malformed nonce mode=%s from=%s: %v", rcpt.mode, s.remoteAddr, err)
+			statuses = append(statuses, recipientStatus{rcpt.addr, errInvalidNonce})
 			continue
 		}
-
-		// Capture sender address to verify nonce ownership
-		senderEmail := s.from
-		remoteAddr := s.remoteAddr
-
-		// Process nonce asynchronously on SMTP pool with a bounded timeout.
-		_ = s.mgr.SubmitSMTP(func(ctx context.Context) {
-			// Bound total processing time per nonce
-			if !manager.RunWithTimeout(ctx, 5*time.Second, func(ctx context.Context) {
-				processVerifyNonce(ctx, nonce, senderEmail, remoteAddr, s.ttlStore, s.registry, s.rateLimiter)
-			}) {
-				logging.WarnLog("SMTP nonce processing timeout nonce=%s", utils.HashEmail(nonce))
+		verdict, done := verdicts[nonceKey]
+		if !done {
+			report := s.newReport(out, headerFrom)
+			if authErr != nil {
+				report.Decision, report.Reason = models.DecisionRejected, authErr.Error()
+			} else if len(out.review) > 0 {
+				report.Decision, report.Reason = models.DecisionReview, strings.Join(out.review, ", ")
 			}
-		})
+			verdict = s.processNonce(nonceKey, report, sentAt, registration)
+			verdicts[nonceKey] = verdict
+		}
+		if authErr != nil {
+			verdict = authErr
+		}
+		statuses = append(statuses, recipientStatus{rcpt.addr, verdict})
+		if verdict != nil && isTemporary(verdict) {
+			retryable = true
+		}
+	}
+	// A message the sender will retry is not yet a replay
+	if authErr == nil && !retryable {
+		s.rememberMessage(replay)
 	}
 	// Reset after processing to avoid repeated work across messages within same session
 	s.Reset()
+	return statuses, authErr
+}
+
+// checkOriginBlocklists gives the host a trusted relay heard from the DNSBL
+// treatment NewSession gives direct clients.
+func (s *verifyMailboxSession) checkOriginBlocklists(ip string) error {
+	if ip == "" {
+		return nil
+	}
+	hits := s.blocklists.CheckIP(context.Background(), ip)
+	if len(hits) == 0 {
+		return nil
+	}
+	action := strongestAction(hits)
+	logging.WarnLog("SMTP relay origin listed: action=%s zones=%s origin=%s peer=%s", action, describeHits(hits), ip, s.remoteAddr)
+	switch action {
+	case BlocklistReject:
+		return errOriginBlocked
+	case BlocklistEscalate:
+		s.escalated = true
+	}
 	return nil
 }
 
-func processVerifyNonce(_ context.Context, nonceStr string, senderEmail string, remoteAddr string, ttlStore *ephemeral.TTLStore, registry *controller.VerificationRegistry, rateLimiter *rateLimiter) {
+// processNonce queues one nonce for processing. In synchronous mode it waits
+// for the verdict so the reply can carry it; otherwise the sender only ever
+// sees the authentication result, or a temporary failure if the task could
+// not be stored.
+func (s *verifyMailboxSession) processNonce(nonceKey string, report models.VerificationReport, sentAt time.Time, registration *models.EmailRegistration) error {
+	t := models.VerifyTask{Nonce: nonceKey, Report: report, SentAt: sentAt, Registration: registration}
+	return s.queue.submit(t, s.syncVerdicts)
+}
+
+func isTemporary(err error) bool {
+	var smtpErr *smtpcore.SMTPError
+	return errors.As(err, &smtpErr) && smtpErr.Temporary()
+}
+
+// recordRejection keeps the report of a refused message for a pending registration.
+func recordRejection(nonceStr string, report models.VerificationReport, ttlStore controller.ProofStore) {
+	if _, pending := ttlStore.Get("expected:" + nonceStr); !pending {
+		return
+	}
+	if err := controller.SaveReport(ttlStore, nonceStr, report); err != nil {
+		logging.ErrorLog("SMTP report store failed nonce=[%s]: %v", utils.HashEmail(nonceStr), err)
+	}
+}
+
+// processVerifyNonce matches a message against the registration waiting on
+// nonceStr and stores the proof. It returns nil on success, or the verdict
+// to give the sender.
+func processVerifyNonce(_ context.Context, nonceStr string, report models.VerificationReport, sentAt time.Time, ttlStore controller.ProofStore, registry controller.Notifier, rateLimiter *rateLimiter) error {
 	// Normalize sender email
-	senderEmail = strings.ToLower(strings.TrimSpace(senderEmail))
-	// Strip angle brackets if present
-	senderEmail = strings.Trim(senderEmail, "<>")
-	senderEmail = strings.TrimSpace(senderEmail)
+	senderEmail := normalizeEmail(report.EnvelopeFrom)
+	remoteAddr := report.RemoteIP
 
 	if senderEmail == "" {
 		logging.WarnLog("SMTP verify failed: invalid sender email from=%s", remoteAddr)
-		return
+		return errInvalidSender
+	}
+
+	// A task replayed from the work queue may have run before a crash; only
+	// the wake-up is repeated, and it is harmless if nobody is waiting
+	proof, ok, err := ttlStore.Lookup(nonceStr)
+	if err != nil {
+		logging.ErrorLog("SMTP verify deferred: proof store unavailable nonce=[%s]: %v", utils.HashEmail(nonceStr), err)
+		return errVerifyUnavailable
+	}
+	if ok && proof == senderEmail {
+		logging.DebugLog("SMTP verify: proof already stored nonce=[%s]", utils.HashEmail(nonceStr))
+		registry.Notify(nonceStr)
+		return nil
 	}
 
 	// Apply rate limiting per sender email to prevent brute force attacks
 	if !rateLimiter.allow(senderEmail) {
 		logging.WarnLog("SMTP verify failed: rate limit exceeded [%s] from=%s", utils.HashEmail(senderEmail), remoteAddr)
-		return
+		return errVerifyRateLimited
 	}
 
 	emailHash := utils.HashEmail(senderEmail)
@@ -294,28 +533,74 @@ func processVerifyNonce(_ context.Context, nonceStr string, senderEmail string,
 
 	// Verify sender email matches expected email from registration request
 	expectedEmailKey := "expected:" + nonceStr
-	expectedEmail, exists := ttlStore.Get(expectedEmailKey)
+	expectedEmail, exists, err := ttlStore.Lookup(expectedEmailKey)
+	if err != nil {
+		// An outage must not read as an expired registration; the task is retried
+		logging.ErrorLog("SMTP verify deferred: proof store unavailable nonce=[%s]: %v", nonceHash, err)
+		return errVerifyUnavailable
+	}
 	if !exists {
 		logging.WarnLog("SMTP verify failed: no registration pending for nonce [%s]", nonceHash)
-		return
+		return errVerifyExpired
+	}
+
+	// From here on a registration is waiting, so every outcome is reported
+	saveReport := func(decision, reason string) {
+		report.Decision, report.Reason = decision, reason
+		if err := controller.SaveReport(ttlStore, nonceStr, report); err != nil {
+			logging.ErrorLog("SMTP report store failed nonce=[%s]: %v", nonceHash, err)
+		}
+	}
+
+	// A message written before the registration opened was meant for
+	// something else, however well it authenticates
+	if issued, ok := controller.LoadIssued(ttlStore, nonceStr); ok && !sentAt.IsZero() &&
+		sentAt.Before(issued.Add(-config.SMTPReplayClockSkew())) {
+		logging.WarnLog("SMTP verify failed: message dated %s predates registration opened %s nonce=[%s]",
+			sentAt.UTC().Format(time.RFC3339), issued.UTC().Format(time.RFC3339), nonceHash)
+		saveReport(models.DecisionFailed, "message is dated before the registration was opened")
+		return errPredatesRegistration
 	}
 
 	// Normalize expected email for comparison
-	expectedEmail = strings.ToLower(strings.TrimSpace(expectedEmail))
+	expectedEmail = normalizeEmail(expectedEmail)
 
 	if senderEmail != expectedEmail {
 		logging.WarnLog("SMTP verify failed: email mismatch sender=[%s] expected=[%s] nonce=[%s]",
 			utils.HashEmail(senderEmail), utils.HashEmail(expectedEmail), nonceHash)
-		return
+		saveReport(models.DecisionFailed, "envelope sender does not match the registration email")
+		return errSenderMismatch
+	}
+
+	// The header From must name the same mailbox, otherwise a message could pass
+	// envelope checks while displaying someone else's address.
+	headerFrom := normalizeEmail(report.HeaderFrom)
+	if headerFrom != expectedEmail {
+		logging.WarnLog("SMTP verify failed: header From mismatch header_from=[%s] expected=[%s] nonce=[%s]",
+			utils.HashEmail(headerFrom), utils.HashEmail(expectedEmail), nonceHash)
+		saveReport(models.DecisionFailed, "header From does not match the registration email")
+		return errHeaderFromMismatch
 	}
 
 	logging.DebugLog("SMTP verify: sender validated [%s] nonce=[%s]", emailHash, nonceHash)
 
+	// A soft failure leaves no proof; the API parks the registration for an
+	// administrator once the report wakes it
+	if report.Decision == models.DecisionReview {
+		saveReport(models.DecisionReview, report.Reason)
+		registry.Notify(nonceStr)
+		logging.InfoLog("SMTP verify held for review [%s] nonce=[%s]: %s", emailHash, nonceHash, report.Reason)
+		return nil
+	}
+
+	// The report must be in place before the proof, which is what the API waits on
+	saveReport(models.DecisionAccepted, "")
+
 	// CRITICAL: Store the verified email in TTLStore BEFORE firing the interrupt
 	// The API handler will wake up and immediately check this mapping
 	if err := ttlStore.SetWithValue(nonceStr, senderEmail, 3*time.Minute); err != nil {
 		logging.ErrorLog("SMTP verify failed: ttl store [%s] nonce=[%s]: %v", emailHash, nonceHash, err)
-		return
+		return errVerifyUnavailable
 	}
 
 	logging.DebugLog("SMTP verify: stored proof [%s] nonce=[%s]", emailHash, nonceHash)
@@ -323,7 +608,8 @@ func processVerifyNonce(_ context.Context, nonceStr string, senderEmail string,
 	// Now fire the interrupt to wake up the waiting HTTP handler
 	registry.Notify(nonceStr)
 
-	logging.InfoLog("SMTP verify success [%s] nonce=[%s]", emailHash, nonceHash)
+	logging.InfoLog("SMTP verify success [%s] nonce=[%s] tls=%s", emailHash, nonceHash, report.TLS)
+	return nil
 }
 
 // generateSecureNonce creates a cryptographically secure random nonce.
@@ -337,61 +623,198 @@ func generateSecureNonce() (string, error) {
 
 // Backend implements the SMTP Backend for go-smtp.
 type Backend struct {
-	ttlStore    *ephemeral.TTLStore
-	registry    *controller.VerificationRegistry
-	mgr         *manager.WorkManager
-	rateLimiter *rateLimiter
-	domain      string
-	spfChecker  *SPFChecker
-	dkimChecker *DKIMChecker
+	ttlStore     controller.ProofStore
+	registry     controller.Notifier
+	mgr          *manager.WorkManager
+	queue        *verifyQueue
+	rateLimiter  *rateLimiter
+	throttle     *throttle
+	blocklists   *BlocklistChecker
+	policy       *policyReloader
+	relays       []*net.IPNet
+	relayAuthIDs []string
+	domain       string
+	spfChecker   *SPFChecker
+	dkimChecker  *DKIMChecker
+	dmarcChecker *DMARCChecker
+}
+
+// BackendOption configures the Backend.
+type BackendOption func(*backendOptions)
+
+type backendOptions struct {
+	resolver  resolver.Resolver
+	queue     WorkQueue
+	registrar Registrar
+}
+
+// WithResolver routes all SPF, DKIM, DMARC and ARC lookups through res
+// instead of a resolver built from the DNS_* configuration.
+func WithResolver(res resolver.Resolver) BackendOption {
+	return func(o *backendOptions) { o.resolver = res }
+}
+
+// WithWorkQueue persists every accepted nonce in q before the sender is
+// acknowledged. Call StartQueue to replay what a previous process left.
+func WithWorkQueue(q WorkQueue) BackendOption {
+	return func(o *backendOptions) { o.queue = q }
 }
 
-func NewBackend(ttl *ephemeral.TTLStore, registry *controller.VerificationRegistry, mgr *manager.WorkManager, domain string) *Backend {
+func NewBackend(ttl controller.ProofStore, registry controller.Notifier, mgr *manager.WorkManager, domain string, opts ...BackendOption) *Backend {
+	o := &backendOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.resolver == nil {
+		o.resolver = resolver.New()
+	}
+	var policy *policyReloader
+	if file := config.SMTPPolicyFile(); file != "" {
+		var err error
+		if policy, err = newPolicyReloader(file, config.SMTPPolicyReloadInterval()); err != nil {
+			logging.ErrorLog("SMTP sender policy disabled: %v", err)
+		} else {
+			logging.InfoLog("SMTP sender policy loaded from %s (%d rules)", file, len(policy.current().Rules))
+		}
+	}
+	relays, err := parseNetworks(config.SMTPTrustedRelays())
+	if err != nil {
+		logging.ErrorLog("SMTP trusted relays disabled: %v", err)
+		relays = nil
+	}
+	blocklists := NewBlocklistChecker(o.resolver, ParseBlocklistZones(config.SMTPDNSBLZones()),
+		ParseBlocklistZones(config.SMTPRHSBLZones()), config.SMTPBlocklistTimeout())
+	rl := newRateLimiter(10, 5*time.Minute)
 	return &Backend{
-		ttlStore:    ttl,
-		registry:    registry,
-		mgr:         mgr,
-		rateLimiter: newRateLimiter(10, 5*time.Minute),
-		domain:      domain,
-		spfChecker:  NewSPFChecker(),
-		dkimChecker: NewDKIMChecker(),
+		ttlStore:     ttl,
+		registry:     registry,
+		mgr:          mgr,
+		queue:        newVerifyQueue(o.queue, ttl, registry, rl, o.registrar, mgr),
+		rateLimiter:  rl,
+		throttle:     newThrottle(),
+		blocklists:   blocklists,
+		policy:       policy,
+		relays:       relays,
+		relayAuthIDs: config.SMTPTrustedRelayAuthServIDs(),
+		domain:       domain,
+		spfChecker:   NewSPFChecker(o.resolver),
+		dkimChecker:  NewDKIMChecker(o.resolver),
+		dmarcChecker: NewDMARCChecker(o.resolver),
 	}
 }
 
+// StartQueue replays nonces left in the work queue by an earlier process and
+// then keeps retrying those that fall due. It does nothing without a queue.
+func (b *Backend) StartQueue() {
+	b.queue.start()
+}
+
+// StopQueue halts replaying; nonces still queued wait for the next start.
+func (b *Backend) StopQueue() {
+	b.queue.stopLoop()
+}
+
 func (b *Backend) NewSession(c *smtpcore.Conn) (smtpcore.Session, error) {
 	// Extract remote address for logging and rate limiting
 	ra := "unknown"
-	if c.Conn() != nil {
+	if c.Server().LMTP {
+		ra = "lmtp"
+	} else if c.Conn() != nil {
 		ra = c.Conn().RemoteAddr().String()
 	}
-	sess := &verifyMailboxSession{
+	ip := hostFromAddr(ra)
+	// Trusted relays carry everyone's mail, so per-IP limits would be global.
+	// LMTP clients are always the local MTA and are treated the same way.
+	lmtp := c.Server().LMTP
+	relay := lmtp || containsIP(b.relays, net.ParseIP(ip))
+	verifyMode := config.SMTPVerificationMode()
+	// The session after STARTTLS belongs to a connection already checked
+	if cc := checkedConnOf(c.Conn()); cc != nil && cc.checked {
+		verifyMode = cc.verifyMode
+	} else {
+		if !relay && !b.throttle.connRate.allow(ip) {
+			logging.WarnLog("SMTP session refused: per-IP connection rate exceeded from=%s", ra)
+			return nil, &smtpcore.SMTPError{Code: 421, EnhancedCode: smtpcore.EnhancedCode{4, 7, 0}, Message: "Too many connections, try again later"}
+		}
+		if relay {
+			logging.DebugLog("SMTP session from trusted relay %s", ra)
+		} else if hits := b.blocklists.CheckIP(context.Background(), ip); len(hits) > 0 {
+			action := strongestAction(hits)
+			logging.WarnLog("SMTP client listed: action=%s zones=%s from=%s", action, describeHits(hits), ra)
+			switch action {
+			case BlocklistReject:
+				return nil, &smtpcore.SMTPError{Code: 554, EnhancedCode: smtpcore.EnhancedCode{5, 7, 1}, Message: "Client host blocked by DNS blocklist"}
+			case BlocklistEscalate:
+				verifyMode = "strict"
+			}
+		}
+		if cc != nil {
+			cc.checked, cc.verifyMode = true, verifyMode
+		}
+	}
+	if !relay && !b.throttle.conns.acquire(ip) {
+		logging.WarnLog("SMTP session refused: per-IP concurrency cap reached from=%s", ra)
+		return nil, &smtpcore.SMTPError{Code: 421, EnhancedCode: smtpcore.EnhancedCode{4, 7, 0}, Message: "Too many concurrent connections"}
+	}
+	// go-smtp opens a fresh session after STARTTLS, so this reflects the upgrade
+	tlsVersion := tlsVersionName(c.TLSConnectionState())
+	return b.newSession(ra, ip, relay, lmtp, verifyMode, c.Hostname(), tlsVersion), nil
+}
+
+// newSession builds a session for a client that has passed the connection checks.
+func (b *Backend) newSession(ra, ip string, relay, lmtp bool, verifyMode, helo, tlsVersion string) *verifyMailboxSession {
+	addressing := newAddressing(b.domain, config.SMTPRecipientPrefix(),
+		config.SMTPAddressSeparators(), config.SMTPAddressingModes())
+	return &verifyMailboxSession{
 		remoteAddr:      ra,
 		ttlStore:        b.ttlStore,
 		registry:        b.registry,
 		mgr:             b.mgr,
+		queue:           b.queue,
 		rateLimiter:     b.rateLimiter,
+		throttle:        b.throttle,
+		clientIP:        ip,
+		released:        relay,
+		trustedRelay:    relay,
+		lmtp:            lmtp,
+		relays:          b.relays,
+		relayAuthIDs:    b.relayAuthIDs,
 		maxRecipients:   config.SMTPMaxRecipients(),
 		maxMessageBytes: int64(config.SMTPMaxMessageBytes()),
 		domain:          b.domain,
-		recipientPrefix: config.SMTPRecipientPrefix(),
+		addressing:      addressing,
 		spfChecker:      b.spfChecker,
 		dkimChecker:     b.dkimChecker,
-		verifyMode:      config.SMTPVerificationMode(),
+		dmarcChecker:    b.dmarcChecker,
+		arcSealers:      config.SMTPARCTrustedSealers(),
+		blocklists:      b.blocklists,
+		policy:          b.policy.current(),
+		verifyMode:      verifyMode,
 		spfEnabled:      config.SMTPSPFEnabled(),
 		dkimEnabled:     config.SMTPDKIMEnabled(),
+		dmarcEnabled:    config.SMTPDMARCEnabled(),
+		requireTLS:      config.SMTPRequireTLS(),
+		replayWindow:    config.SMTPReplayWindow(),
+		syncVerdicts:    config.SMTPSyncVerdicts(),
+		helo:            helo,
+		tlsVersion:      tlsVersion,
 	}
-	return sess, nil
 }
 
 // Server wraps go-smtp server with configuration.
 type Server struct {
 	*smtpcore.Server
-	ln net.Listener
+	ln       net.Listener
+	tlsLn    net.Listener
+	reloader *certReloader
+	backend  *Backend
+	lmtp     *smtpcore.Server
+	lmtpLn   net.Listener
 }
 
 // NewServer constructs and configures the verification SMTP server.
 func NewServer(b *Backend) *Server {
-	s := &Server{Server: smtpcore.NewServer(b)}
+	s := &Server{Server: smtpcore.NewServer(b), backend: b}
 	s.Server.Addr = config.SMTPListenAddr()
 	s.Server.Domain = config.SMTPDomain()
 	s.Server.ReadTimeout = 10 * time.Second
@@ -399,18 +822,64 @@ func NewServer(b *Backend) *Server {
 	s.Server.MaxMessageBytes = int64(config.SMTPMaxMessageBytes())
 	s.Server.MaxRecipients = config.SMTPMaxRecipients()
 	s.Server.AllowInsecureAuth = false
+	// go-smtp always advertises 8BITMIME; SMTPUTF8 admits RFC 6531 addresses
+	s.Server.EnableSMTPUTF8 = true
+
+	// Setting TLSConfig makes go-smtp advertise STARTTLS
+	certFile, keyFile := config.SMTPTLSCertFile(), config.SMTPTLSKeyFile()
+	if certFile != "" && keyFile != "" {
+		reloader, err := newCertReloader(certFile, keyFile, config.SMTPTLSReloadInterval())
+		if err != nil {
+			logging.ErrorLog("SMTP TLS disabled: %v", err)
+		} else {
+			s.reloader = reloader
+			s.Server.TLSConfig = reloader.tlsConfig()
+		}
+	}
 	return s
 }
 
 // Start begins listening in a separate goroutine.
 func (s *Server) Start() error {
+	if s.Server.Addr != "off" {
+		if err := s.startPlain(); err != nil {
+			return err
+		}
+	}
+	if err := s.startTLS(); err != nil {
+		return err
+	}
+	if path := config.SMTPLMTPSocket(); path != "" {
+		if err := s.startLMTP(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) startPlain() error {
 	ln, err := net.Listen("tcp", s.Server.Addr)
 	if err != nil {
 		return fmt.Errorf("smtp listen failed: %w", err)
 	}
+	trusted := config.SMTPProxyTrustedCIDRs()
+	if len(trusted) > 0 {
+		proxied, err := newProxyListener(ln, trusted, config.SMTPProxyHeaderTimeout())
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		ln = proxied
+		logging.InfoLog("SMTP PROXY protocol accepted from %s", strings.Join(trusted, ","))
+	}
+	if d := config.SMTPGreetDelay(); d > 0 {
+		ln = newGreetDelayListener(ln, d)
+		logging.InfoLog("SMTP greeting delay enabled: %s", d)
+	}
+	ln = checkedListener{ln}
 	s.ln = ln
 	go func() {
-		logging.InfoLog("SMTP server listening on %s (domain=%s)", s.Server.Addr, s.Server.Domain)
+		logging.InfoLog("SMTP server listening on %s (domain=%s, starttls=%t)", ln.Addr(), s.Server.Domain, s.Server.TLSConfig != nil)
 		if err := s.Server.Serve(ln); err != nil {
 			logging.ErrorLog("SMTP server stopped: %v", err)
 		}
@@ -418,6 +887,95 @@ func (s *Server) Start() error {
 	return nil
 }
 
+func (s *Server) startTLS() error {
+	addr := config.SMTPTLSListenAddr()
+	if addr == "" {
+		return nil
+	}
+	if s.Server.TLSConfig == nil {
+		logging.ErrorLog("SMTP implicit TLS listener on %s skipped: no certificate configured", addr)
+		return nil
+	}
+	raw, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("smtp tls listen failed: %w", err)
+	}
+	if trusted := config.SMTPProxyTrustedCIDRs(); len(trusted) > 0 {
+		proxied, err := newProxyListener(raw, trusted, config.SMTPProxyHeaderTimeout())
+		if err != nil {
+			raw.Close()
+			return err
+		}
+		raw = proxied
+	}
+	s.tlsLn = tls.NewListener(checkedListener{raw}, s.Server.TLSConfig)
+	go func() {
+		logging.InfoLog("SMTP implicit TLS listening on %s", s.tlsLn.Addr())
+		if err := s.Server.Serve(s.tlsLn); err != nil {
+			logging.ErrorLog("SMTP implicit TLS server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// startLMTP serves the same backend over LMTP on a Unix socket, for MTAs that
+// hand verification mail to zinc through a local transport.
+func (s *Server) startLMTP(path string) error {
+	// A socket left behind by an unclean shutdown would make Listen fail
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("lmtp listen failed: %w", err)
+	}
+	if err := os.Chmod(path, config.SMTPLMTPSocketMode()); err != nil {
+		ln.Close()
+		return fmt.Errorf("lmtp socket permissions: %w", err)
+	}
+
+	s.lmtp = smtpcore.NewServer(s.backend)
+	s.lmtp.LMTP = true
+	s.lmtp.Domain = s.Server.Domain
+	s.lmtp.ReadTimeout = s.Server.ReadTimeout
+	s.lmtp.WriteTimeout = s.Server.WriteTimeout
+	s.lmtp.MaxMessageBytes = s.Server.MaxMessageBytes
+	s.lmtp.MaxRecipients = s.Server.MaxRecipients
+	s.lmtp.EnableSMTPUTF8 = true
+	s.lmtpLn = ln
+	go func() {
+		logging.InfoLog("LMTP server listening on %s (domain=%s)", path, s.lmtp.Domain)
+		if err := s.lmtp.Serve(ln); err != nil {
+			logging.ErrorLog("LMTP server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// ListenAddr returns the bound address of the plaintext/STARTTLS listener.
+func (s *Server) ListenAddr() net.Addr {
+	if s == nil || s.ln == nil {
+		return nil
+	}
+	return s.ln.Addr()
+}
+
+// TLSListenAddr returns the bound address of the implicit TLS listener, if any.
+func (s *Server) TLSListenAddr() net.Addr {
+	if s == nil || s.tlsLn == nil {
+		return nil
+	}
+	return s.tlsLn.Addr()
+}
+
+// LMTPAddr returns the bound address of the LMTP socket, if any.
+func (s *Server) LMTPAddr() net.Addr {
+	if s == nil || s.lmtpLn == nil {
+		return nil
+	}
+	return s.lmtpLn.Addr()
+}
+
 // Stop gracefully shuts down the server.
 func (s *Server) Stop() {
 	if s == nil {
@@ -426,20 +984,49 @@ func (s *Server) Stop() {
 	if s.ln != nil {
 		_ = s.ln.Close()
 	}
+	if s.tlsLn != nil {
+		_ = s.tlsLn.Close()
+	}
+	if s.lmtpLn != nil {
+		_ = s.lmtpLn.Close()
+	}
+	s.reloader.stop()
+	s.backend.policy.stop()
 }
 
 // Helper utilities
+
+// splitAddress returns the local part and the domain of addr, the domain as
+// A-labels when it is a valid IDN so lookups and comparisons see one form.
 func splitAddress(addr string) (local, domain string) {
 	addr = strings.TrimSpace(addr)
 	// Strip angle brackets if present (e.g., <user@domain> -> user@domain)
 	addr = strings.Trim(addr, "<>")
 	addr = strings.TrimSpace(addr)
 	if i := strings.LastIndex(addr, "@"); i >= 0 {
-		return addr[:i], addr[i+1:]
+		return addr[:i], asciiDomain(addr[i+1:])
 	}
 	return addr, ""
 }
 
+// asciiDomain converts domain to A-labels, leaving anything that is not a
+// valid IDN, such as an address literal, as it was.
+func asciiDomain(domain string) string {
+	if ascii, err := utils.ASCIIDomain(domain); err == nil {
+		return ascii
+	}
+	return domain
+}
+
 func domainEquals(a, b string) bool {
-	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+	return strings.EqualFold(asciiDomain(strings.TrimSpace(a)), asciiDomain(strings.TrimSpace(b)))
+}
+
+// normalizeEmail is utils.NormalizeEmail for addresses taken off the wire,
+// which are compared lower-cased as before when they do not normalize.
+func normalizeEmail(addr string) string {
+	if n, err := utils.NormalizeEmail(addr); err == nil {
+		return n
+	}
+	return strings.ToLower(strings.TrimSpace(addr))
 }
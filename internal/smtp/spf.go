@@ -6,6 +6,7 @@ import (
 
 	"blitiri.com.ar/go/spf"
 	"github.com/Goofygiraffe06/zinc/internal/logging"
+	"github.com/Goofygiraffe06/zinc/internal/resolver"
 )
 
 // SPFResult represents the result of an SPF check.
@@ -43,11 +44,13 @@ func (r SPFResult) String() string {
 }
 
 // using the blitiri.com.ar/go/spf library.
-type SPFChecker struct{}
+type SPFChecker struct {
+	resolver resolver.Resolver
+}
 
-// NewSPFChecker creates a new SPF checker.
-func NewSPFChecker() *SPFChecker {
-	return &SPFChecker{}
+// NewSPFChecker creates a new SPF checker that queries DNS through res.
+func NewSPFChecker(res resolver.Resolver) *SPFChecker {
+	return &SPFChecker{resolver: res}
 }
 
 func (s *SPFChecker) CheckSPF(ctx context.Context, senderIP, senderEmail string) (SPFResult, error) {
@@ -58,7 +61,8 @@ func (s *SPFChecker) CheckSPF(ctx context.Context, senderIP, senderEmail string)
 		return SPFNone, nil
 	}
 
-	result, err := spf.CheckHostWithSender(ip, senderEmail, senderEmail)
+	result, err := spf.CheckHostWithSender(ip, senderEmail, senderEmail,
+		spf.WithContext(ctx), spf.WithResolver(s.resolver))
 
 	// Map library result to our result type
 	var spfResult SPFResult
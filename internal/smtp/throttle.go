@@ -0,0 +1,281 @@
+package smtpserver
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/config"
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+)
+
+// connTracker counts concurrent SMTP sessions per client IP.
+type connTracker struct {
+	mu    sync.Mutex
+	conns map[string]int
+	max   int
+}
+
+func newConnTracker(max int) *connTracker {
+	return &connTracker{conns: make(map[string]int), max: max}
+}
+
+// acquire reserves a slot for ip, reporting false when it is already at the cap.
+func (t *connTracker) acquire(ip string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conns[ip] >= t.max {
+		return false
+	}
+	t.conns[ip]++
+	return true
+}
+
+func (t *connTracker) release(ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conns[ip] <= 1 {
+		delete(t.conns, ip)
+		return
+	}
+	t.conns[ip]--
+}
+
+// greylistEntry tracks one ip/sender/recipient triplet.
+type greylistEntry struct {
+	firstSeen time.Time
+	passed    time.Time
+}
+
+// greylist defers the first delivery attempt of unseen triplets. Legitimate
+// MTAs retry; most spam engines do not.
+type greylist struct {
+	mu      sync.Mutex
+	entries map[string]*greylistEntry
+	delay   time.Duration
+	window  time.Duration
+	ttl     time.Duration
+}
+
+func newGreylist(delay, window, ttl time.Duration) *greylist {
+	g := &greylist{
+		entries: make(map[string]*greylistEntry),
+		delay:   delay,
+		window:  window,
+		ttl:     ttl,
+	}
+	go g.cleanup()
+	return g
+}
+
+// check records an attempt and reports whether it may proceed, along with the
+// time left before a retry will be accepted when it may not.
+func (g *greylist) check(ip, from, rcpt string) (bool, time.Duration) {
+	key := greylistNetwork(ip) + "|" + strings.ToLower(from) + "|" + strings.ToLower(rcpt)
+	now := time.Now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	e, ok := g.entries[key]
+	if ok && !e.passed.IsZero() && now.Sub(e.passed) < g.ttl {
+		return true, 0
+	}
+	if !ok || now.Sub(e.firstSeen) > g.window {
+		g.entries[key] = &greylistEntry{firstSeen: now}
+		return false, g.delay
+	}
+	if wait := g.delay - now.Sub(e.firstSeen); wait > 0 {
+		return false, wait
+	}
+	e.passed = now
+	return true, 0
+}
+
+func (g *greylist) cleanup() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		g.mu.Lock()
+		for key, e := range g.entries {
+			if e.passed.IsZero() && now.Sub(e.firstSeen) > g.window {
+				delete(g.entries, key)
+			} else if !e.passed.IsZero() && now.Sub(e.passed) > g.ttl {
+				delete(g.entries, key)
+			}
+		}
+		g.mu.Unlock()
+	}
+}
+
+// greylistNetwork widens ip to its /24 (IPv4) or /64 (IPv6) so retries from a
+// provider's outbound pool are recognized as the same sender.
+func greylistNetwork(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(64, 128)).String()
+}
+
+// tarpitDelay is the pause before answering the n-th invalid recipient.
+func tarpitDelay(n int, step, max time.Duration) time.Duration {
+	if step <= 0 || n <= 0 {
+		return 0
+	}
+	d := time.Duration(n) * step
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// checkedConn carries the outcome of the per-connection checks in NewSession.
+// go-smtp opens a second session on the EHLO after STARTTLS; finding the
+// connection already checked, that session neither charges the connection
+// rate again nor repeats the DNSBL lookup.
+type checkedConn struct {
+	net.Conn
+	checked    bool
+	verifyMode string
+}
+
+// checkedListener wraps every accepted connection in a checkedConn.
+type checkedListener struct {
+	net.Listener
+}
+
+func (l checkedListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &checkedConn{Conn: c}, nil
+}
+
+// checkedConnOf finds the checkedConn under c, looking through the TLS layer
+// STARTTLS adds. It returns nil for connections from other listeners.
+func checkedConnOf(c net.Conn) *checkedConn {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	cc, _ := c.(*checkedConn)
+	return cc
+}
+
+// greetDelayListener holds each accepted connection for delay before handing it
+// to the SMTP server, which then writes the 220 greeting. Clients that send
+// anything during the delay are rejected and disconnected.
+type greetDelayListener struct {
+	net.Listener
+	delay time.Duration
+	conns chan net.Conn
+	errc  chan error
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newGreetDelayListener(ln net.Listener, delay time.Duration) *greetDelayListener {
+	l := &greetDelayListener{
+		Listener: ln,
+		delay:    delay,
+		conns:    make(chan net.Conn),
+		errc:     make(chan error, 1),
+		done:     make(chan struct{}),
+	}
+	go l.acceptLoop()
+	return l
+}
+
+func (l *greetDelayListener) acceptLoop() {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			l.errc <- err
+			return
+		}
+		go l.hold(c)
+	}
+}
+
+func (l *greetDelayListener) hold(c net.Conn) {
+	if err := c.SetReadDeadline(time.Now().Add(l.delay)); err != nil {
+		c.Close()
+		return
+	}
+	var buf [1]byte
+	n, err := c.Read(buf[:])
+	if n > 0 {
+		logging.WarnLog("SMTP early talker rejected: client sent data before greeting from=%s", c.RemoteAddr())
+		_, _ = c.Write([]byte("554 5.5.0 SMTP protocol violation: data sent before greeting\r\n"))
+		c.Close()
+		return
+	}
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		c.Close()
+		return
+	}
+	if err := c.SetReadDeadline(time.Time{}); err != nil {
+		c.Close()
+		return
+	}
+	select {
+	case l.conns <- c:
+	case <-l.done:
+		c.Close()
+	}
+}
+
+func (l *greetDelayListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case err := <-l.errc:
+		return nil, err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *greetDelayListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// throttle bundles the connection-level abuse controls shared by all sessions.
+type throttle struct {
+	connRate   *rateLimiter
+	mailRate   *rateLimiter
+	conns      *connTracker
+	greylist   *greylist
+	tarpitStep time.Duration
+	tarpitMax  time.Duration
+}
+
+func newThrottle() *throttle {
+	window := config.SMTPThrottleWindow()
+	t := &throttle{
+		connRate:   newRateLimiter(config.SMTPConnRateLimit(), window),
+		mailRate:   newRateLimiter(config.SMTPMailRateLimit(), window),
+		conns:      newConnTracker(config.SMTPMaxConnsPerIP()),
+		tarpitStep: config.SMTPTarpitDelay(),
+		tarpitMax:  config.SMTPTarpitMaxDelay(),
+	}
+	if config.SMTPGreylistEnabled() {
+		t.greylist = newGreylist(config.SMTPGreylistDelay(), config.SMTPGreylistRetryWindow(), config.SMTPGreylistTTL())
+	}
+	return t
+}
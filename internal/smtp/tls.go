@@ -0,0 +1,71 @@
+package smtpserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/filewatch"
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+)
+
+// certReloader serves the current certificate to TLS handshakes and swaps it
+// in place when the files on disk change. A failed reload keeps the old pair.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+	watcher  *filewatch.Watcher
+}
+
+func newCertReloader(certFile, keyFile string, interval time.Duration) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	r.watcher = filewatch.New(interval, func() {
+		if err := r.reload(); err != nil {
+			logging.ErrorLog("SMTP TLS certificate reload failed, keeping previous certificate: %v", err)
+			return
+		}
+		logging.InfoLog("SMTP TLS certificate reloaded from %s", r.certFile)
+	}, certFile, keyFile)
+	r.watcher.Start()
+	return r, nil
+}
+
+func (r *certReloader) reload() error {
+	pair, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load key pair: %w", err)
+	}
+	r.cert.Store(&pair)
+	return nil
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+func (r *certReloader) stop() {
+	if r != nil {
+		r.watcher.Stop()
+	}
+}
+
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.getCertificate,
+	}
+}
+
+// tlsVersionName describes the negotiated transport for logs and policy;
+// "none" means the message arrived in plaintext.
+func tlsVersionName(state tls.ConnectionState, ok bool) string {
+	if !ok {
+		return "none"
+	}
+	return tls.VersionName(state.Version)
+}
@@ -0,0 +1,190 @@
+package smtpserver
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	"github.com/Goofygiraffe06/zinc/internal/utils"
+	smtpcore "github.com/emersion/go-smtp"
+)
+
+// authOutcome collects the authentication results for one message.
+type authOutcome struct {
+	senderIP    string
+	helo        string
+	spf         SPFResult
+	spfDomain   string
+	dkim        DKIMResult
+	dkimDomains []string
+	arc         ARCEvaluation
+	dmarc       DMARCEvaluation
+	policyRule  string
+	// review lists the soft failures that hold the message for an
+	// administrator in review mode.
+	review []string
+}
+
+// authenticate runs SPF, DKIM, ARC and DMARC for the current message and
+// applies the verification mode. A non-nil error is the SMTP rejection.
+// Unrestricted mode without a policy file skips the checks and reports every
+// result as none.
+func (s *verifyMailboxSession) authenticate(ctx context.Context, headerFrom string) (authOutcome, error) {
+	out := authOutcome{
+		senderIP: hostFromAddr(s.remoteAddr),
+		helo:     s.helo,
+		spf:      SPFNone,
+		dkim:     DKIMNone,
+		dmarc:    DMARCEvaluation{Result: DMARCNone},
+	}
+	if s.origin != nil {
+		out.senderIP, out.helo = s.origin.ip, s.origin.helo
+	}
+	_, out.spfDomain = splitAddress(s.from)
+	if s.mode() == "unrestricted" && s.policy == nil {
+		return out, nil
+	}
+	var err error
+
+	// A trusted relay already checked the message before it was relayed; a
+	// check it did not report is still run here
+	var up *UpstreamResults
+	if s.origin != nil && s.origin.auth != nil {
+		up = s.origin.auth
+		logging.InfoLog("SMTP using Authentication-Results from trusted relay authserv-id=%s: from=[%s] ip=%s spf=%s dkim=%s",
+			s.origin.authServID, utils.HashEmail(s.from), out.senderIP, up.SPF.String(), up.DKIM.String())
+		out.spf, out.dkim, out.dkimDomains = up.SPF, up.DKIM, up.DKIMDomain
+		if up.SPFDomain != "" {
+			out.spfDomain = up.SPFDomain
+		}
+	}
+
+	// Perform SPF check
+	if s.spfEnabled && s.from != "" && (up == nil || up.SPF == SPFNone) {
+		out.spf, err = s.spfChecker.CheckSPF(ctx, out.senderIP, s.from)
+		if err != nil {
+			logging.WarnLog("SMTP SPF check error for from=%s ip=%s: %v", utils.HashEmail(s.from), out.senderIP, err)
+		}
+	}
+
+	// Perform DKIM check, including the ARC chain forwarders add on top
+	if s.dkimEnabled && len(s.messageData) > 0 && (up == nil || up.DKIM == DKIMNone) {
+		out.dkim, out.dkimDomains, err = s.dkimChecker.CheckDKIM(ctx, s.messageData)
+		if err != nil {
+			logging.WarnLog("SMTP DKIM check error for from=%s: %v", utils.HashEmail(s.from), err)
+		}
+		out.arc = s.dkimChecker.CheckARC(ctx, s.messageData, s.arcSealers)
+		if out.arc.Result == ARCFail {
+			logging.DebugLog("SMTP ARC chain invalid: from=[%s] reason=%s", utils.HashEmail(s.from), out.arc.Reason)
+		}
+	}
+
+	// A trusted forwarder vouches for what it saw before it modified the message
+	if out.arc.Trusted {
+		up := out.arc.Upstream
+		if out.spf != SPFPass && up.SPF == SPFPass {
+			logging.InfoLog("SMTP SPF satisfied by trusted ARC sealer=%s: from=[%s] local=%s",
+				out.arc.Sealer, utils.HashEmail(s.from), out.spf.String())
+			out.spf, out.spfDomain = SPFPass, up.SPFDomain
+		}
+		if out.dkim != DKIMPass && up.DKIM == DKIMPass {
+			logging.InfoLog("SMTP DKIM satisfied by trusted ARC sealer=%s: from=[%s] local=%s",
+				out.arc.Sealer, utils.HashEmail(s.from), out.dkim.String())
+			out.dkim, out.dkimDomains = DKIMPass, up.DKIMDomain
+		}
+	}
+
+	// Perform DMARC evaluation for the header From domain
+	if s.dmarcEnabled && headerFrom != "" {
+		_, fromDomain := splitAddress(headerFrom)
+		out.dmarc, err = s.dmarcChecker.CheckDMARC(ctx, fromDomain, out.spf, out.spfDomain, out.dkimDomains)
+		if err != nil {
+			logging.WarnLog("SMTP DMARC check error for header_from=%s: %v", utils.HashEmail(headerFrom), err)
+		}
+		if out.dmarc.Result != DMARCPass && out.arc.Trusted && out.arc.Upstream.DMARC == DMARCPass {
+			logging.InfoLog("SMTP DMARC satisfied by trusted ARC sealer=%s: header_from=[%s] local=%s",
+				out.arc.Sealer, utils.HashEmail(headerFrom), out.dmarc.Result.String())
+			out.dmarc.Result = DMARCPass
+		}
+	}
+
+	err = s.applyVerifyMode(&out, headerFrom)
+	return out, err
+}
+
+// applyVerifyMode rejects failed checks in strict mode and logs them in warn
+// mode. Review mode rejects hard failures and records soft ones in out.review.
+func (s *verifyMailboxSession) applyVerifyMode(out *authOutcome, headerFrom string) error {
+	failed := false
+	mode := s.mode()
+	review := mode == "review"
+
+	if out.spf == SPFFail || out.spf == SPFSoftFail {
+		failed = true
+		if review && out.spf == SPFSoftFail {
+			out.review = append(out.review, "SPF softfail")
+		} else if mode == "strict" || review {
+			logging.WarnLog("SMTP SPF verification failed (mode=%s): from=[%s] ip=%s result=%s - rejecting",
+				mode, utils.HashEmail(s.from), out.senderIP, out.spf.String())
+			return &smtpcore.SMTPError{Code: 550, EnhancedCode: smtpcore.EnhancedCode{5, 7, 1}, Message: "SPF verification failed"}
+		}
+		logging.WarnLog("SMTP SPF verification failed (mode=%s): from=[%s] ip=%s result=%s",
+			mode, utils.HashEmail(s.from), out.senderIP, out.spf.String())
+	} else if s.spfEnabled {
+		logging.DebugLog("SMTP SPF check passed: from=[%s] ip=%s result=%s",
+			utils.HashEmail(s.from), out.senderIP, out.spf.String())
+	}
+
+	if out.dkim == DKIMFail {
+		failed = true
+		if review {
+			out.review = append(out.review, "DKIM fail")
+		} else if mode == "strict" {
+			logging.WarnLog("SMTP DKIM verification failed (mode=strict): from=[%s] result=%s - rejecting",
+				utils.HashEmail(s.from), out.dkim.String())
+			return &smtpcore.SMTPError{Code: 550, EnhancedCode: smtpcore.EnhancedCode{5, 7, 1}, Message: "DKIM verification failed"}
+		}
+		logging.WarnLog("SMTP DKIM verification failed (mode=%s): from=[%s] result=%s",
+			mode, utils.HashEmail(s.from), out.dkim.String())
+	} else if s.dkimEnabled {
+		logging.DebugLog("SMTP DKIM check passed: from=[%s] result=%s",
+			utils.HashEmail(s.from), out.dkim.String())
+	}
+
+	if out.dmarc.Result == DMARCFail {
+		failed = true
+		if (mode == "strict" || review) && out.dmarc.Enforced() {
+			logging.WarnLog("SMTP DMARC verification failed (mode=%s): header_from=[%s] domain=%s policy=%s - rejecting",
+				mode, utils.HashEmail(headerFrom), out.dmarc.Domain, out.dmarc.Policy)
+			return &smtpcore.SMTPError{Code: 550, EnhancedCode: smtpcore.EnhancedCode{5, 7, 1}, Message: "DMARC policy violation"}
+		}
+		logging.WarnLog("SMTP DMARC verification failed (mode=%s): header_from=[%s] domain=%s policy=%s",
+			mode, utils.HashEmail(headerFrom), out.dmarc.Domain, out.dmarc.Policy)
+	}
+
+	if review && s.requireTLS && !s.lmtp && s.tlsVersion == "none" {
+		out.review = append(out.review, "plaintext transport")
+	}
+
+	// Log verification summary
+	if len(out.review) > 0 {
+		logging.InfoLog("SMTP verification held for review: from=[%s] ip=%s spf=%s dkim=%s dmarc=%s reasons=%s",
+			utils.HashEmail(s.from), out.senderIP, out.spf.String(), out.dkim.String(), out.dmarc.Result.String(),
+			strings.Join(out.review, ", "))
+	} else if failed {
+		logging.InfoLog("SMTP verification warning: from=[%s] ip=%s spf=%s dkim=%s dmarc=%s arc=%s - accepting anyway (mode=%s)",
+			utils.HashEmail(s.from), out.senderIP, out.spf.String(), out.dkim.String(), out.dmarc.Result.String(),
+			out.arc.Result.String(), mode)
+	}
+	return nil
+}
+
+// hostFromAddr extracts the IP from a "host:port" remote address.
+func hostFromAddr(addr string) string {
+	host := addr
+	if idx := strings.LastIndex(host, ":"); idx >= 0 {
+		host = host[:idx]
+	}
+	// Remove brackets from IPv6 addresses
+	return strings.Trim(host, "[]")
+}
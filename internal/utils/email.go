@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ErrInvalidEmail is returned for addresses that cannot be normalized.
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// NormalizeEmail returns the form addresses are compared and stored in: the
+// local part NFC-normalized and lower-cased, the domain as lower-case
+// A-labels. Unicode and punycode spellings of one mailbox normalize alike.
+func NormalizeEmail(addr string) (string, error) {
+	local, domain, ok := cutAddress(addr)
+	if !ok || local == "" {
+		return "", ErrInvalidEmail
+	}
+	ascii, err := ASCIIDomain(domain)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(norm.NFC.String(local)) + "@" + ascii, nil
+}
+
+// ASCIIDomain returns domain as lower-case A-labels, the form DNS uses.
+func ASCIIDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+	if domain == "" {
+		return "", ErrInvalidEmail
+	}
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", ErrInvalidEmail
+	}
+	return ascii, nil
+}
+
+// DisplayEmail returns addr with its domain in U-labels, for showing to
+// people. Addresses that do not convert are returned unchanged.
+func DisplayEmail(addr string) string {
+	local, domain, ok := cutAddress(addr)
+	if !ok {
+		return addr
+	}
+	unicode, err := idna.Display.ToUnicode(domain)
+	if err != nil {
+		return addr
+	}
+	return local + "@" + unicode
+}
+
+// ValidEmail reports whether addr is a bare RFC 6531 mailbox: a local part
+// that may hold UTF-8 and a domain in U-labels or A-labels.
+func ValidEmail(addr string) bool {
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil || parsed.Name != "" || parsed.Address != addr {
+		return false
+	}
+	local, domain, _ := cutAddress(addr)
+	ascii, err := ASCIIDomain(domain)
+	if err != nil || !strings.Contains(ascii, ".") {
+		return false
+	}
+	// RFC 5321 limits count octets, which RFC 6531 keeps
+	return utf8.ValidString(local) && len(local) <= 64 && len(local)+1+len(ascii) <= 254
+}
+
+// NewValidator returns a validator that also knows the "mailbox" tag, which
+// checks an address with ValidEmail.
+func NewValidator() *validator.Validate {
+	v := validator.New()
+	_ = v.RegisterValidation("mailbox", func(fl validator.FieldLevel) bool {
+		return ValidEmail(fl.Field().String())
+	})
+	return v
+}
+
+// IsASCII reports whether s needs no SMTPUTF8 to be sent.
+func IsASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func cutAddress(addr string) (local, domain string, ok bool) {
+	addr = strings.TrimSpace(strings.Trim(strings.TrimSpace(addr), "<>"))
+	i := strings.LastIndex(addr, "@")
+	if i < 0 {
+		return addr, "", false
+	}
+	return addr[:i], addr[i+1:], true
+}
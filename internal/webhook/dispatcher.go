@@ -0,0 +1,219 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/auth"
+	"github.com/Goofygiraffe06/zinc/internal/config"
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	"github.com/Goofygiraffe06/zinc/internal/manager"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/store"
+)
+
+// Dispatcher moves events from the outbox to webhook endpoints. It fans new
+// events out into per-endpoint deliveries, then hands due deliveries to the
+// webhook pool. All state lives in SQLite, so nothing is lost on restart.
+type Dispatcher struct {
+	store       *store.SQLiteStore
+	mgr         *manager.WorkManager
+	client      *http.Client
+	endpoints   []string
+	maxAttempts int
+	retryBase   time.Duration
+	retryMax    time.Duration
+	poll        time.Duration
+	batch       int
+
+	stop     chan struct{}
+	done     chan struct{}
+	shutdown sync.Once
+}
+
+// Option configures the Dispatcher.
+type Option func(*Dispatcher)
+
+// WithEndpoints sets the endpoints every event is delivered to.
+func WithEndpoints(urls []string) Option { return func(d *Dispatcher) { d.endpoints = urls } }
+
+// WithMaxAttempts sets the attempts made before a delivery is dead-lettered.
+func WithMaxAttempts(n int) Option { return func(d *Dispatcher) { d.maxAttempts = n } }
+
+// WithRetryBackoff sets the first retry delay and the cap for exponential backoff.
+func WithRetryBackoff(base, max time.Duration) Option {
+	return func(d *Dispatcher) { d.retryBase, d.retryMax = base, max }
+}
+
+// WithPollInterval sets how often the outbox is scanned.
+func WithPollInterval(p time.Duration) Option { return func(d *Dispatcher) { d.poll = p } }
+
+// WithHTTPClient overrides the client used for deliveries.
+func WithHTTPClient(c *http.Client) Option { return func(d *Dispatcher) { d.client = c } }
+
+// NewDispatcher constructs a dispatcher with the given options (or defaults from config).
+func NewDispatcher(s *store.SQLiteStore, mgr *manager.WorkManager, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		store:       s,
+		mgr:         mgr,
+		client:      &http.Client{Timeout: config.WebhookTimeout()},
+		endpoints:   config.WebhookURLs(),
+		maxAttempts: config.WebhookMaxAttempts(),
+		retryBase:   config.WebhookRetryBase(),
+		retryMax:    config.WebhookRetryMax(),
+		poll:        config.WebhookPollInterval(),
+		batch:       100,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Start begins polling the outbox in a separate goroutine.
+func (d *Dispatcher) Start() {
+	go func() {
+		defer close(d.done)
+		logging.InfoLog("Webhook dispatcher started (endpoints=%d)", len(d.endpoints))
+		ticker := time.NewTicker(d.poll)
+		defer ticker.Stop()
+		for {
+			d.tick()
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop halts polling. Deliveries already queued on the pool are left to finish.
+func (d *Dispatcher) Stop() {
+	if d == nil {
+		return
+	}
+	d.shutdown.Do(func() {
+		close(d.stop)
+		<-d.done
+	})
+}
+
+func (d *Dispatcher) tick() {
+	now := time.Now()
+	if n, err := d.store.FanOutEvents(d.endpoints, now); err != nil {
+		logging.ErrorLog("Webhook fan-out failed: %v", err)
+	} else if n > 0 {
+		logging.DebugLog("Webhook fan-out: %d event(s) to %d endpoint(s)", n, len(d.endpoints))
+	}
+
+	// The lease must outlive one attempt so a slow delivery is not claimed twice.
+	lease := 2*d.client.Timeout + d.poll
+	due, err := d.store.ClaimDueDeliveries(now, lease, d.batch)
+	if err != nil {
+		logging.ErrorLog("Webhook claim failed: %v", err)
+		return
+	}
+	for _, del := range due {
+		del := del
+		if err := d.mgr.SubmitWebhook(func(ctx context.Context) { d.deliver(ctx, del) }); err != nil {
+			// The lease expires and the delivery is picked up by a later tick.
+			logging.WarnLog("Webhook delivery deferred event=%s: %v", del.EventID, err)
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, del models.WebhookDelivery) {
+	attempt := del.Attempts + 1
+	host := endpointHost(del.Endpoint)
+
+	err := d.post(ctx, del, attempt)
+	now := time.Now()
+	if err == nil {
+		if err := d.store.MarkDelivered(del.ID, attempt, now); err != nil {
+			logging.ErrorLog("Webhook delivered but not recorded event=%s endpoint=%s: %v", del.EventID, host, err)
+			return
+		}
+		logging.InfoLog("Webhook delivered event=%s type=%s endpoint=%s attempt=%d", del.EventID, del.EventType, host, attempt)
+		return
+	}
+
+	dead := attempt >= d.maxAttempts
+	next := now.Add(Backoff(d.retryBase, d.retryMax, attempt))
+	if merr := d.store.MarkFailed(del.ID, attempt, next, err.Error(), dead, now); merr != nil {
+		logging.ErrorLog("Webhook failure not recorded event=%s endpoint=%s: %v", del.EventID, host, merr)
+		return
+	}
+	if dead {
+		logging.ErrorLog("Webhook dead-lettered event=%s type=%s endpoint=%s after %d attempts: %v",
+			del.EventID, del.EventType, host, attempt, err)
+		return
+	}
+	logging.WarnLog("Webhook attempt %d failed event=%s endpoint=%s: %v (retry at %s)",
+		attempt, del.EventID, host, err, next.UTC().Format(time.RFC3339))
+}
+
+func (d *Dispatcher) post(ctx context.Context, del models.WebhookDelivery, attempt int) error {
+	key := auth.GetSigningKey()
+	if key == nil || key.PrivateKey == nil {
+		return fmt.Errorf("signing key not initialized")
+	}
+
+	body := []byte(del.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, del.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "zinc-webhook/1")
+	req.Header.Set("X-Zinc-Event", del.EventType)
+	req.Header.Set("X-Zinc-Delivery", del.EventID)
+	req.Header.Set("X-Zinc-Attempt", strconv.Itoa(attempt))
+	req.Header.Set(SignatureHeader, Sign(key.PrivateKey, time.Now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Backoff returns the delay before the retry following the given attempt:
+// base doubled per attempt, capped at max.
+func Backoff(base, max time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= max || delay <= 0 {
+			return max
+		}
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
+
+// endpointHost keeps credentials and paths out of the logs.
+func endpointHost(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "invalid-url"
+	}
+	return u.Host
+}
@@ -0,0 +1,100 @@
+// Package webhook delivers account lifecycle events to configured HTTP endpoints.
+//
+// Events are written to a transactional outbox together with the account
+// change that produced them and delivered at least once by a Dispatcher.
+// Each request is a JSON POST carrying these headers:
+//
+//	X-Zinc-Event:     event type, e.g. "user.registered"
+//	X-Zinc-Delivery:  event ID, stable across retries (use it to de-duplicate)
+//	X-Zinc-Attempt:   1-based delivery attempt
+//	X-Zinc-Signature: t=<unix seconds>,ed25519=<base64 signature>
+//
+// The signature is zinc's Ed25519 signature over "<t>.<raw request body>".
+// The public key is served at GET /webhooks/key; it is generated at startup,
+// so receivers should refetch it when verification fails.
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/config"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/utils"
+)
+
+// EventUserRegistered is sent when an account is created. zinc has no key
+// rotation or account deletion yet, so it is the only event type.
+const EventUserRegistered = "user.registered"
+
+// UserData is the payload of user.* events.
+type UserData struct {
+	Email string `json:"email"`
+	// DisplayEmail spells an IDN domain in U-labels; Email keeps the
+	// A-labels zinc stores and compares.
+	DisplayEmail string `json:"display_email,omitempty"`
+	Username     string `json:"username"`
+	PublicKey    string `json:"public_key,omitempty"`
+	Assurance    string `json:"assurance,omitempty"`
+}
+
+// Envelope is the JSON body POSTed to webhook endpoints.
+type Envelope struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// NewEvent builds an outbox event of the given type with data as its payload.
+func NewEvent(eventType string, data interface{}) (models.OutboxEvent, error) {
+	id, err := newEventID()
+	if err != nil {
+		return models.OutboxEvent{}, err
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return models.OutboxEvent{}, fmt.Errorf("webhook: encode data: %w", err)
+	}
+
+	now := time.Now().UTC()
+	body, err := json.Marshal(Envelope{ID: id, Type: eventType, CreatedAt: now, Data: raw})
+	if err != nil {
+		return models.OutboxEvent{}, fmt.Errorf("webhook: encode envelope: %w", err)
+	}
+	return models.OutboxEvent{ID: id, Type: eventType, Payload: string(body), CreatedAt: now}, nil
+}
+
+// UserEvent builds a user.* event for the given user.
+func UserEvent(eventType string, user models.User) (models.OutboxEvent, error) {
+	data := UserData{Email: user.Email, Username: user.Username, PublicKey: user.PublicKey, Assurance: user.Assurance}
+	if display := utils.DisplayEmail(user.Email); display != user.Email {
+		data.DisplayEmail = display
+	}
+	return NewEvent(eventType, data)
+}
+
+// UserEvents builds the user.* events to record with an account change. It
+// returns none when WEBHOOK_URLS is empty: no dispatcher runs then, so
+// nothing would ever drain them from the outbox.
+func UserEvents(eventType string, user models.User) ([]models.OutboxEvent, error) {
+	if len(config.WebhookURLs()) == 0 {
+		return nil, nil
+	}
+	ev, err := UserEvent(eventType, user)
+	if err != nil {
+		return nil, err
+	}
+	return []models.OutboxEvent{ev}, nil
+}
+
+func newEventID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("crypto/rand failed: %w", err)
+	}
+	return "evt_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,74 @@
+package webhook
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader is the header carrying the delivery signature.
+const SignatureHeader = "X-Zinc-Signature"
+
+var (
+	ErrBadSignatureHeader = errors.New("webhook: malformed signature header")
+	ErrBadSignature       = errors.New("webhook: signature mismatch")
+	ErrStaleSignature     = errors.New("webhook: signature timestamp outside tolerance")
+)
+
+// Sign returns the X-Zinc-Signature value for body signed at ts.
+func Sign(key ed25519.PrivateKey, ts time.Time, body []byte) string {
+	t := strconv.FormatInt(ts.Unix(), 10)
+	sig := ed25519.Sign(key, signedMessage(t, body))
+	return "t=" + t + ",ed25519=" + base64.StdEncoding.EncodeToString(sig)
+}
+
+// Verify checks a X-Zinc-Signature value against body. Receivers can use it
+// directly; tolerance bounds the accepted clock skew (zero disables the check).
+func Verify(pub ed25519.PublicKey, header string, body []byte, tolerance time.Duration) error {
+	var t, sigB64 string
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return ErrBadSignatureHeader
+		}
+		switch k {
+		case "t":
+			t = v
+		case "ed25519":
+			sigB64 = v
+		}
+	}
+	if t == "" || sigB64 == "" {
+		return ErrBadSignatureHeader
+	}
+
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil {
+		return ErrBadSignatureHeader
+	}
+	if tolerance > 0 {
+		skew := time.Since(time.Unix(unix, 0))
+		if skew < -tolerance || skew > tolerance {
+			return ErrStaleSignature
+		}
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(sigB64)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return ErrBadSignatureHeader
+	}
+	if !ed25519.Verify(pub, signedMessage(t, body), sig) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+func signedMessage(t string, body []byte) []byte {
+	msg := make([]byte, 0, len(t)+1+len(body))
+	msg = append(msg, t...)
+	msg = append(msg, '.')
+	return append(msg, body...)
+}
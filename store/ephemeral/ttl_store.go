@@ -44,6 +44,12 @@ func (s *TTLStore) Get(key string) (string, bool) {
 	return s.core.get(key)
 }
 
+// Lookup is Get; an in-memory read cannot fail.
+func (s *TTLStore) Lookup(key string) (string, bool, error) {
+	v, ok := s.core.get(key)
+	return v, ok, nil
+}
+
 func (s *TTLStore) Delete(key string) {
 	s.core.delete(key)
 }
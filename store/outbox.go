@@ -0,0 +1,246 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/models"
+)
+
+// Webhook delivery states stored in webhook_deliveries.status.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+const outboxSchema = `
+	CREATE TABLE IF NOT EXISTS webhook_outbox (
+		id TEXT PRIMARY KEY NOT NULL CHECK(id <> ''),
+		event_type TEXT NOT NULL CHECK(event_type <> ''),
+		payload TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		fanned_out INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_id TEXT NOT NULL REFERENCES webhook_outbox(id),
+		endpoint TEXT NOT NULL CHECK(endpoint <> ''),
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at INTEGER NOT NULL,
+		last_error TEXT NOT NULL DEFAULT '',
+		updated_at INTEGER NOT NULL,
+		UNIQUE(event_id, endpoint)
+	);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due
+		ON webhook_deliveries(status, next_attempt_at);
+	CREATE VIEW IF NOT EXISTS webhook_dead_letters AS
+		SELECT d.id, d.event_id, o.event_type, d.endpoint, o.payload, d.status,
+			d.attempts, d.next_attempt_at, d.last_error, d.updated_at
+		FROM webhook_deliveries d
+		JOIN webhook_outbox o ON o.id = d.event_id
+		WHERE d.status = 'dead';`
+
+// AddUserWithEvents inserts the user and appends the given events to the
+// webhook outbox in a single transaction, so an event exists if and only if
+// the account change was committed.
+func (s *SQLiteStore) AddUserWithEvents(user models.User, events ...models.OutboxEvent) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertUser(tx, user); err != nil {
+		return err
+	}
+	if err := insertOutboxEvents(tx, events); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertUser(tx *sql.Tx, user models.User) error {
+	report, err := encodeReport(user.VerificationReport)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO users (email, username, public_key, verification_report, assurance)
+		VALUES (?, ?, ?, ?, ?)`, user.Email, user.Username, user.PublicKey, report, user.Assurance)
+	if err != nil && isConstraintErr(err) {
+		return ErrUserExists
+	}
+	return err
+}
+
+// AppendEvents adds events to the webhook outbox outside of any account change.
+func (s *SQLiteStore) AppendEvents(events ...models.OutboxEvent) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertOutboxEvents(tx, events); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertOutboxEvents(tx *sql.Tx, events []models.OutboxEvent) error {
+	for _, ev := range events {
+		_, err := tx.Exec(`
+			INSERT INTO webhook_outbox (id, event_type, payload, created_at)
+			VALUES (?, ?, ?, ?)`, ev.ID, ev.Type, ev.Payload, ev.CreatedAt.UnixMilli())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FanOutEvents creates one pending delivery per endpoint for every outbox event
+// that has not been fanned out yet. It returns the number of events processed.
+func (s *SQLiteStore) FanOutEvents(endpoints []string, now time.Time) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id FROM webhook_outbox WHERE fanned_out = 0 ORDER BY created_at`)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	ts := now.UnixMilli()
+	for _, id := range ids {
+		for _, ep := range endpoints {
+			_, err := tx.Exec(`
+				INSERT OR IGNORE INTO webhook_deliveries (event_id, endpoint, next_attempt_at, updated_at)
+				VALUES (?, ?, ?, ?)`, id, ep, ts, ts)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if _, err := tx.Exec(`UPDATE webhook_outbox SET fanned_out = 1 WHERE id = ?`, id); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// ClaimDueDeliveries returns up to limit pending deliveries whose next attempt
+// is due and pushes their next attempt out by lease. If the process dies while
+// a delivery is in flight, it becomes due again once the lease expires.
+func (s *SQLiteStore) ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT d.id, d.event_id, o.event_type, d.endpoint, o.payload, d.status,
+			d.attempts, d.next_attempt_at, d.last_error, d.updated_at
+		FROM webhook_deliveries d
+		JOIN webhook_outbox o ON o.id = d.event_id
+		WHERE d.status = ? AND d.next_attempt_at <= ?
+		ORDER BY d.next_attempt_at
+		LIMIT ?`, DeliveryPending, now.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := scanDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	leaseUntil := now.Add(lease).UnixMilli()
+	for _, d := range deliveries {
+		if _, err := tx.Exec(`UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id = ?`, leaseUntil, d.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// MarkDelivered records a successful delivery.
+func (s *SQLiteStore) MarkDelivered(id int64, attempts int, now time.Time) error {
+	_, err := s.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, last_error = '', updated_at = ?
+		WHERE id = ?`, DeliveryDelivered, attempts, now.UnixMilli(), id)
+	return err
+}
+
+// MarkFailed records a failed attempt. The delivery is retried at next, or
+// moved to the dead-letter view when dead is true.
+func (s *SQLiteStore) MarkFailed(id int64, attempts int, next time.Time, lastErr string, dead bool, now time.Time) error {
+	status := DeliveryPending
+	if dead {
+		status = DeliveryDead
+	}
+	_, err := s.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ?, updated_at = ?
+		WHERE id = ?`, status, attempts, next.UnixMilli(), lastErr, now.UnixMilli(), id)
+	return err
+}
+
+// DeadLetters lists deliveries that exhausted their retries, newest first.
+func (s *SQLiteStore) DeadLetters(limit int) ([]models.WebhookDelivery, error) {
+	rows, err := s.db.Query(`
+		SELECT id, event_id, event_type, endpoint, payload, status,
+			attempts, next_attempt_at, last_error, updated_at
+		FROM webhook_dead_letters
+		ORDER BY updated_at DESC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows)
+}
+
+func scanDeliveries(rows *sql.Rows) ([]models.WebhookDelivery, error) {
+	defer rows.Close()
+
+	var out []models.WebhookDelivery
+	for rows.Next() {
+		var (
+			d               models.WebhookDelivery
+			next, updatedAt int64
+		)
+		if err := rows.Scan(&d.ID, &d.EventID, &d.EventType, &d.Endpoint, &d.Payload, &d.Status,
+			&d.Attempts, &next, &d.LastError, &updatedAt); err != nil {
+			return nil, err
+		}
+		d.NextAttemptAt = time.UnixMilli(next)
+		d.UpdatedAt = time.UnixMilli(updatedAt)
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
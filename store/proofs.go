@@ -0,0 +1,77 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/logging"
+	"github.com/Goofygiraffe06/zinc/internal/utils"
+)
+
+const proofSchema = `
+	CREATE TABLE IF NOT EXISTS verification_proofs (
+		key TEXT PRIMARY KEY NOT NULL CHECK(key <> ''),
+		value TEXT NOT NULL,
+		expires_at INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_verification_proofs_expiry
+		ON verification_proofs(expires_at);`
+
+// SQLiteProofStore keeps verification proofs in the users database so they
+// survive restarts and can be served to SMTP listeners in other processes.
+// It satisfies controller.ProofStore.
+type SQLiteProofStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteProofStore shares the connection of an existing SQLiteStore.
+func NewSQLiteProofStore(s *SQLiteStore) *SQLiteProofStore {
+	return &SQLiteProofStore{db: s.db}
+}
+
+// SetWithValue stores key=value until ttl elapses, replacing any previous value.
+func (p *SQLiteProofStore) SetWithValue(key, value string, ttl time.Duration) error {
+	now := time.Now()
+	// Opportunistic sweep keeps the table bounded without a background goroutine
+	if _, err := p.db.Exec(`DELETE FROM verification_proofs WHERE expires_at <= ?`, now.UnixMilli()); err != nil {
+		logging.WarnLog("Proof store sweep failed: %v", err)
+	}
+	_, err := p.db.Exec(`
+		INSERT INTO verification_proofs (key, value, expires_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at`,
+		key, value, now.Add(ttl).UnixMilli())
+	return err
+}
+
+// Get returns the value for key if it exists and has not expired.
+func (p *SQLiteProofStore) Get(key string) (string, bool) {
+	value, found, err := p.Lookup(key)
+	if err != nil {
+		logging.ErrorLog("Proof store get error [%s]: %v", utils.HashEmail(key), err)
+	}
+	return value, found
+}
+
+// Lookup is Get that returns database errors instead of logging them.
+func (p *SQLiteProofStore) Lookup(key string) (string, bool, error) {
+	var value string
+	err := p.db.QueryRow(`
+		SELECT value FROM verification_proofs
+		WHERE key = ? AND expires_at > ?`, key, time.Now().UnixMilli()).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// Delete removes key.
+func (p *SQLiteProofStore) Delete(key string) {
+	if _, err := p.db.Exec(`DELETE FROM verification_proofs WHERE key = ?`, key); err != nil {
+		logging.ErrorLog("Proof store delete error [%s]: %v", utils.HashEmail(key), err)
+	}
+}
@@ -0,0 +1,225 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/models"
+)
+
+const reviewSchema = `
+	CREATE TABLE IF NOT EXISTS registration_reviews (
+		nonce TEXT PRIMARY KEY NOT NULL CHECK(nonce <> ''),
+		email TEXT NOT NULL CHECK(email <> ''),
+		username TEXT NOT NULL CHECK(username <> ''),
+		public_key TEXT NOT NULL CHECK(public_key <> ''),
+		report TEXT,
+		status TEXT NOT NULL DEFAULT 'pending',
+		created_at INTEGER NOT NULL,
+		decided_at INTEGER NOT NULL DEFAULT 0,
+		decided_by TEXT NOT NULL DEFAULT '',
+		note TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_registration_reviews_status
+		ON registration_reviews(status, created_at);
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		at INTEGER NOT NULL,
+		actor TEXT NOT NULL CHECK(actor <> ''),
+		action TEXT NOT NULL CHECK(action <> ''),
+		subject TEXT NOT NULL,
+		note TEXT NOT NULL DEFAULT ''
+	);`
+
+// Actions recorded in the audit log.
+const (
+	AuditReviewQueued   = "review.queued"
+	AuditReviewApproved = "review.approved"
+	AuditReviewDenied   = "review.denied"
+)
+
+// AuditActorSystem is the actor of actions zinc takes by itself.
+const AuditActorSystem = "zinc"
+
+var (
+	ErrReviewNotFound = errors.New("review not found")
+	ErrReviewDecided  = errors.New("review already decided")
+)
+
+// AddReview holds a registration for an administrator. Holding the same
+// nonce again, as a replayed task does, changes nothing.
+func (s *SQLiteStore) AddReview(r models.Review) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	report, err := encodeReport(r.Report)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`
+		INSERT OR IGNORE INTO registration_reviews (nonce, email, username, public_key, report, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		r.Nonce, r.Email, r.Username, r.PublicKey, report, models.ReviewPending, r.CreatedAt.UnixMilli())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+
+	reason := ""
+	if r.Report != nil {
+		reason = r.Report.Reason
+	}
+	entry := models.AuditEntry{At: r.CreatedAt, Actor: AuditActorSystem, Action: AuditReviewQueued, Subject: r.Email, Note: reason}
+	if err := insertAudit(tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetReview returns the review held for a nonce, if any.
+func (s *SQLiteStore) GetReview(nonce string) (models.Review, bool, error) {
+	rows, err := s.db.Query(`
+		SELECT nonce, email, username, public_key, report, status, created_at, decided_at, decided_by, note
+		FROM registration_reviews
+		WHERE nonce = ?`, nonce)
+	if err != nil {
+		return models.Review{}, false, err
+	}
+	reviews, err := scanReviews(rows)
+	if err != nil || len(reviews) == 0 {
+		return models.Review{}, false, err
+	}
+	return reviews[0], true, nil
+}
+
+// ListReviews returns reviews in the given status, oldest first; an empty
+// status returns all of them.
+func (s *SQLiteStore) ListReviews(status string) ([]models.Review, error) {
+	rows, err := s.db.Query(`
+		SELECT nonce, email, username, public_key, report, status, created_at, decided_at, decided_by, note
+		FROM registration_reviews
+		WHERE ? = '' OR status = ?
+		ORDER BY created_at`, status, status)
+	if err != nil {
+		return nil, err
+	}
+	return scanReviews(rows)
+}
+
+// DecideReview records an administrator's decision on a pending review.
+// Approving passes the account to create, which commits together with its
+// events and the audit entry; denying passes nil.
+func (s *SQLiteStore) DecideReview(nonce, status, actor, note string, now time.Time, user *models.User, events ...models.OutboxEvent) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var email, current string
+	err = tx.QueryRow(`SELECT email, status FROM registration_reviews WHERE nonce = ?`, nonce).Scan(&email, &current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrReviewNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if current != models.ReviewPending {
+		return ErrReviewDecided
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE registration_reviews
+		SET status = ?, decided_at = ?, decided_by = ?, note = ?
+		WHERE nonce = ?`, status, now.UnixMilli(), actor, note, nonce); err != nil {
+		return err
+	}
+
+	if user != nil {
+		if err := insertUser(tx, *user); err != nil {
+			return err
+		}
+		if err := insertOutboxEvents(tx, events); err != nil {
+			return err
+		}
+	}
+
+	action := AuditReviewDenied
+	if status == models.ReviewApproved {
+		action = AuditReviewApproved
+	}
+	if err := insertAudit(tx, models.AuditEntry{At: now, Actor: actor, Action: action, Subject: email, Note: note}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AuditLog returns up to limit audit entries, newest first.
+func (s *SQLiteStore) AuditLog(limit int) ([]models.AuditEntry, error) {
+	rows, err := s.db.Query(`
+		SELECT id, at, actor, action, subject, note
+		FROM audit_log
+		ORDER BY id DESC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.AuditEntry
+	for rows.Next() {
+		var (
+			e  models.AuditEntry
+			at int64
+		)
+		if err := rows.Scan(&e.ID, &at, &e.Actor, &e.Action, &e.Subject, &e.Note); err != nil {
+			return nil, err
+		}
+		e.At = time.UnixMilli(at)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func insertAudit(tx *sql.Tx, e models.AuditEntry) error {
+	_, err := tx.Exec(`
+		INSERT INTO audit_log (at, actor, action, subject, note)
+		VALUES (?, ?, ?, ?, ?)`, e.At.UnixMilli(), e.Actor, e.Action, e.Subject, e.Note)
+	return err
+}
+
+func scanReviews(rows *sql.Rows) ([]models.Review, error) {
+	defer rows.Close()
+	var out []models.Review
+	for rows.Next() {
+		var (
+			r                    models.Review
+			report               sql.NullString
+			createdAt, decidedAt int64
+		)
+		if err := rows.Scan(&r.Nonce, &r.Email, &r.Username, &r.PublicKey, &report, &r.Status,
+			&createdAt, &decidedAt, &r.DecidedBy, &r.Note); err != nil {
+			return nil, err
+		}
+		if report.Valid {
+			r.Report = new(models.VerificationReport)
+			if err := json.Unmarshal([]byte(report.String), r.Report); err != nil {
+				return nil, err
+			}
+		}
+		r.CreatedAt = time.UnixMilli(createdAt)
+		if decidedAt != 0 {
+			t := time.UnixMilli(decidedAt)
+			r.DecidedAt = &t
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
@@ -2,11 +2,13 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"strings"
 
 	"github.com/Goofygiraffe06/zinc/internal/logging"
 	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/utils"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -21,34 +23,79 @@ func NewSQLiteStore(path string) (*SQLiteStore, error) {
 	if err != nil {
 		return nil, err
 	}
+	// SQLite serializes writers anyway; a single connection also keeps
+	// ":memory:" databases consistent across transactions.
+	db.SetMaxOpenConns(1)
 
 	schema := `
 	CREATE TABLE IF NOT EXISTS users (
 		email TEXT PRIMARY KEY NOT NULL CHECK(email <> ''),
 		username TEXT NOT NULL CHECK(username <> ''),
-		public_key TEXT NOT NULL CHECK(public_key <> '')
+		public_key TEXT NOT NULL CHECK(public_key <> ''),
+		verification_report TEXT,
+		assurance TEXT NOT NULL DEFAULT ''
 	);`
 
 	if _, err := db.Exec(schema); err != nil {
 		return nil, err
 	}
 
+	// Databases created before verification reports lack the column
+	if err := ensureColumn(db, "users", "verification_report", "TEXT"); err != nil {
+		return nil, err
+	}
+
+	// and those created before assurance levels lack this one
+	if err := ensureColumn(db, "users", "assurance", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return nil, err
+	}
+
+	// Accounts stored before IDN support may spell their domain in U-labels
+	if err := normalizeStoredEmails(db); err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(outboxSchema); err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(proofSchema); err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(workQueueSchema); err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(reviewSchema); err != nil {
+		return nil, err
+	}
+
+	// Queues created before email registration lack the column
+	if err := ensureColumn(db, "verify_queue", "registration", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return nil, err
+	}
+
 	return &SQLiteStore{db: db}, nil
 }
 
 func (s *SQLiteStore) AddUser(user models.User) error {
 	stmt, err := s.db.Prepare(`
-		INSERT INTO users (email, username, public_key)
-		VALUES (?, ?, ?)`)
+		INSERT INTO users (email, username, public_key, verification_report, assurance)
+		VALUES (?, ?, ?, ?, ?)`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(user.Email, user.Username, user.PublicKey)
+	report, err := encodeReport(user.VerificationReport)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec(user.Email, user.Username, user.PublicKey, report, user.Assurance)
 	if err != nil {
 		// Handle unique constraint violation gracefully
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") || strings.Contains(err.Error(), "constraint failed") {
+		if isConstraintErr(err) {
 			return ErrUserExists
 		}
 		return err
@@ -56,10 +103,14 @@ func (s *SQLiteStore) AddUser(user models.User) error {
 	return nil
 }
 
+func isConstraintErr(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed") || strings.Contains(err.Error(), "constraint failed")
+}
+
 func (s *SQLiteStore) GetUser(email string) (models.User, bool) {
 	var user models.User
 	stmt, err := s.db.Prepare(`
-		SELECT email, username, public_key
+		SELECT email, username, public_key, verification_report, assurance
 		FROM users
 		WHERE email = ?`)
 	if err != nil {
@@ -68,7 +119,8 @@ func (s *SQLiteStore) GetUser(email string) (models.User, bool) {
 	}
 	defer stmt.Close()
 
-	err = stmt.QueryRow(email).Scan(&user.Email, &user.Username, &user.PublicKey)
+	var report sql.NullString
+	err = stmt.QueryRow(email).Scan(&user.Email, &user.Username, &user.PublicKey, &report, &user.Assurance)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return models.User{}, false
@@ -76,10 +128,92 @@ func (s *SQLiteStore) GetUser(email string) (models.User, bool) {
 		logging.ErrorLog("store.GetUser error: %v", err)
 		return models.User{}, false
 	}
+	if report.Valid {
+		user.VerificationReport = new(models.VerificationReport)
+		if err := json.Unmarshal([]byte(report.String), user.VerificationReport); err != nil {
+			logging.ErrorLog("store.GetUser report decode error: %v", err)
+			user.VerificationReport = nil
+		}
+	}
 
 	return user, true
 }
 
+// encodeReport serializes a verification report for the users table; a nil
+// report is stored as NULL.
+func encodeReport(r *models.VerificationReport) (sql.NullString, error) {
+	if r == nil {
+		return sql.NullString{}, nil
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+// ensureColumn adds a column to an existing table if it is missing.
+func ensureColumn(db *sql.DB, table, column, decl string) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	_, err = db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + decl)
+	return err
+}
+
+// normalizeStoredEmails rewrites non-ASCII account addresses into the form
+// utils.NormalizeEmail produces, which is what lookups now use. An address
+// whose normalized form is already taken is left alone and logged.
+func normalizeStoredEmails(db *sql.DB) error {
+	rows, err := db.Query(`SELECT email FROM users WHERE email GLOB '*[^ -~]*'`)
+	if err != nil {
+		return err
+	}
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			rows.Close()
+			return err
+		}
+		emails = append(emails, email)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, email := range emails {
+		normalized, err := utils.NormalizeEmail(email)
+		if err != nil || normalized == email {
+			continue
+		}
+		if _, err := db.Exec(`UPDATE users SET email = ? WHERE email = ?`, normalized, email); err != nil {
+			if isConstraintErr(err) {
+				logging.WarnLog("Stored email [%s] not normalized: [%s] already exists", utils.HashEmail(email), utils.HashEmail(normalized))
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *SQLiteStore) Exists(email string) bool {
 	_, found := s.GetUser(email)
 	return found
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/models"
+)
+
+const workQueueSchema = `
+	CREATE TABLE IF NOT EXISTS verify_queue (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		nonce TEXT NOT NULL CHECK(nonce <> ''),
+		report TEXT NOT NULL,
+		sent_at INTEGER NOT NULL DEFAULT 0,
+		registration TEXT NOT NULL DEFAULT '',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at INTEGER NOT NULL,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_verify_queue_due
+		ON verify_queue(next_attempt_at);`
+
+// SQLiteWorkQueue holds accepted verification messages until their nonce has
+// been processed, so nothing acknowledged to a sender is lost to a full pool
+// or a restart.
+type SQLiteWorkQueue struct {
+	db *sql.DB
+}
+
+// NewSQLiteWorkQueue shares the connection of an existing SQLiteStore.
+func NewSQLiteWorkQueue(s *SQLiteStore) *SQLiteWorkQueue {
+	return &SQLiteWorkQueue{db: s.db}
+}
+
+// Enqueue stores a task and returns its ID. The task is not due before
+// t.NextAttemptAt, which leaves the caller time to process it in line.
+func (q *SQLiteWorkQueue) Enqueue(t models.VerifyTask) (int64, error) {
+	report, err := json.Marshal(t.Report)
+	if err != nil {
+		return 0, err
+	}
+	var sentAt int64
+	if !t.SentAt.IsZero() {
+		sentAt = t.SentAt.UnixMilli()
+	}
+	var registration []byte
+	if t.Registration != nil {
+		if registration, err = json.Marshal(t.Registration); err != nil {
+			return 0, err
+		}
+	}
+	res, err := q.db.Exec(`
+		INSERT INTO verify_queue (nonce, report, sent_at, registration, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, t.Nonce, string(report), sentAt, string(registration), t.NextAttemptAt.UnixMilli(), time.Now().UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// Claim returns up to limit tasks due by now and pushes their next attempt out
+// by lease. A task whose worker dies becomes due again once the lease expires.
+func (q *SQLiteWorkQueue) Claim(now time.Time, lease time.Duration, limit int) ([]models.VerifyTask, error) {
+	tx, err := q.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id, nonce, report, sent_at, registration, attempts, next_attempt_at, last_error, created_at
+		FROM verify_queue
+		WHERE next_attempt_at <= ?
+		ORDER BY next_attempt_at
+		LIMIT ?`, now.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := scanTasks(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	leaseUntil := now.Add(lease).UnixMilli()
+	for _, t := range tasks {
+		if _, err := tx.Exec(`UPDATE verify_queue SET next_attempt_at = ? WHERE id = ?`, leaseUntil, t.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// Release makes every task due at now, lease or backoff notwithstanding. A
+// starting process calls it to take over whatever an earlier one left.
+func (q *SQLiteWorkQueue) Release(now time.Time) error {
+	_, err := q.db.Exec(`UPDATE verify_queue SET next_attempt_at = ? WHERE next_attempt_at > ?`, now.UnixMilli(), now.UnixMilli())
+	return err
+}
+
+// Complete removes a processed task.
+func (q *SQLiteWorkQueue) Complete(id int64) error {
+	_, err := q.db.Exec(`DELETE FROM verify_queue WHERE id = ?`, id)
+	return err
+}
+
+// Retry records a failed attempt and makes the task due again at next.
+func (q *SQLiteWorkQueue) Retry(id int64, attempts int, next time.Time, lastErr string) error {
+	_, err := q.db.Exec(`
+		UPDATE verify_queue
+		SET attempts = ?, next_attempt_at = ?, last_error = ?
+		WHERE id = ?`, attempts, next.UnixMilli(), lastErr, id)
+	return err
+}
+
+func scanTasks(rows *sql.Rows) ([]models.VerifyTask, error) {
+	defer rows.Close()
+
+	var out []models.VerifyTask
+	for rows.Next() {
+		var (
+			t                       models.VerifyTask
+			report, registration    string
+			sentAt, next, createdAt int64
+		)
+		if err := rows.Scan(&t.ID, &t.Nonce, &report, &sentAt, &registration, &t.Attempts, &next, &t.LastError, &createdAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(report), &t.Report); err != nil {
+			return nil, err
+		}
+		if registration != "" {
+			t.Registration = &models.EmailRegistration{}
+			if err := json.Unmarshal([]byte(registration), t.Registration); err != nil {
+				return nil, err
+			}
+		}
+		if sentAt != 0 {
+			t.SentAt = time.UnixMilli(sentAt)
+		}
+		t.NextAttemptAt = time.UnixMilli(next)
+		t.CreatedAt = time.UnixMilli(createdAt)
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
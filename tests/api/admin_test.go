@@ -0,0 +1,216 @@
+package api_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/api"
+	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/internal/manager"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	"github.com/Goofygiraffe06/zinc/internal/webhook"
+	"github.com/Goofygiraffe06/zinc/store"
+	"github.com/Goofygiraffe06/zinc/store/ephemeral"
+	"github.com/go-chi/chi/v5"
+)
+
+const adminToken = "s3cret"
+
+func adminRouter(userStore *store.SQLiteStore) http.Handler {
+	router := chi.NewRouter()
+	router.Route("/admin", func(r chi.Router) {
+		r.Use(api.AdminAuth(adminToken))
+		r.Get("/reviews", api.ListReviewsHandler(userStore))
+		r.Post("/reviews/{nonce}/approve", api.DecideReviewHandler(userStore, true))
+		r.Post("/reviews/{nonce}/deny", api.DecideReviewHandler(userStore, false))
+		r.Get("/audit", api.AuditLogHandler(userStore))
+		r.Get("/webhooks/dead-letters", api.DeadLettersHandler(userStore))
+	})
+	return router
+}
+
+func adminRequest(router http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// holdRegistration runs POST /register against a verification that SMTP
+// held for review.
+func holdRegistration(t *testing.T, userStore *store.SQLiteStore, email string) string {
+	t.Helper()
+	ttlStore := ephemeral.NewTTLStore()
+	registry := controller.NewVerificationRegistry()
+	mgr := manager.NewWorkManager()
+	defer mgr.Close()
+
+	n, _ := nonce.Generate()
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	body, _ := json.Marshal(models.RegisterCompleteRequest{
+		Email:     email,
+		Username:  "held",
+		PublicKey: base64.StdEncoding.EncodeToString(pub),
+		Nonce:     n,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(n))),
+	})
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		report := models.VerificationReport{EnvelopeFrom: email, Decision: models.DecisionReview, Reason: "SPF softfail"}
+		controller.SaveReport(ttlStore, n, report)
+		registry.Notify(n)
+	}()
+
+	rr := httptest.NewRecorder()
+	api.RegisterHandler(userStore, ttlStore, registry, mgr).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(body)))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("register status = %d, want 202 body=%s", rr.Code, rr.Body)
+	}
+	if userStore.Exists(email) {
+		t.Fatal("account created before review")
+	}
+	return n
+}
+
+func TestAdminReviews(t *testing.T) {
+	tests := []struct {
+		name       string
+		action     string
+		wantStatus string
+		wantUser   bool
+	}{
+		{name: "approve", action: "approve", wantStatus: models.ReviewApproved, wantUser: true},
+		{name: "deny", action: "deny", wantStatus: models.ReviewDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userStore, _ := store.NewSQLiteStore(":memory:")
+			defer userStore.Close()
+			router := adminRouter(userStore)
+			email := "held@example.com"
+			n := holdRegistration(t, userStore, email)
+
+			if rr := adminRequest(router, http.MethodGet, "/admin/reviews", "wrong", ""); rr.Code != http.StatusUnauthorized {
+				t.Fatalf("bad token status = %d, want 401", rr.Code)
+			}
+
+			rr := adminRequest(router, http.MethodGet, "/admin/reviews", adminToken, "")
+			var pending []models.Review
+			if err := json.NewDecoder(rr.Body).Decode(&pending); err != nil || len(pending) != 1 || pending[0].Nonce != n {
+				t.Fatalf("pending reviews = %+v (%v), want the held registration", pending, err)
+			}
+
+			path := "/admin/reviews/" + n + "/" + tt.action
+			rr = adminRequest(router, http.MethodPost, path, adminToken, `{"actor":"carol","note":"checked by phone"}`)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("decision status = %d body=%s", rr.Code, rr.Body)
+			}
+			var decided models.Review
+			if err := json.NewDecoder(rr.Body).Decode(&decided); err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+			if decided.Status != tt.wantStatus || decided.DecidedBy != api.AdminActor || decided.DecidedAt == nil {
+				t.Errorf("review = %+v, want %s by %s", decided, tt.wantStatus, api.AdminActor)
+			}
+
+			user, found := userStore.GetUser(email)
+			if found != tt.wantUser {
+				t.Fatalf("account created = %t, want %t", found, tt.wantUser)
+			}
+			if found && (user.VerificationReport == nil || user.VerificationReport.Decision != models.DecisionAccepted) {
+				t.Errorf("user report = %+v, want accepted", user.VerificationReport)
+			}
+
+			// a review is decided once
+			if rr := adminRequest(router, http.MethodPost, path, adminToken, ""); rr.Code != http.StatusConflict {
+				t.Errorf("second decision status = %d, want 409", rr.Code)
+			}
+
+			rr = adminRequest(router, http.MethodGet, "/admin/audit", adminToken, "")
+			var audit []models.AuditEntry
+			if err := json.NewDecoder(rr.Body).Decode(&audit); err != nil || len(audit) != 2 {
+				t.Fatalf("audit = %+v (%v), want queued and decided entries", audit, err)
+			}
+			if audit[0].Actor != api.AdminActor || audit[0].Action != "review."+tt.wantStatus || audit[0].Note != "carol: checked by phone" {
+				t.Errorf("latest audit entry = %+v", audit[0])
+			}
+		})
+	}
+}
+
+func TestAdminReviews_NotFound(t *testing.T) {
+	userStore, _ := store.NewSQLiteStore(":memory:")
+	defer userStore.Close()
+	n, _ := nonce.Generate()
+	rr := adminRequest(adminRouter(userStore), http.MethodPost, "/admin/reviews/"+n+"/approve", adminToken, "")
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", rr.Code)
+	}
+}
+
+func TestAdminDeadLetters(t *testing.T) {
+	userStore, _ := store.NewSQLiteStore(":memory:")
+	defer userStore.Close()
+	router := adminRouter(userStore)
+
+	rr := adminRequest(router, http.MethodGet, "/admin/webhooks/dead-letters", adminToken, "")
+	if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Fatalf("empty list: status = %d body=%s", rr.Code, rr.Body)
+	}
+
+	ev, _ := webhook.UserEvent(webhook.EventUserRegistered, models.User{Email: "dead@example.com", Username: "dead"})
+	if err := userStore.AppendEvents(ev); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+	now := time.Now()
+	if _, err := userStore.FanOutEvents([]string{"https://hooks.example.com/zinc"}, now); err != nil {
+		t.Fatalf("FanOutEvents failed: %v", err)
+	}
+	due, err := userStore.ClaimDueDeliveries(now, time.Minute, 10)
+	if err != nil || len(due) != 1 {
+		t.Fatalf("ClaimDueDeliveries = %v (%v), want one delivery", due, err)
+	}
+	if err := userStore.MarkFailed(due[0].ID, 5, now, "HTTP 500", true, now); err != nil {
+		t.Fatalf("MarkFailed failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+	}{
+		{"admin", adminToken, http.StatusOK},
+		{"no token", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := adminRequest(router, http.MethodGet, "/admin/webhooks/dead-letters", tt.token, "")
+			if rr.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d body=%s", rr.Code, tt.wantCode, rr.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var dead []models.WebhookDelivery
+			if err := json.NewDecoder(rr.Body).Decode(&dead); err != nil || len(dead) != 1 {
+				t.Fatalf("dead letters = %+v (%v), want one", dead, err)
+			}
+			if dead[0].EventID != ev.ID || dead[0].Attempts != 5 || dead[0].LastError != "HTTP 500" {
+				t.Errorf("dead letter = %+v", dead[0])
+			}
+		})
+	}
+}
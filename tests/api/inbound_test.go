@@ -0,0 +1,264 @@
+package api_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/api"
+	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/internal/inbound"
+	"github.com/Goofygiraffe06/zinc/internal/manager"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	"github.com/Goofygiraffe06/zinc/internal/resolver"
+	"github.com/Goofygiraffe06/zinc/internal/resolver/dnstest"
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+	"github.com/Goofygiraffe06/zinc/store/ephemeral"
+	"github.com/go-chi/chi/v5"
+)
+
+const inboundDomain = "zinc.test"
+
+type inboundEnv struct {
+	router   http.Handler
+	ttlStore *ephemeral.TTLStore
+	sgKey    *ecdsa.PrivateKey
+}
+
+func newInboundEnv(t *testing.T, mode string) *inboundEnv {
+	t.Helper()
+	sgKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&sgKey.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey failed: %v", err)
+	}
+	t.Setenv("SMTP_VERIFICATION_MODE", mode)
+	t.Setenv("INBOUND_RAW_SECRET", "raw-secret")
+	t.Setenv("INBOUND_MAILGUN_SIGNING_KEY", "mailgun-key")
+	t.Setenv("INBOUND_SENDGRID_PUBLIC_KEY", base64.StdEncoding.EncodeToString(der))
+	t.Setenv("INBOUND_POSTMARK_CREDENTIALS", "postmark:hunter2")
+
+	// An empty zone answers every lookup with NXDOMAIN
+	dns := dnstest.NewServer(t)
+	res := resolver.New(resolver.WithUpstream(dns.Addr), resolver.WithTimeout(time.Second))
+
+	ttlStore := ephemeral.NewTTLStore()
+	mgr := manager.NewWorkManager()
+	t.Cleanup(mgr.Close)
+	backend := smtpserver.NewBackend(ttlStore, controller.NewVerificationRegistry(), mgr, inboundDomain, smtpserver.WithResolver(res))
+
+	router := chi.NewRouter()
+	router.Post("/inbound/{provider}", api.InboundHandler(inbound.Providers(), backend))
+	return &inboundEnv{router: router, ttlStore: ttlStore, sgKey: sgKey}
+}
+
+func inboundMessage(n string, extra string) string {
+	return extra +
+		"Return-Path: <alice@example.org>\r\n" +
+		"Delivered-To: verify+" + n + "@" + inboundDomain + "\r\n" +
+		"From: alice@example.org\r\n" +
+		"To: verify+" + n + "@" + inboundDomain + "\r\n" +
+		"Subject: verify\r\n" +
+		"\r\n" +
+		"hello\r\n"
+}
+
+func multipartBody(t *testing.T, fields map[string]string) (string, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		if err := w.WriteField(k, v); err != nil {
+			t.Fatalf("WriteField failed: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	return w.FormDataContentType(), buf.Bytes()
+}
+
+func rawRequest(n string, ts time.Time, secret string) *http.Request {
+	body := []byte(inboundMessage(n, ""))
+	req := httptest.NewRequest(http.MethodPost, "/inbound/raw", bytes.NewReader(body))
+	req.Header.Set(inbound.RawSignatureHeader, inbound.SignRaw([]byte(secret), ts, body))
+	return req
+}
+
+// forgedDKIMSignature names a key that is not published, so it fails to verify.
+const forgedDKIMSignature = "DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed; d=example.org; s=sel;" +
+	" h=from:to:subject; bh=AAAA; b=AAAA\r\n"
+
+func mailgunRequest(t *testing.T, n, headers, key string) *http.Request {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(ts + "token123"))
+	ctype, body := multipartBody(t, map[string]string{
+		"timestamp": ts,
+		"token":     "token123",
+		"signature": hex.EncodeToString(mac.Sum(nil)),
+		"sender":    "alice@example.org",
+		"recipient": "verify+" + n + "@" + inboundDomain,
+		"body-mime": inboundMessage(n, headers),
+	})
+	req := httptest.NewRequest(http.MethodPost, "/inbound/mailgun", bytes.NewReader(body))
+	req.Header.Set("Content-Type", ctype)
+	return req
+}
+
+func sendgridRequest(t *testing.T, env *inboundEnv, n string, tamper bool) *http.Request {
+	ctype, body := multipartBody(t, map[string]string{
+		"email":     inboundMessage(n, ""),
+		"envelope":  `{"to":["verify+` + n + `@` + inboundDomain + `"],"from":"alice@example.org"}`,
+		"SPF":       "pass",
+		"dkim":      "{@example.org : pass}",
+		"sender_ip": "192.0.2.1",
+	})
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	digest := sha256.Sum256(append([]byte(ts), body...))
+	sig, err := ecdsa.SignASN1(rand.Reader, env.sgKey, digest[:])
+	if err != nil {
+		t.Fatalf("SignASN1 failed: %v", err)
+	}
+	if tamper {
+		body = bytes.Replace(body, []byte("pass"), []byte("fail"), 1)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/inbound/sendgrid", bytes.NewReader(body))
+	req.Header.Set("Content-Type", ctype)
+	req.Header.Set(inbound.SendGridTimestampHeader, ts)
+	req.Header.Set(inbound.SendGridSignatureHeader, base64.StdEncoding.EncodeToString(sig))
+	return req
+}
+
+func postmarkRequest(t *testing.T, n, password string) *http.Request {
+	body, err := json.Marshal(map[string]any{
+		"From":              "alice@example.org",
+		"OriginalRecipient": "verify+" + n + "@" + inboundDomain,
+		"RawEmail":          inboundMessage(n, ""),
+		"Headers": []map[string]string{
+			{"Name": "Return-Path", "Value": "<alice@example.org>"},
+			{"Name": "Received-SPF", "Value": "Pass (sender SPF authorized) identity=mailfrom"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/inbound/postmark", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth("postmark", password)
+	return req
+}
+
+func TestInboundHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		request    func(t *testing.T, env *inboundEnv, n string) *http.Request
+		wantCode   int
+		wantStatus string
+		wantSPF    string
+	}{
+		{name: "raw", mode: "warn", wantCode: http.StatusOK, wantStatus: "accepted",
+			request: func(t *testing.T, env *inboundEnv, n string) *http.Request {
+				return rawRequest(n, time.Now(), "raw-secret")
+			}},
+		{name: "raw bad signature", mode: "warn", wantCode: http.StatusUnauthorized,
+			request: func(t *testing.T, env *inboundEnv, n string) *http.Request { return rawRequest(n, time.Now(), "wrong") }},
+		{name: "raw stale signature", mode: "warn", wantCode: http.StatusUnauthorized,
+			request: func(t *testing.T, env *inboundEnv, n string) *http.Request {
+				return rawRequest(n, time.Now().Add(-time.Hour), "raw-secret")
+			}},
+		// verdict fields in the message are the sender's to write
+		{name: "mailgun", mode: "strict", wantCode: http.StatusOK, wantStatus: "accepted", wantSPF: "none",
+			request: func(t *testing.T, env *inboundEnv, n string) *http.Request {
+				return mailgunRequest(t, n, "X-Mailgun-Spf: Pass\r\n", "mailgun-key")
+			}},
+		{name: "mailgun DKIM verified locally", mode: "strict", wantCode: http.StatusOK, wantStatus: "rejected",
+			request: func(t *testing.T, env *inboundEnv, n string) *http.Request {
+				return mailgunRequest(t, n, "X-Mailgun-Dkim-Check-Result: Pass\r\n"+forgedDKIMSignature, "mailgun-key")
+			}},
+		{name: "mailgun bad signature", mode: "strict", wantCode: http.StatusUnauthorized,
+			request: func(t *testing.T, env *inboundEnv, n string) *http.Request {
+				return mailgunRequest(t, n, "", "wrong")
+			}},
+		{name: "sendgrid", mode: "strict", wantCode: http.StatusOK, wantStatus: "accepted", wantSPF: "pass",
+			request: func(t *testing.T, env *inboundEnv, n string) *http.Request { return sendgridRequest(t, env, n, false) }},
+		{name: "sendgrid tampered body", mode: "strict", wantCode: http.StatusUnauthorized,
+			request: func(t *testing.T, env *inboundEnv, n string) *http.Request { return sendgridRequest(t, env, n, true) }},
+		{name: "postmark", mode: "strict", wantCode: http.StatusOK, wantStatus: "accepted", wantSPF: "pass",
+			request: func(t *testing.T, env *inboundEnv, n string) *http.Request { return postmarkRequest(t, n, "hunter2") }},
+		{name: "postmark wrong credentials", mode: "strict", wantCode: http.StatusUnauthorized,
+			request: func(t *testing.T, env *inboundEnv, n string) *http.Request { return postmarkRequest(t, n, "wrong") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newInboundEnv(t, tt.mode)
+			n, err := nonce.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			env.ttlStore.SetWithValue("expected:"+n, "alice@example.org", time.Minute)
+
+			rr := httptest.NewRecorder()
+			env.router.ServeHTTP(rr, tt.request(t, env, n))
+			if rr.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tt.wantCode, rr.Code, rr.Body.String())
+			}
+			if tt.wantStatus == "" {
+				return
+			}
+			var res models.InboundResponse
+			if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+				t.Fatalf("response not valid JSON: %v", err)
+			}
+			if res.Status != tt.wantStatus {
+				t.Fatalf("status = %q, want %q (%+v)", res.Status, tt.wantStatus, res)
+			}
+			if tt.wantStatus != "accepted" {
+				return
+			}
+
+			var report *models.VerificationReport
+			for deadline := time.Now().Add(time.Second); report == nil && time.Now().Before(deadline); {
+				report, _ = controller.LoadReport(env.ttlStore, n)
+				time.Sleep(10 * time.Millisecond)
+			}
+			if report == nil {
+				t.Fatal("expected a report")
+			}
+			if _, ok := env.ttlStore.Get(n); !ok {
+				t.Error("expected a stored proof")
+			}
+			if tt.wantSPF != "" && report.SPF.Result != tt.wantSPF {
+				t.Errorf("report SPF = %q, want %q", report.SPF.Result, tt.wantSPF)
+			}
+		})
+	}
+}
+
+func TestInboundHandler_UnknownProvider(t *testing.T) {
+	env := newInboundEnv(t, "warn")
+	rr := httptest.NewRecorder()
+	env.router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/inbound/ses", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+}
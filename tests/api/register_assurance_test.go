@@ -0,0 +1,87 @@
+package api_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/api"
+	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/internal/manager"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	"github.com/Goofygiraffe06/zinc/store"
+	"github.com/Goofygiraffe06/zinc/store/ephemeral"
+)
+
+func TestRegisterHandler_MinAssurance(t *testing.T) {
+	tests := []struct {
+		name       string
+		serverMin  string
+		requestMin string
+		verified   string // assurance of the verification email
+		wantCode   int
+	}{
+		{name: "no minimum", verified: models.AssuranceLow, wantCode: http.StatusOK},
+		{name: "request minimum met", requestMin: models.AssuranceMedium, verified: models.AssuranceHigh, wantCode: http.StatusOK},
+		{name: "request minimum not met", requestMin: models.AssuranceHigh, verified: models.AssuranceMedium, wantCode: http.StatusForbidden},
+		{name: "server minimum not met", serverMin: models.AssuranceMedium, verified: models.AssuranceLow, wantCode: http.StatusForbidden},
+		// a relying party cannot lower the server-wide minimum
+		{name: "request below server minimum", serverMin: models.AssuranceHigh, requestMin: models.AssuranceLow,
+			verified: models.AssuranceMedium, wantCode: http.StatusForbidden},
+		{name: "unknown level", requestMin: "extreme", verified: models.AssuranceHigh, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MIN_ASSURANCE", tt.serverMin)
+			userStore, _ := store.NewSQLiteStore(":memory:")
+			defer userStore.Close()
+			ttlStore := ephemeral.NewTTLStore()
+			registry := controller.NewVerificationRegistry()
+			mgr := manager.NewWorkManager()
+			defer mgr.Close()
+
+			email := "assured@example.com"
+			n, _ := nonce.Generate()
+			pub, priv, _ := ed25519.GenerateKey(nil)
+			body, _ := json.Marshal(models.RegisterCompleteRequest{
+				Email:        email,
+				Username:     "assured",
+				PublicKey:    base64.StdEncoding.EncodeToString(pub),
+				Nonce:        n,
+				Signature:    base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(n))),
+				MinAssurance: tt.requestMin,
+			})
+
+			// Simulate SMTP verification in background
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				report := models.VerificationReport{Decision: models.DecisionAccepted, Assurance: tt.verified}
+				controller.SaveReport(ttlStore, n, report)
+				ttlStore.SetWithValue(n, email, 3*time.Minute)
+				registry.Notify(n)
+			}()
+
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(body))
+			api.RegisterHandler(userStore, ttlStore, registry, mgr).ServeHTTP(rr, req)
+			if rr.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d body=%s", rr.Code, tt.wantCode, rr.Body)
+			}
+
+			user, found := userStore.GetUser(email)
+			if found != (tt.wantCode == http.StatusOK) {
+				t.Fatalf("account created = %t, want %t", found, tt.wantCode == http.StatusOK)
+			}
+			if found && user.Assurance != tt.verified {
+				t.Errorf("user assurance = %q, want %q", user.Assurance, tt.verified)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package api_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/api"
+	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/internal/manager"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	"github.com/Goofygiraffe06/zinc/store"
+	"github.com/Goofygiraffe06/zinc/store/ephemeral"
+)
+
+func TestRegisterHandler_InternationalizedEmail(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string // as the client sends it
+		verified string // as the SMTP listener stores the proof
+		wantCode int
+		wantUser string
+	}{
+		{name: "U-label request, A-label proof", email: "José@Bücher.de", verified: "josé@xn--bcher-kva.de",
+			wantCode: http.StatusOK, wantUser: "josé@xn--bcher-kva.de"},
+		{name: "A-label request", email: "josé@xn--bcher-kva.de", verified: "josé@xn--bcher-kva.de",
+			wantCode: http.StatusOK, wantUser: "josé@xn--bcher-kva.de"},
+		{name: "non-Latin address", email: "用户@例子.广告", verified: "用户@xn--fsqu00a.xn--4rr70v",
+			wantCode: http.StatusOK, wantUser: "用户@xn--fsqu00a.xn--4rr70v"},
+		{name: "different mailbox", email: "jose@bücher.de", verified: "josé@xn--bcher-kva.de", wantCode: http.StatusForbidden},
+		{name: "invalid IDN", email: "josé@-bücher.de", wantCode: http.StatusBadRequest},
+		{name: "display name", email: "José <josé@bücher.de>", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userStore, _ := store.NewSQLiteStore(":memory:")
+			defer userStore.Close()
+			ttlStore := ephemeral.NewTTLStore()
+			registry := controller.NewVerificationRegistry()
+			mgr := manager.NewWorkManager()
+			defer mgr.Close()
+
+			n, _ := nonce.Generate()
+			pub, priv, _ := ed25519.GenerateKey(nil)
+			body, _ := json.Marshal(models.RegisterCompleteRequest{
+				Email:     tt.email,
+				Username:  "jose",
+				PublicKey: base64.StdEncoding.EncodeToString(pub),
+				Nonce:     n,
+				Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(n))),
+			})
+
+			if tt.verified != "" {
+				go func() {
+					time.Sleep(50 * time.Millisecond)
+					controller.SaveReport(ttlStore, n, models.VerificationReport{Decision: models.DecisionAccepted})
+					ttlStore.SetWithValue(n, tt.verified, 3*time.Minute)
+					registry.Notify(n)
+				}()
+			}
+
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(body))
+			api.RegisterHandler(userStore, ttlStore, registry, mgr).ServeHTTP(rr, req)
+			if rr.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d body=%s", rr.Code, tt.wantCode, rr.Body)
+			}
+			if tt.wantUser != "" && !userStore.Exists(tt.wantUser) {
+				t.Errorf("no account stored under %q", tt.wantUser)
+			}
+		})
+	}
+}
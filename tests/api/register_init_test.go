@@ -8,6 +8,7 @@ import (
 
 	"github.com/Goofygiraffe06/zinc/api"
 	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
 )
 
 func TestRegisterInitHandler(t *testing.T) {
@@ -25,8 +26,11 @@ func TestRegisterInitHandler(t *testing.T) {
 		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
 			t.Fatalf("response not valid JSON: %v", err)
 		}
-		if res.Nonce == "" || len(res.Nonce) != 64 {
-			t.Error("expected 64-char nonce")
+		if len(res.Nonce) != nonce.Length {
+			t.Errorf("expected %d-char nonce, got %q", nonce.Length, res.Nonce)
+		}
+		if _, err := nonce.Normalize(res.Nonce, false); err != nil {
+			t.Errorf("nonce does not validate: %v", err)
 		}
 	})
 }
@@ -0,0 +1,96 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/api"
+	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	"github.com/Goofygiraffe06/zinc/store"
+	"github.com/Goofygiraffe06/zinc/store/ephemeral"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRegisterStatusHandler(t *testing.T) {
+	ttlStore := ephemeral.NewTTLStore()
+	userStore, _ := store.NewSQLiteStore(":memory:")
+	defer userStore.Close()
+	router := chi.NewRouter()
+	router.Get("/register/status/{nonce}", api.RegisterStatusHandler(ttlStore, userStore))
+
+	done, err := nonce.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	waiting, err := nonce.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	held, err := nonce.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	denied, err := nonce.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	for _, n := range []string{held, denied} {
+		r := models.Review{Nonce: n, Email: n + "@example.com", Username: "held", PublicKey: "key",
+			Report: &models.VerificationReport{Decision: models.DecisionReview, Reason: "SPF softfail"}, CreatedAt: time.Now()}
+		if err := userStore.AddReview(r); err != nil {
+			t.Fatalf("AddReview failed: %v", err)
+		}
+	}
+	if err := userStore.DecideReview(denied, models.ReviewDenied, "admin", "", time.Now(), nil); err != nil {
+		t.Fatalf("DecideReview failed: %v", err)
+	}
+	outcome := models.RegistrationStatusResponse{Status: "ok",
+		Verification: &models.VerificationReport{Decision: models.DecisionAccepted}}
+	if err := controller.SaveOutcome(ttlStore, done, outcome, time.Minute); err != nil {
+		t.Fatalf("SaveOutcome failed: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		nonce      string
+		wantCode   int
+		wantStatus string
+	}{
+		{name: "completed", nonce: done, wantCode: http.StatusOK, wantStatus: "ok"},
+		// clients may echo the nonce in another case
+		{name: "lowercase nonce", nonce: strings.ToLower(done), wantCode: http.StatusOK, wantStatus: "ok"},
+		{name: "held for review", nonce: held, wantCode: http.StatusOK, wantStatus: "pending"},
+		{name: "denied on review", nonce: denied, wantCode: http.StatusOK, wantStatus: "failed"},
+		{name: "not yet processed", nonce: waiting, wantCode: http.StatusNotFound, wantStatus: "pending"},
+		{name: "malformed nonce", nonce: "not-a-nonce", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/register/status/"+tt.nonce, nil))
+			if rr.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.wantCode, rr.Body)
+			}
+			if tt.wantStatus == "" {
+				return
+			}
+			var resp models.RegistrationStatusResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+			if resp.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", resp.Status, tt.wantStatus)
+			}
+			if tt.wantStatus == "ok" && resp.Verification == nil {
+				t.Error("expected the verification report")
+			}
+		})
+	}
+}
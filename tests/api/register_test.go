@@ -15,6 +15,7 @@ import (
 	"github.com/Goofygiraffe06/zinc/internal/controller"
 	"github.com/Goofygiraffe06/zinc/internal/manager"
 	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
 	"github.com/Goofygiraffe06/zinc/store"
 	"github.com/Goofygiraffe06/zinc/store/ephemeral"
 )
@@ -32,7 +33,7 @@ func TestRegisterHandler_Timeout(t *testing.T) {
 
 	email := "timeout@example.com"
 	username := "timeoutuser"
-	nonce := "test-nonce"
+	nonce, _ := nonce.Generate()
 
 	pub, priv, _ := ed25519.GenerateKey(nil)
 	pubB64 := base64.StdEncoding.EncodeToString(pub)
@@ -78,7 +79,7 @@ func TestRegisterHandler_SuccessWithInterrupt(t *testing.T) {
 
 	email := "success@example.com"
 	username := "successuser"
-	nonce := "test-nonce-123"
+	nonce, _ := nonce.Generate()
 
 	pub, priv, _ := ed25519.GenerateKey(nil)
 	pubB64 := base64.StdEncoding.EncodeToString(pub)
@@ -110,3 +111,96 @@ func TestRegisterHandler_SuccessWithInterrupt(t *testing.T) {
 		t.Errorf("expected 200 OK, got %d body=%s", rr.Code, rr.Body.String())
 	}
 }
+
+func TestRegisterHandler_MalformedNonce(t *testing.T) {
+	userStore, _ := store.NewSQLiteStore(":memory:")
+	defer userStore.Close()
+
+	mgr := manager.NewWorkManager()
+	defer mgr.Close()
+
+	handler := api.RegisterHandler(userStore, ephemeral.NewTTLStore(), controller.NewVerificationRegistry(), mgr)
+
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	good, _ := nonce.Generate()
+	// A single mistyped symbol must be caught by the check symbol
+	bad := "0" + good[1:]
+	if bad == good {
+		bad = "1" + good[1:]
+	}
+
+	payload := models.RegisterCompleteRequest{
+		Email:     "typo@example.com",
+		Username:  "typouser",
+		PublicKey: base64.StdEncoding.EncodeToString(pub),
+		Nonce:     bad,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(bad))),
+	}
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 Bad Request, got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRegisterHandler_ReturnsVerificationReport(t *testing.T) {
+	userStore, _ := store.NewSQLiteStore(":memory:")
+	defer userStore.Close()
+
+	ttlStore := ephemeral.NewTTLStore()
+	registry := controller.NewVerificationRegistry()
+	mgr := manager.NewWorkManager()
+	defer mgr.Close()
+
+	handler := api.RegisterHandler(userStore, ttlStore, registry, mgr)
+
+	email := "report@example.com"
+	nonce, _ := nonce.Generate()
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	payload := models.RegisterCompleteRequest{
+		Email:     email,
+		Username:  "reportuser",
+		PublicKey: base64.StdEncoding.EncodeToString(pub),
+		Nonce:     nonce,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(nonce))),
+	}
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+
+	report := models.VerificationReport{
+		EnvelopeFrom:          email,
+		Decision:              models.DecisionAccepted,
+		AuthenticationResults: "zinc.test; spf=pass smtp.mailfrom=report@example.com",
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		controller.SaveReport(ttlStore, nonce, report)
+		ttlStore.SetWithValue(nonce, email, 3*time.Minute)
+		registry.Notify(nonce)
+	}()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	var res models.RegistrationStatusResponse
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("response not valid JSON: %v", err)
+	}
+	if res.Status != "ok" || res.Verification == nil || res.Verification.AuthenticationResults != report.AuthenticationResults {
+		t.Errorf("unexpected response: %+v", res)
+	}
+
+	user, ok := userStore.GetUser(email)
+	if !ok || user.VerificationReport == nil || user.VerificationReport.Decision != models.DecisionAccepted {
+		t.Errorf("expected report stored with user, got %+v", user)
+	}
+	if _, ok := controller.LoadReport(ttlStore, nonce); ok {
+		t.Error("expected report to be removed from the proof store")
+	}
+}
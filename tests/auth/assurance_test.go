@@ -0,0 +1,47 @@
+package auth_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Goofygiraffe06/zinc/internal/auth"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+)
+
+func TestMagicToken_Assurance(t *testing.T) {
+	auth.InitSigningKey()
+
+	tests := []struct {
+		name    string
+		acr     string
+		min     string
+		wantErr bool
+	}{
+		{name: "no minimum", acr: models.AssuranceLow},
+		{name: "equal", acr: models.AssuranceMedium, min: models.AssuranceMedium},
+		{name: "above", acr: models.AssuranceHigh, min: models.AssuranceMedium},
+		{name: "below", acr: models.AssuranceLow, min: models.AssuranceHigh, wantErr: true},
+		// accounts from before assurance levels carry no acr
+		{name: "missing claim", min: models.AssuranceLow, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenStr, err := auth.GenerateMagicToken("alice@example.org", tt.acr)
+			if err != nil {
+				t.Fatalf("GenerateMagicToken failed: %v", err)
+			}
+			token, err := auth.VerifyMagicToken(tokenStr)
+			if err != nil {
+				t.Fatalf("VerifyMagicToken failed: %v", err)
+			}
+			err = auth.RequireAssurance(token, tt.min)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("RequireAssurance = %v, want error %t", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, auth.ErrInsufficientAssurance) {
+				t.Errorf("error %v is not ErrInsufficientAssurance", err)
+			}
+		})
+	}
+}
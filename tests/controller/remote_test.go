@@ -0,0 +1,204 @@
+package controller_test
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/store"
+)
+
+// startRemoteService stands up a verification service on a Unix socket backed
+// by a local registry and a SQLite proof store.
+func startRemoteService(t *testing.T, secret string) (string, *controller.VerificationRegistry, *store.SQLiteProofStore) {
+	t.Helper()
+	dir := t.TempDir()
+
+	userStore, err := store.NewSQLiteStore(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	t.Cleanup(func() { userStore.Close() })
+
+	registry := controller.NewVerificationRegistry()
+	proofs := store.NewSQLiteProofStore(userStore)
+
+	addr := "unix:" + filepath.Join(dir, "verify.sock")
+	ln, err := controller.ListenService(addr)
+	if err != nil {
+		t.Fatalf("ListenService failed: %v", err)
+	}
+	svc := controller.NewRemoteServer(registry, proofs, secret)
+	if err := svc.Start(ln); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(svc.Stop)
+
+	return addr, registry, proofs
+}
+
+func TestRemoteClient_NotifyWakesLocalWaiter(t *testing.T) {
+	addr, registry, _ := startRemoteService(t, "s3cret")
+
+	client := controller.NewRemoteClient(addr, "s3cret", time.Second)
+	defer client.Close()
+
+	nonce := "remote-nonce"
+	waitCh := registry.Register(nonce)
+	defer registry.Delete(nonce)
+
+	client.Notify(nonce)
+
+	select {
+	case <-waitCh:
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for remote notification")
+	}
+}
+
+func TestRemoteClient_ProofRoundTrip(t *testing.T) {
+	addr, _, proofs := startRemoteService(t, "s3cret")
+
+	client := controller.NewRemoteClient(addr, "s3cret", time.Second)
+	defer client.Close()
+
+	// API side stores the expectation, SMTP side reads it remotely
+	if err := proofs.SetWithValue("expected:n1", "user@example.com", time.Minute); err != nil {
+		t.Fatalf("SetWithValue failed: %v", err)
+	}
+	if v, ok := client.Get("expected:n1"); !ok || v != "user@example.com" {
+		t.Fatalf("expected remote get to return stored email, got %q found=%v", v, ok)
+	}
+
+	// SMTP side stores the proof, API side reads it locally
+	if err := client.SetWithValue("n1", "user@example.com", time.Minute); err != nil {
+		t.Fatalf("remote SetWithValue failed: %v", err)
+	}
+	if v, ok := proofs.Get("n1"); !ok || v != "user@example.com" {
+		t.Fatalf("expected proof to be stored, got %q found=%v", v, ok)
+	}
+
+	client.Delete("n1")
+	if _, ok := proofs.Get("n1"); ok {
+		t.Fatal("expected proof to be deleted")
+	}
+}
+
+func TestRemoteClient_WrongSecretRejected(t *testing.T) {
+	addr, _, proofs := startRemoteService(t, "s3cret")
+
+	client := controller.NewRemoteClient(addr, "wrong", time.Second)
+	defer client.Close()
+
+	if err := client.SetWithValue("n2", "attacker@example.com", time.Minute); err == nil {
+		t.Fatal("expected authentication failure")
+	}
+	if _, ok := proofs.Get("n2"); ok {
+		t.Fatal("unauthenticated client must not write proofs")
+	}
+}
+
+// authenticatedConn completes the challenge the way RemoteClient does and
+// returns the raw connection, standing in for someone on the path who
+// writes into an authenticated link.
+func authenticatedConn(t *testing.T, addr, secret string) (net.Conn, *bufio.Scanner) {
+	t.Helper()
+	conn, err := net.Dial("unix", strings.TrimPrefix(addr, "unix:"))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+	sc := bufio.NewScanner(conn)
+
+	var greeting struct{ Challenge string }
+	if !sc.Scan() || json.Unmarshal(sc.Bytes(), &greeting) != nil {
+		t.Fatal("no challenge")
+	}
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(greeting.Challenge))
+	writeLine(t, conn, map[string]string{"op": "auth", "mac": hex.EncodeToString(m.Sum(nil))})
+	if !sc.Scan() || !strings.Contains(sc.Text(), `"ok":true`) {
+		t.Fatalf("auth refused: %s", sc.Text())
+	}
+	return conn, sc
+}
+
+func writeLine(t *testing.T, conn net.Conn, v interface{}) {
+	t.Helper()
+	b, _ := json.Marshal(v)
+	if _, err := conn.Write(append(b, '\n')); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+}
+
+func TestRemoteServer_RejectsUnsignedRequests(t *testing.T) {
+	tests := []struct {
+		name string
+		req  map[string]interface{}
+	}{
+		{name: "no MAC", req: map[string]interface{}{"op": "set", "seq": 1, "key": "n3", "value": "victim@example.com", "ttl_ms": 60000}},
+		{name: "forged MAC", req: map[string]interface{}{"op": "set", "seq": 1, "mac": strings.Repeat("0", 64), "key": "n3", "value": "victim@example.com", "ttl_ms": 60000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, _, proofs := startRemoteService(t, "s3cret")
+			conn, sc := authenticatedConn(t, addr, "s3cret")
+
+			writeLine(t, conn, tt.req)
+			if !sc.Scan() || !strings.Contains(sc.Text(), "unauthorized") {
+				t.Fatalf("response = %q, want unauthorized", sc.Text())
+			}
+			if sc.Scan() {
+				t.Error("connection left open after a forged request")
+			}
+			if _, ok := proofs.Get("n3"); ok {
+				t.Fatal("injected request wrote a proof")
+			}
+		})
+	}
+}
+
+func TestRemoteClient_RequestTooLarge(t *testing.T) {
+	addr, _, proofs := startRemoteService(t, "s3cret")
+	client := controller.NewRemoteClient(addr, "s3cret", time.Second)
+	defer client.Close()
+
+	err := client.SetWithValue("big", strings.Repeat(`"`, 600<<10), time.Minute)
+	if !errors.Is(err, controller.ErrRemoteTooLarge) {
+		t.Fatalf("SetWithValue = %v, want ErrRemoteTooLarge", err)
+	}
+	// the link is still usable
+	if err := client.SetWithValue("n4", "user@example.com", time.Minute); err != nil {
+		t.Fatalf("SetWithValue after oversized request failed: %v", err)
+	}
+	if v, ok := proofs.Get("n4"); !ok || v != "user@example.com" {
+		t.Fatalf("proof = %q found=%v", v, ok)
+	}
+}
+
+func TestSQLiteProofStore_Expiry(t *testing.T) {
+	userStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer userStore.Close()
+	proofs := store.NewSQLiteProofStore(userStore)
+
+	if err := proofs.SetWithValue("short", "v", 20*time.Millisecond); err != nil {
+		t.Fatalf("SetWithValue failed: %v", err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, ok := proofs.Get("short"); ok {
+		t.Fatal("expected expired proof to be hidden")
+	}
+}
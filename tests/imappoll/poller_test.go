@@ -0,0 +1,277 @@
+package imappoll_test
+
+import (
+	"bytes"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/internal/imappoll"
+	"github.com/Goofygiraffe06/zinc/internal/manager"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+	"github.com/Goofygiraffe06/zinc/store/ephemeral"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/server"
+	smtpcore "github.com/emersion/go-smtp"
+)
+
+const testDomain = "zinc.test"
+
+// startIMAP runs the go-imap memory backend, whose only user is
+// username/password, with one seen message already in INBOX.
+func startIMAP(t *testing.T) string {
+	t.Helper()
+	srv := server.New(memory.New())
+	srv.AllowInsecureAuth = true
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+func dialIMAP(t *testing.T, addr string) *client.Client {
+	t.Helper()
+	c, err := client.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err := c.Login("username", "password"); err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	t.Cleanup(func() { c.Logout() })
+	return c
+}
+
+func appendVerification(t *testing.T, c *client.Client, n string) {
+	t.Helper()
+	msg := "Return-Path: <alice@example.org>\r\n" +
+		"Delivered-To: verify+" + n + "@" + testDomain + "\r\n" +
+		"From: alice@example.org\r\n" +
+		"To: verify+" + n + "@" + testDomain + "\r\n" +
+		"Subject: verify\r\n" +
+		"\r\n" +
+		"hello\r\n"
+	if err := c.Append("INBOX", nil, time.Now(), bytes.NewBufferString(msg)); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+}
+
+// countingBackend records deliveries and can fail the first ones temporarily.
+type countingBackend struct {
+	imappoll.Deliverer
+	mu       sync.Mutex
+	calls    int
+	failures int
+}
+
+func (b *countingBackend) Deliver(msg smtpserver.InboundMessage) ([]error, error) {
+	b.mu.Lock()
+	b.calls++
+	fail := b.failures > 0
+	if fail {
+		b.failures--
+	}
+	b.mu.Unlock()
+	if fail {
+		return nil, &smtpcore.SMTPError{Code: 451, EnhancedCode: smtpcore.EnhancedCode{4, 3, 0}, Message: "try later"}
+	}
+	return b.Deliverer.Deliver(msg)
+}
+
+func (b *countingBackend) count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.calls
+}
+
+type pollEnv struct {
+	addr     string
+	state    string
+	ttlStore *ephemeral.TTLStore
+	backend  *smtpserver.Backend
+}
+
+func newPollEnv(t *testing.T) *pollEnv {
+	t.Helper()
+	t.Setenv("SMTP_VERIFICATION_MODE", "unrestricted")
+	ttlStore := ephemeral.NewTTLStore()
+	mgr := manager.NewWorkManager()
+	t.Cleanup(mgr.Close)
+	return &pollEnv{
+		addr:     startIMAP(t),
+		state:    filepath.Join(t.TempDir(), "imap-state.json"),
+		ttlStore: ttlStore,
+		backend:  smtpserver.NewBackend(ttlStore, controller.NewVerificationRegistry(), mgr, testDomain),
+	}
+}
+
+func (e *pollEnv) start(t *testing.T, d imappoll.Deliverer, opts imappoll.Options) *imappoll.Poller {
+	t.Helper()
+	opts.Interval, opts.Timeout, opts.StateFile = 20*time.Millisecond, 5*time.Second, e.state
+	// the test server offers no STARTTLS
+	opts.AllowPlaintext = true
+	p, err := imappoll.New(d, []string{"imap://username:password@" + e.addr + "/INBOX"}, opts)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	p.Start()
+	return p
+}
+
+func (e *pollEnv) pending(t *testing.T) string {
+	t.Helper()
+	n, err := nonce.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	e.ttlStore.SetWithValue("expected:"+n, "alice@example.org", time.Minute)
+	return n
+}
+
+func awaitProof(e *pollEnv, n string) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := e.ttlStore.Get(n); ok {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func searchFlagged(t *testing.T, c *client.Client, mailbox string) []uint32 {
+	t.Helper()
+	if _, err := c.Select(mailbox, true); err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	criteria := imap.NewSearchCriteria()
+	criteria.WithFlags = []string{imappoll.ProcessedFlag}
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		t.Fatalf("UidSearch failed: %v", err)
+	}
+	return uids
+}
+
+func TestPoller_FlagsAndResumes(t *testing.T) {
+	for _, idle := range []bool{false, true} {
+		name := "poll"
+		if idle {
+			name = "idle"
+		}
+		t.Run(name, func(t *testing.T) {
+			env := newPollEnv(t)
+			c := dialIMAP(t, env.addr)
+			n := env.pending(t)
+			appendVerification(t, c, n)
+
+			first := &countingBackend{Deliverer: env.backend}
+			p := env.start(t, first, imappoll.Options{Idle: idle})
+			if !awaitProof(env, n) {
+				p.Stop()
+				t.Fatal("expected the nonce to be verified")
+			}
+			p.Stop()
+			// the memory backend's sample message and ours
+			if got := first.count(); got != 2 {
+				t.Errorf("first poller deliveries = %d, want 2", got)
+			}
+			if uids := searchFlagged(t, c, "INBOX"); len(uids) != 2 {
+				t.Errorf("flagged messages = %v, want 2", uids)
+			}
+
+			// a restart picks up only what arrived since
+			n2 := env.pending(t)
+			appendVerification(t, c, n2)
+			second := &countingBackend{Deliverer: env.backend}
+			p = env.start(t, second, imappoll.Options{Idle: idle})
+			defer p.Stop()
+			if !awaitProof(env, n2) {
+				t.Fatal("expected the second nonce to be verified")
+			}
+			if got := second.count(); got != 1 {
+				t.Errorf("second poller deliveries = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestPoller_MovesProcessed(t *testing.T) {
+	env := newPollEnv(t)
+	c := dialIMAP(t, env.addr)
+	n := env.pending(t)
+	appendVerification(t, c, n)
+
+	p := env.start(t, env.backend, imappoll.Options{Processed: "Processed"})
+	defer p.Stop()
+	if !awaitProof(env, n) {
+		t.Fatal("expected the nonce to be verified")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		inbox, err := c.Status("INBOX", []imap.StatusItem{imap.StatusMessages})
+		if err != nil {
+			t.Fatalf("Status failed: %v", err)
+		}
+		moved, err := c.Status("Processed", []imap.StatusItem{imap.StatusMessages})
+		if err == nil && inbox.Messages == 0 && moved.Messages == 2 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("INBOX has %d messages, Processed %v (%v); want 0 and 2", inbox.Messages, moved, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestPoller_RetriesTemporaryFailure(t *testing.T) {
+	env := newPollEnv(t)
+	c := dialIMAP(t, env.addr)
+	// the sample message fails first and blocks ours until it is retried
+	n := env.pending(t)
+	appendVerification(t, c, n)
+
+	backend := &countingBackend{Deliverer: env.backend, failures: 2}
+	p := env.start(t, backend, imappoll.Options{})
+	defer p.Stop()
+	if !awaitProof(env, n) {
+		t.Fatal("expected the nonce to be verified after retries")
+	}
+	if got := backend.count(); got != 4 {
+		t.Errorf("deliveries = %d, want 4", got)
+	}
+}
+
+func TestPoller_RequiresSTARTTLS(t *testing.T) {
+	env := newPollEnv(t)
+	c := dialIMAP(t, env.addr)
+	n := env.pending(t)
+	appendVerification(t, c, n)
+
+	counting := &countingBackend{Deliverer: env.backend}
+	opts := imappoll.Options{Interval: 20 * time.Millisecond, Timeout: 5 * time.Second, StateFile: env.state}
+	p, err := imappoll.New(counting, []string{"imap://username:password@" + env.addr + "/INBOX"}, opts)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	p.Start()
+	defer p.Stop()
+
+	time.Sleep(200 * time.Millisecond)
+	if got := counting.count(); got != 0 {
+		t.Errorf("deliveries = %d, want none without STARTTLS", got)
+	}
+	if _, ok := env.ttlStore.Get(n); ok {
+		t.Error("nonce verified over a plaintext login")
+	}
+}
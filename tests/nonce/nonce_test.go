@@ -0,0 +1,103 @@
+package nonce_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/config"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+)
+
+func TestGenerate(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		n, err := nonce.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		if len(n) != nonce.Length {
+			t.Fatalf("expected length %d, got %d (%q)", nonce.Length, len(n), n)
+		}
+		if got, err := nonce.Normalize(n, false); err != nil || got != n {
+			t.Fatalf("Normalize(%q) = %q, %v", n, got, err)
+		}
+		if seen[n] {
+			t.Fatalf("duplicate nonce %q", n)
+		}
+		seen[n] = true
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	n, err := nonce.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	hex := strings.Repeat("aB", 32)
+
+	tests := []struct {
+		name      string
+		in        string
+		acceptHex bool
+		want      string
+		wantErr   bool
+	}{
+		{name: "canonical", in: n, want: n},
+		{name: "upper case", in: strings.ToUpper(n), want: n},
+		{name: "hyphenated", in: n[:9] + "-" + n[9:18] + "-" + n[18:], want: n},
+		{name: "confusable letters", in: strings.NewReplacer("0", "O", "1", "L").Replace(n), want: n},
+		{name: "single substitution", in: substitute(n), wantErr: true},
+		{name: "truncated", in: n[:nonce.Length-1], wantErr: true},
+		{name: "invalid symbol", in: "u" + n[1:], wantErr: true},
+		{name: "legacy hex accepted", in: hex, acceptHex: true, want: strings.ToLower(hex)},
+		{name: "legacy hex rejected", in: hex, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := nonce.Normalize(tt.in, tt.acceptHex)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Normalize(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNonceAcceptLegacyHex(t *testing.T) {
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	tests := []struct {
+		name   string
+		accept string
+		until  string
+		want   bool
+	}{
+		{name: "before the deadline", until: future, want: true},
+		{name: "after the deadline", until: "2020-01-01", want: false},
+		{name: "timestamp deadline passed", until: "2020-01-01T12:00:00Z", want: false},
+		{name: "disabled before the deadline", accept: "false", until: future, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NONCE_ACCEPT_LEGACY_HEX", tt.accept)
+			t.Setenv("NONCE_LEGACY_HEX_UNTIL", tt.until)
+			if got := config.NonceAcceptLegacyHex(); got != tt.want {
+				t.Errorf("NonceAcceptLegacyHex() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+// substitute changes the middle symbol to a different valid one.
+func substitute(n string) string {
+	i := len(n) / 2
+	c := byte('0')
+	if n[i] == '0' {
+		c = '1'
+	}
+	return n[:i] + string(c) + n[i+1:]
+}
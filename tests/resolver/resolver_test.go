@@ -0,0 +1,138 @@
+package resolver_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/resolver"
+	"github.com/Goofygiraffe06/zinc/internal/resolver/dnstest"
+)
+
+func newClient(upstreams ...string) *resolver.Client {
+	return resolver.New(
+		resolver.WithUpstream(upstreams...),
+		resolver.WithTimeout(200*time.Millisecond),
+		resolver.WithCacheSize(100),
+		resolver.WithMaxTTL(time.Hour),
+		resolver.WithNegativeTTL(time.Minute),
+	)
+}
+
+func TestClient_Lookups(t *testing.T) {
+	dns := dnstest.NewServer(t)
+	long := strings.Repeat("k", 400)
+	dns.AddTXT(t, "example.com", 300, "v=spf1 -all")
+	dns.AddTXT(t, "sel._domainkey.example.com", 300, long)
+	dns.Add(t, "example.com. 300 IN MX 20 mx2.example.com.")
+	dns.Add(t, "example.com. 300 IN MX 10 mx1.example.com.")
+	dns.Add(t, "mx1.example.com. 300 IN A 192.0.2.1")
+	dns.Add(t, "mx1.example.com. 300 IN AAAA 2001:db8::1")
+	dns.Add(t, "1.2.0.192.in-addr.arpa. 300 IN PTR mx1.example.com.")
+	c := newClient(dns.Addr)
+	ctx := context.Background()
+
+	txt, err := c.LookupTXT(ctx, "Example.COM")
+	if err != nil || len(txt) != 1 || txt[0] != "v=spf1 -all" {
+		t.Fatalf("LookupTXT = %q, %v", txt, err)
+	}
+	// Character-strings of one record are joined like net.LookupTXT does
+	txt, err = c.LookupTXT(ctx, "sel._domainkey.example.com")
+	if err != nil || len(txt) != 1 || txt[0] != long {
+		t.Fatalf("LookupTXT (split record) = %d records, %v", len(txt), err)
+	}
+
+	mx, err := c.LookupMX(ctx, "example.com")
+	if err != nil || len(mx) != 2 || mx[0].Host != "mx1.example.com." {
+		t.Fatalf("LookupMX = %v, %v", mx, err)
+	}
+
+	ips, err := c.LookupIPAddr(ctx, "mx1.example.com")
+	if err != nil || len(ips) != 2 {
+		t.Fatalf("LookupIPAddr = %v, %v", ips, err)
+	}
+
+	names, err := c.LookupAddr(ctx, "192.0.2.1")
+	if err != nil || len(names) != 1 || names[0] != "mx1.example.com." {
+		t.Fatalf("LookupAddr = %v, %v", names, err)
+	}
+}
+
+func TestClient_NotFound(t *testing.T) {
+	dns := dnstest.NewServer(t)
+	dns.Add(t, "example.com. 300 IN A 192.0.2.1")
+	c := newClient(dns.Addr)
+
+	for _, name := range []string{"missing.example.com", "example.com"} {
+		_, err := c.LookupTXT(context.Background(), name)
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			t.Fatalf("LookupTXT(%s) error = %v, want IsNotFound", name, err)
+		}
+	}
+
+	// Negative answers are cached too
+	before := dns.Queries()
+	_, _ = c.LookupTXT(context.Background(), "missing.example.com")
+	if dns.Queries() != before {
+		t.Error("expected NXDOMAIN to be served from cache")
+	}
+}
+
+func TestClient_CacheRespectsTTL(t *testing.T) {
+	dns := dnstest.NewServer(t)
+	dns.AddTXT(t, "short.example.com", 1, "v=spf1 -all")
+	dns.AddTXT(t, "long.example.com", 300, "v=spf1 -all")
+	c := newClient(dns.Addr)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if _, err := c.LookupTXT(ctx, "long.example.com"); err != nil {
+			t.Fatalf("LookupTXT failed: %v", err)
+		}
+	}
+	if got := dns.Queries(); got != 1 {
+		t.Fatalf("expected 1 upstream query for repeated lookups, got %d", got)
+	}
+
+	if _, err := c.LookupTXT(ctx, "short.example.com"); err != nil {
+		t.Fatalf("LookupTXT failed: %v", err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if _, err := c.LookupTXT(ctx, "short.example.com"); err != nil {
+		t.Fatalf("LookupTXT failed: %v", err)
+	}
+	if got := dns.Queries(); got != 3 {
+		t.Fatalf("expected expired record to be re-queried (3 queries), got %d", got)
+	}
+}
+
+func TestClient_TimeoutAndFailover(t *testing.T) {
+	// A bound socket that never answers
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer silent.Close()
+
+	c := newClient(silent.LocalAddr().String())
+	start := time.Now()
+	_, err = c.LookupTXT(context.Background(), "example.com")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsTimeout || !dnsErr.Temporary() {
+		t.Fatalf("expected temporary timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("timeout not enforced, took %v", elapsed)
+	}
+
+	dns := dnstest.NewServer(t)
+	dns.AddTXT(t, "example.com", 300, "ok")
+	c = newClient(silent.LocalAddr().String(), dns.Addr)
+	if txt, err := c.LookupTXT(context.Background(), "example.com"); err != nil || len(txt) != 1 {
+		t.Fatalf("expected failover to second upstream, got %q, %v", txt, err)
+	}
+}
@@ -0,0 +1,94 @@
+package smtp_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+)
+
+func TestVerify_AddressingModes(t *testing.T) {
+	n, err := nonce.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	plain := func(subject, body string) string {
+		return "From: alice@example.com\r\n" +
+			"To: verify@" + testDomain + "\r\n" +
+			"Subject: " + subject + "\r\n" +
+			"\r\n" +
+			body + "\r\n"
+	}
+
+	tests := []struct {
+		name      string
+		modes     string
+		rcpt      string
+		msg       string
+		wantProof bool
+	}{
+		{name: "dash separator", modes: "subaddress", rcpt: "verify-" + n + "@" + testDomain, wantProof: true},
+		{name: "dot separator", modes: "subaddress", rcpt: "verify." + n + "@" + testDomain, wantProof: true},
+		{name: "case rewritten by relay", modes: "subaddress", rcpt: "VERIFY+" + strings.ToUpper(n) + "@" + testDomain, wantProof: true},
+		{name: "check symbol mismatch", modes: "subaddress", rcpt: "verify+" + typo(n) + "@" + testDomain},
+		{name: "separator not configured", modes: "subaddress", rcpt: "verify_" + n + "@" + testDomain},
+		{name: "mailbox subject token", modes: "mailbox", rcpt: "verify@" + testDomain,
+			msg: plain("Confirm "+n, "thanks"), wantProof: true},
+		{name: "mailbox encoded subject", modes: "mailbox", rcpt: "verify@" + testDomain,
+			msg: plain("=?utf-8?q?Confirm_"+n+"?=", "thanks"), wantProof: true},
+		{name: "mailbox body token", modes: "mailbox", rcpt: "verify@" + testDomain,
+			msg: plain("hello", "my code is "+n), wantProof: true},
+		{name: "mailbox multipart base64 body", modes: "mailbox", rcpt: "verify@" + testDomain,
+			msg: "From: alice@example.com\r\n" +
+				"Subject: hi\r\n" +
+				"MIME-Version: 1.0\r\n" +
+				"Content-Type: multipart/alternative; boundary=XX\r\n" +
+				"\r\n" +
+				"--XX\r\n" +
+				"Content-Type: text/plain; charset=utf-8\r\n" +
+				"Content-Transfer-Encoding: base64\r\n" +
+				"\r\n" +
+				base64.StdEncoding.EncodeToString([]byte("code: "+n)) + "\r\n" +
+				"--XX--\r\n",
+			wantProof: true},
+		{name: "mailbox mode disabled", modes: "subaddress", rcpt: "verify@" + testDomain,
+			msg: plain("Confirm "+n, "thanks")},
+		{name: "subdomain", modes: "subdomain", rcpt: "verify@" + strings.ToUpper(n) + "." + testDomain, wantProof: true},
+		{name: "subdomain nested label", modes: "subdomain", rcpt: "verify@x." + n + "." + testDomain},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SMTP_ADDRESSING_MODES", tt.modes)
+			t.Setenv("SMTP_ADDRESS_SEPARATORS", "+-.")
+			env := startVerifyServer(t)
+			env.ttlStore.SetWithValue("expected:"+n, "alice@example.com", time.Minute)
+
+			msg := tt.msg
+			if msg == "" {
+				msg = verificationMessage("alice@example.com", n)
+			}
+			if err := sendMessage(t, env.addr, "alice@example.com", tt.rcpt, msg); err != nil {
+				t.Fatalf("send failed: %v", err)
+			}
+
+			wait := time.Second
+			if !tt.wantProof {
+				wait = 200 * time.Millisecond
+			}
+			if _, ok := awaitProof(env, n, wait); ok != tt.wantProof {
+				t.Fatalf("proof stored=%v, want %v", ok, tt.wantProof)
+			}
+		})
+	}
+}
+
+// typo replaces the first symbol of a nonce with a different valid symbol.
+func typo(n string) string {
+	if n[0] == '0' {
+		return "1" + n[1:]
+	}
+	return "0" + n[1:]
+}
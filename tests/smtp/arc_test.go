@@ -0,0 +1,153 @@
+package smtp_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+)
+
+// publishRSASealer generates an RSA key of bits, publishes it as selector of
+// lists.test and returns a sealer that signs with it.
+func publishRSASealer(t *testing.T, f *authFixture, selector string, bits int) arcSealer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey failed: %v", err)
+	}
+	f.dns.AddTXT(t, selector+"._domainkey.lists.test", 300, "v=DKIM1; k=rsa; p="+base64.StdEncoding.EncodeToString(der))
+	return arcSealer{
+		domain:    "lists.test",
+		selector:  selector,
+		algorithm: "rsa-sha256",
+		sign: func(digest []byte) []byte {
+			sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest)
+			if err != nil {
+				t.Fatalf("SignPKCS1v15 failed: %v", err)
+			}
+			return sig
+		},
+	}
+}
+
+func TestCheckARC(t *testing.T) {
+	// Go refuses RSA keys under 1024 bits by default; the short-key case
+	// needs one to prove the verifier rejects it on its own.
+	t.Setenv("GODEBUG", "rsa1024min=0")
+
+	f := newAuthFixture(t)
+	rsaSealer := publishRSASealer(t, f, "rsa", 2048)
+	shortSealer := publishRSASealer(t, f, "short", 512)
+
+	const listResults = "lists.test; spf=pass smtp.mailfrom=alice@forwarded.test; " +
+		"dkim=pass header.d=forwarded.test; dmarc=pass header.from=forwarded.test"
+	msg := authMessage("alice@forwarded.test", "n", "hello")
+	sealed := f.arcSeal(msg, listResults)
+
+	tests := []struct {
+		name        string
+		message     string
+		sealers     []string
+		wantResult  smtpserver.ARCResult
+		wantTrusted bool
+		wantReason  string
+	}{
+		{
+			name:       "no chain",
+			message:    msg,
+			sealers:    []string{"lists.test"},
+			wantResult: smtpserver.ARCNone,
+		},
+		{
+			name:        "valid chain from trusted sealer",
+			message:     sealed,
+			sealers:     []string{"other.test", "Lists.Test."},
+			wantResult:  smtpserver.ARCPass,
+			wantTrusted: true,
+		},
+		{
+			name:        "valid RSA chain",
+			message:     sealARC(rsaSealer, msg, listResults),
+			sealers:     []string{"lists.test"},
+			wantResult:  smtpserver.ARCPass,
+			wantTrusted: true,
+		},
+		{
+			name:       "valid chain from untrusted sealer",
+			message:    sealed,
+			sealers:    []string{"other.test"},
+			wantResult: smtpserver.ARCPass,
+		},
+		{
+			name:       "body modified after sealing",
+			message:    sealed + "tampered\r\n",
+			sealers:    []string{"lists.test"},
+			wantResult: smtpserver.ARCFail,
+			wantReason: "ams i=1",
+		},
+		{
+			name:       "results modified after sealing",
+			message:    strings.Replace(sealed, "dmarc=pass", "dmarc=fail", 1),
+			sealers:    []string{"lists.test"},
+			wantResult: smtpserver.ARCFail,
+			wantReason: "seal i=1",
+		},
+		{
+			name:       "seal missing",
+			message:    sealed[strings.Index(sealed, "ARC-Message-Signature:"):],
+			sealers:    []string{"lists.test"},
+			wantResult: smtpserver.ARCFail,
+		},
+		{
+			name:       "first instance not cv=none",
+			message:    strings.Replace(sealed, "cv=none", "cv=pass", 1),
+			sealers:    []string{"lists.test"},
+			wantResult: smtpserver.ARCFail,
+		},
+		{
+			name:       "duplicate instance",
+			message:    sealed[:strings.Index(sealed, "From:")] + sealed,
+			sealers:    []string{"lists.test"},
+			wantResult: smtpserver.ARCFail,
+		},
+		{
+			name:       "RSA key under 1024 bits",
+			message:    sealARC(shortSealer, msg, listResults),
+			sealers:    []string{"lists.test"},
+			wantResult: smtpserver.ARCFail,
+			wantReason: "too short",
+		},
+	}
+
+	checker := smtpserver.NewDKIMChecker(f.resolver)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eval := checker.CheckARC(context.Background(), []byte(tt.message), tt.sealers)
+			if eval.Result != tt.wantResult {
+				t.Fatalf("Result = %s (%s), want %s", eval.Result, eval.Reason, tt.wantResult)
+			}
+			if eval.Trusted != tt.wantTrusted {
+				t.Errorf("Trusted = %t, want %t", eval.Trusted, tt.wantTrusted)
+			}
+			if !strings.Contains(eval.Reason, tt.wantReason) {
+				t.Errorf("Reason = %q, want it to contain %q", eval.Reason, tt.wantReason)
+			}
+			if eval.Trusted && eval.Upstream.DMARC != smtpserver.DMARCPass {
+				t.Errorf("Upstream.DMARC = %s, want pass", eval.Upstream.DMARC)
+			}
+			if !eval.Trusted && eval.Upstream.DMARC != smtpserver.DMARCNone {
+				t.Errorf("Upstream.DMARC = %s for an untrusted chain, want none", eval.Upstream.DMARC)
+			}
+		})
+	}
+}
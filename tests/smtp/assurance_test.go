@@ -0,0 +1,140 @@
+package smtp_test
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/smtp"
+	"path/filepath"
+	"testing"
+
+	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+	"github.com/Goofygiraffe06/zinc/store"
+)
+
+// sendMessageTLS is sendMessage after STARTTLS.
+func sendMessageTLS(t *testing.T, addr, envelopeFrom, rcpt, msg string) error {
+	t.Helper()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+	if err := c.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
+		t.Fatalf("StartTLS failed: %v", err)
+	}
+	if err := c.Mail(envelopeFrom); err != nil {
+		return err
+	}
+	if err := c.Rcpt(rcpt); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprint(w, msg); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func TestVerify_Assurance(t *testing.T) {
+	f := newAuthFixture(t)
+	certFile, keyFile := writeCert(t, t.TempDir(), 1)
+
+	tests := []struct {
+		name     string
+		mode     string
+		tls      bool
+		envelope string
+		message  func(n string) string
+		want     string
+	}{
+		{name: "unrestricted", mode: "unrestricted", envelope: "alice@example.org",
+			message: func(n string) string { return verificationMessage("alice@example.org", n) },
+			want:    models.AssuranceLow},
+		{name: "SPF only", mode: "strict", envelope: "alice@direct.test",
+			message: func(n string) string { return authMessage("alice@direct.test", n, "hello") },
+			want:    models.AssuranceMedium},
+		{name: "aligned DKIM without TLS", mode: "strict", envelope: "alice@direct.test",
+			message: func(n string) string { return f.dkimSign(t, authMessage("alice@direct.test", n, "hello")) },
+			want:    models.AssuranceMedium},
+		{name: "aligned DKIM over TLS", mode: "strict", tls: true, envelope: "alice@direct.test",
+			message: func(n string) string { return f.dkimSign(t, authMessage("alice@direct.test", n, "hello")) },
+			want:    models.AssuranceHigh},
+		{name: "rejected", mode: "strict", envelope: "alice@forwarded.test",
+			message: func(n string) string { return authMessage("alice@forwarded.test", n, "hello") },
+			want:    models.AssuranceLow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			send := sendMessage
+			if tt.tls {
+				t.Setenv("SMTP_TLS_CERT_FILE", certFile)
+				t.Setenv("SMTP_TLS_KEY_FILE", keyFile)
+				send = sendMessageTLS
+			}
+			env := startModeServer(t, tt.mode, smtpserver.WithResolver(f.resolver))
+			n := pendingNonce(t, env, tt.envelope)
+
+			_ = send(t, env.addr, tt.envelope, "verify+"+n+"@"+testDomain, tt.message(n))
+			r := awaitReport(env, n)
+			if r == nil {
+				t.Fatal("expected a report")
+			}
+			if r.Assurance != tt.want {
+				t.Errorf("assurance = %q, want %q (%+v)", r.Assurance, tt.want, r)
+			}
+		})
+	}
+}
+
+func TestVerify_EmailRegistrationMinAssurance(t *testing.T) {
+	tests := []struct {
+		name     string
+		min      string
+		wantCode int
+		wantUser bool
+	}{
+		{name: "no minimum", wantUser: true},
+		{name: "minimum met", min: models.AssuranceLow, wantUser: true},
+		{name: "minimum not met", min: models.AssuranceMedium, wantCode: 550},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SMTP_SYNC_VERDICTS", "true")
+			t.Setenv("MIN_ASSURANCE", tt.min)
+			users, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "users.db"))
+			if err != nil {
+				t.Fatalf("NewSQLiteStore failed: %v", err)
+			}
+			env := startModeServer(t, "unrestricted", smtpserver.WithRegistrar(users))
+			n, err := nonce.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			pub, sig := signNonce(t, n)
+
+			err = sendMessage(t, env.addr, "alice@example.org", "verify+"+n+"@"+testDomain,
+				registrationMessage("alice@example.org", n, registrationBody("alice", pub, sig)))
+			if smtpCode(err) != tt.wantCode {
+				t.Fatalf("reply = %v, want %d", err, tt.wantCode)
+			}
+			user, found := users.GetUser("alice@example.org")
+			if found != tt.wantUser {
+				t.Fatalf("account created = %t, want %t", found, tt.wantUser)
+			}
+			if found && user.Assurance != models.AssuranceLow {
+				t.Errorf("user assurance = %q, want %q", user.Assurance, models.AssuranceLow)
+			}
+			if o, ok := controller.LoadOutcome(env.ttlStore, n); !ok || (o.Status == "ok") != tt.wantUser {
+				t.Errorf("outcome = %+v", o)
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package smtp_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	"github.com/Goofygiraffe06/zinc/internal/resolver"
+	"github.com/Goofygiraffe06/zinc/internal/resolver/dnstest"
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+type authFixture struct {
+	dns      *dnstest.Server
+	dkimKey  ed25519.PrivateKey
+	sealKey  ed25519.PrivateKey
+	resolver *resolver.Client
+}
+
+// newAuthFixture publishes SPF, DKIM and DMARC records for a directly sending
+// domain (direct.test), a domain whose mail arrives through a mailing list
+// (forwarded.test) and the list's ARC key (lists.test).
+func newAuthFixture(t *testing.T) *authFixture {
+	t.Helper()
+	f := &authFixture{dns: dnstest.NewServer(t)}
+	var dkimPub, sealPub ed25519.PublicKey
+	var err error
+	if dkimPub, f.dkimKey, err = ed25519.GenerateKey(rand.Reader); err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	if sealPub, f.sealKey, err = ed25519.GenerateKey(rand.Reader); err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	f.dns.AddTXT(t, "direct.test", 300, "v=spf1 ip4:127.0.0.1 -all")
+	f.dns.AddTXT(t, "relay.test", 300, "v=spf1 ip4:127.0.0.1 -all")
+	f.dns.AddTXT(t, "forwarded.test", 300, "v=spf1 ip4:192.0.2.1 -all")
+	f.dns.AddTXT(t, "_dmarc.direct.test", 300, "v=DMARC1; p=reject")
+	f.dns.AddTXT(t, "_dmarc.forwarded.test", 300, "v=DMARC1; p=reject")
+	f.dns.AddTXT(t, "sel._domainkey.direct.test", 300, "v=DKIM1; k=ed25519; p="+base64.StdEncoding.EncodeToString(dkimPub))
+	f.dns.AddTXT(t, "arc._domainkey.lists.test", 300, "v=DKIM1; k=ed25519; p="+base64.StdEncoding.EncodeToString(sealPub))
+
+	f.resolver = resolver.New(resolver.WithUpstream(f.dns.Addr), resolver.WithTimeout(time.Second))
+	return f
+}
+
+func (f *authFixture) dkimSign(t *testing.T, msg string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	err := dkim.Sign(&buf, strings.NewReader(msg), &dkim.SignOptions{
+		Domain:   "direct.test",
+		Selector: "sel",
+		Signer:   f.dkimKey,
+	})
+	if err != nil {
+		t.Fatalf("dkim.Sign failed: %v", err)
+	}
+	return buf.String()
+}
+
+var wsp = regexp.MustCompile(`[ \t]+`)
+
+func relaxedHeader(name, value string) string {
+	return strings.ToLower(name) + ":" + strings.TrimSpace(wsp.ReplaceAllString(value, " "))
+}
+
+func relaxedBody(body string) string {
+	lines := strings.Split(body, "\r\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(wsp.ReplaceAllString(l, " "), " ")
+	}
+	out := strings.Join(lines, "\r\n")
+	out = strings.TrimRight(out, "\r\n")
+	if out != "" {
+		out += "\r\n"
+	}
+	return out
+}
+
+func simpleBody(body string) string {
+	return strings.TrimRight(body, "\r\n") + "\r\n"
+}
+
+// arcSealer signs ARC sets as selector of domain with the given algorithm.
+type arcSealer struct {
+	domain, selector, algorithm string
+	sign                        func(digest []byte) []byte
+}
+
+// listSealer signs ARC sets as lists.test with the fixture's seal key.
+func (f *authFixture) listSealer() arcSealer {
+	return arcSealer{
+		domain:    "lists.test",
+		selector:  "arc",
+		algorithm: "ed25519-sha256",
+		sign:      func(digest []byte) []byte { return ed25519.Sign(f.sealKey, digest) },
+	}
+}
+
+// arcSeal adds an i=1 ARC set from lists.test that records aar as the
+// results it saw. Header fields in msg must be unfolded.
+func (f *authFixture) arcSeal(msg, aar string) string {
+	return sealARC(f.listSealer(), msg, aar)
+}
+
+// sealARC adds an i=1 ARC set signed by s. Header fields in msg must be unfolded.
+func sealARC(s arcSealer, msg, aar string) string {
+	return sealARCWith(s, msg, aar, "relaxed/relaxed", []string{"from", "to", "subject"})
+}
+
+// sealARCWith is sealARC with the message signature's c= and h= tags chosen
+// by the caller. Repeated names in signed take instances from the bottom up.
+func sealARCWith(s arcSealer, msg, aar, canon string, signed []string) string {
+	header, body, _ := strings.Cut(msg, "\r\n\r\n")
+	lines := strings.Split(header, "\r\n")
+	headerCanon, bodyCanon, _ := strings.Cut(canon, "/")
+
+	sign := func(data string) string {
+		digest := sha256.Sum256([]byte(data))
+		return base64.StdEncoding.EncodeToString(s.sign(digest[:]))
+	}
+	canonField := func(name, value string) string {
+		if headerCanon == "relaxed" {
+			return relaxedHeader(name, value)
+		}
+		return name + ":" + value
+	}
+
+	aarValue := "i=1; " + aar
+	canonBody := simpleBody(body)
+	if bodyCanon == "relaxed" {
+		canonBody = relaxedBody(body)
+	}
+	bh := sha256.Sum256([]byte(canonBody))
+	// b= sits between other tags so verifiers must empty it in place
+	amsHead := "i=1; a=" + s.algorithm + "; b="
+	amsTail := "; bh=" + base64.StdEncoding.EncodeToString(bh[:]) + "; c=" + canon +
+		"; d=" + s.domain + "; h=" + strings.Join(signed, ":") + "; s=" + s.selector
+	var data strings.Builder
+	used := make(map[int]bool)
+	for _, name := range signed {
+		for i := len(lines) - 1; i >= 0; i-- {
+			field, value, _ := strings.Cut(lines[i], ":")
+			if used[i] || !strings.EqualFold(field, name) {
+				continue
+			}
+			used[i] = true
+			data.WriteString(canonField(field, value) + "\r\n")
+			break
+		}
+	}
+	data.WriteString(canonField("ARC-Message-Signature", " "+amsHead+amsTail))
+	amsValue := amsHead + sign(data.String()) + amsTail
+
+	tags := "a=" + s.algorithm + "; d=" + s.domain + "; s=" + s.selector
+	sealValue := "i=1; cv=none; " + tags + "; b="
+	sealValue += sign(relaxedHeader("ARC-Authentication-Results", aarValue) + "\r\n" +
+		relaxedHeader("ARC-Message-Signature", amsValue) + "\r\n" +
+		relaxedHeader("ARC-Seal", sealValue))
+
+	return "ARC-Seal: " + sealValue + "\r\n" +
+		"ARC-Message-Signature: " + amsValue + "\r\n" +
+		"ARC-Authentication-Results: " + aarValue + "\r\n" + msg
+}
+
+func authMessage(from, n, body string) string {
+	return "From: " + from + "\r\n" +
+		"To: verify+" + n + "@" + testDomain + "\r\n" +
+		"Subject: verify\r\n" +
+		"\r\n" +
+		body + "\r\n"
+}
+
+func TestVerify_StrictAuthentication(t *testing.T) {
+	f := newAuthFixture(t)
+	const listResults = "lists.test; spf=pass smtp.mailfrom=alice@forwarded.test; " +
+		"dkim=pass header.d=forwarded.test; dmarc=pass header.from=forwarded.test"
+
+	tests := []struct {
+		name     string
+		sealers  string
+		envelope string
+		build    func(n string) string
+		wantCode string
+	}{
+		{
+			name:     "aligned SPF and DKIM",
+			envelope: "alice@direct.test",
+			build:    func(n string) string { return f.dkimSign(t, authMessage("alice@direct.test", n, "hello")) },
+		},
+		{
+			name:     "SPF fail",
+			envelope: "alice@forwarded.test",
+			build:    func(n string) string { return authMessage("alice@forwarded.test", n, "hello") },
+			wantCode: "550",
+		},
+		{
+			name:     "DMARC unaligned",
+			envelope: "alice@relay.test",
+			build:    func(n string) string { return authMessage("alice@direct.test", n, "hello") },
+			wantCode: "550",
+		},
+		{
+			name:     "trusted ARC sealer",
+			sealers:  "lists.test",
+			envelope: "alice@forwarded.test",
+			build: func(n string) string {
+				return f.arcSeal(authMessage("alice@forwarded.test", n, "hello\r\n-- list footer"), listResults)
+			},
+		},
+		{
+			name:     "untrusted ARC sealer",
+			sealers:  "other.test",
+			envelope: "alice@forwarded.test",
+			build: func(n string) string {
+				return f.arcSeal(authMessage("alice@forwarded.test", n, "hello"), listResults)
+			},
+			wantCode: "550",
+		},
+		{
+			name:     "ARC body modified after sealing",
+			sealers:  "lists.test",
+			envelope: "alice@forwarded.test",
+			build: func(n string) string {
+				return f.arcSeal(authMessage("alice@forwarded.test", n, "hello"), listResults) + "tampered\r\n"
+			},
+			wantCode: "550",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SMTP_ARC_TRUSTED_SEALERS", tt.sealers)
+			env := startModeServer(t, "strict", smtpserver.WithResolver(f.resolver))
+			n, err := nonce.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			env.ttlStore.SetWithValue("expected:"+n, tt.envelope, time.Minute)
+
+			err = sendMessage(t, env.addr, tt.envelope, "verify+"+n+"@"+testDomain, tt.build(n))
+			if tt.wantCode != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantCode) {
+					t.Fatalf("expected %s rejection, got %v", tt.wantCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("send failed: %v", err)
+			}
+			if _, ok := awaitProof(env, n, time.Second); !ok {
+				t.Fatal("expected proof to be stored")
+			}
+		})
+	}
+}
+
+// awaitReport waits for the asynchronous nonce processing to store its report.
+func awaitReport(env *verifyEnv, n string) *models.VerificationReport {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if r, ok := controller.LoadReport(env.ttlStore, n); ok {
+			return r
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestVerify_Report(t *testing.T) {
+	f := newAuthFixture(t)
+
+	tests := []struct {
+		name         string
+		envelope     string
+		message      func(n string) string
+		wantDecision string
+		wantAR       string
+		wantReason   string
+	}{
+		{
+			name:         "accepted",
+			envelope:     "alice@direct.test",
+			message:      func(n string) string { return f.dkimSign(t, authMessage("alice@direct.test", n, "hello")) },
+			wantDecision: models.DecisionAccepted,
+			wantAR: testDomain + "; spf=pass smtp.helo=localhost smtp.mailfrom=alice@direct.test; " +
+				"dkim=pass header.d=direct.test; dmarc=pass header.from=direct.test",
+		},
+		{
+			name:         "rejected by SPF",
+			envelope:     "alice@forwarded.test",
+			message:      func(n string) string { return authMessage("alice@forwarded.test", n, "hello") },
+			wantDecision: models.DecisionRejected,
+			wantAR:       testDomain + "; spf=fail smtp.helo=localhost smtp.mailfrom=alice@forwarded.test; dkim=none; dmarc=fail header.from=forwarded.test",
+			wantReason:   "SPF verification failed",
+		},
+		{
+			name:         "header From mismatch",
+			envelope:     "alice@direct.test",
+			message:      func(n string) string { return f.dkimSign(t, authMessage("bob@direct.test", n, "hello")) },
+			wantDecision: models.DecisionFailed,
+			wantReason:   "header From",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := startModeServer(t, "strict", smtpserver.WithResolver(f.resolver))
+			n, err := nonce.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			env.ttlStore.SetWithValue("expected:"+n, tt.envelope, time.Minute)
+
+			_ = sendMessage(t, env.addr, tt.envelope, "verify+"+n+"@"+testDomain, tt.message(n))
+
+			r := awaitReport(env, n)
+			if r == nil {
+				t.Fatal("expected a verification report")
+			}
+			if r.Decision != tt.wantDecision {
+				t.Errorf("decision = %q, want %q (reason %q)", r.Decision, tt.wantDecision, r.Reason)
+			}
+			if tt.wantAR != "" && r.AuthenticationResults != tt.wantAR {
+				t.Errorf("Authentication-Results =\n  %q\nwant\n  %q", r.AuthenticationResults, tt.wantAR)
+			}
+			if !strings.Contains(r.Reason, tt.wantReason) {
+				t.Errorf("reason = %q, want it to mention %q", r.Reason, tt.wantReason)
+			}
+			if r.RemoteIP != "127.0.0.1" || r.HELO != "localhost" || r.TLS != "none" || r.Mode != "strict" {
+				t.Errorf("unexpected connection details: %+v", r)
+			}
+		})
+	}
+}
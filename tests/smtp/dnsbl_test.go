@@ -0,0 +1,182 @@
+package smtp_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+)
+
+func TestParseBlocklistZones(t *testing.T) {
+	got := smtpserver.ParseBlocklistZones([]string{"BL.example.", "rhs.example:reject", "esc.example:escalate", "bad.example:drop", ""})
+	want := []smtpserver.BlocklistZone{
+		{Zone: "bl.example", Action: smtpserver.BlocklistWarn},
+		{Zone: "rhs.example", Action: smtpserver.BlocklistReject},
+		{Zone: "esc.example", Action: smtpserver.BlocklistEscalate},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseBlocklistZones = %+v, want %+v", got, want)
+	}
+}
+
+func TestVerify_Blocklists(t *testing.T) {
+	f := newAuthFixture(t)
+	// The test client connects from 127.0.0.1.
+	f.dns.Add(t, "1.0.0.127.bl.test. 300 IN A 127.0.0.2")
+	f.dns.Add(t, "1.0.0.127.refused.test. 300 IN A 127.255.255.254")
+	f.dns.Add(t, "forwarded.test.rhs.test. 300 IN A 127.0.1.2")
+
+	tests := []struct {
+		name     string
+		dnsbl    string
+		rhsbl    string
+		envelope string
+		wantCode string
+	}{
+		// forwarded.test fails SPF, which warn mode only logs
+		{name: "not listed", dnsbl: "clean.test:reject", rhsbl: "clean.test:reject", envelope: "alice@forwarded.test"},
+		{name: "client listed with warn", dnsbl: "bl.test:warn", envelope: "alice@forwarded.test"},
+		{name: "client listed with reject", dnsbl: "bl.test:reject", envelope: "alice@direct.test", wantCode: "554"},
+		{name: "client listed with escalate", dnsbl: "bl.test:escalate", envelope: "alice@forwarded.test", wantCode: "550"},
+		{name: "escalated client that authenticates", dnsbl: "bl.test:escalate", envelope: "alice@direct.test"},
+		{name: "refused query is not a listing", dnsbl: "refused.test:reject", envelope: "alice@direct.test"},
+		{name: "sender domain listed with reject", rhsbl: "rhs.test:reject", envelope: "alice@forwarded.test", wantCode: "550"},
+		{name: "sender domain listed with escalate", rhsbl: "rhs.test:escalate", envelope: "alice@forwarded.test", wantCode: "550"},
+		{name: "other sender domain", rhsbl: "rhs.test:reject", envelope: "alice@direct.test"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SMTP_DNSBL_ZONES", tt.dnsbl)
+			t.Setenv("SMTP_RHSBL_ZONES", tt.rhsbl)
+			env := startModeServer(t, "warn", smtpserver.WithResolver(f.resolver))
+			n, err := nonce.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			env.ttlStore.SetWithValue("expected:"+n, tt.envelope, time.Minute)
+
+			msg := authMessage(tt.envelope, n, "hello")
+			if strings.HasSuffix(tt.envelope, "@direct.test") {
+				msg = f.dkimSign(t, msg)
+			}
+			err = sendMessage(t, env.addr, tt.envelope, "verify+"+n+"@"+testDomain, msg)
+			if tt.wantCode != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantCode) {
+					t.Fatalf("expected %s rejection, got %v", tt.wantCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("send failed: %v", err)
+			}
+			if _, ok := awaitProof(env, n, time.Second); !ok {
+				t.Fatal("expected proof to be stored")
+			}
+		})
+	}
+}
+
+func TestVerify_RelayOriginBlocklists(t *testing.T) {
+	f := newAuthFixture(t)
+	const (
+		// forwarded.test authorizes 192.0.2.1 but not 198.51.100.7
+		originHop = "Received: from mail.forwarded.test (mail.forwarded.test [192.0.2.1])\r\n" +
+			"\tby mx.zinc.test (Postfix) with ESMTPS id 4Xyz; Mon, 1 Jan 2024 00:00:00 +0000\r\n"
+		spoofedHop = "Received: from mail.forwarded.test (unknown [198.51.100.7])\r\n" +
+			"\tby mx.zinc.test (Postfix) with ESMTP id 4Xyz; Mon, 1 Jan 2024 00:00:00 +0000\r\n"
+	)
+	f.dns.Add(t, "1.0.0.127.bl.test. 300 IN A 127.0.0.2")
+	f.dns.Add(t, "1.2.0.192.bl.test. 300 IN A 127.0.0.2")
+	f.dns.Add(t, "7.100.51.198.bl.test. 300 IN A 127.0.0.2")
+
+	tests := []struct {
+		name     string
+		dnsbl    string
+		headers  string
+		wantCode string
+	}{
+		{name: "origin listed with warn", dnsbl: "bl.test:warn", headers: originHop},
+		{name: "origin listed with reject", dnsbl: "bl.test:reject", headers: originHop, wantCode: "550"},
+		{name: "escalated origin that authenticates", dnsbl: "bl.test:escalate", headers: originHop},
+		{name: "escalated origin that fails SPF", dnsbl: "bl.test:escalate", headers: spoofedHop, wantCode: "550"},
+		{name: "unlisted origin", dnsbl: "clean.test:reject", headers: spoofedHop},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The relay itself (127.0.0.1) is listed too and must not be judged
+			t.Setenv("SMTP_TRUSTED_RELAYS", "127.0.0.0/8")
+			t.Setenv("SMTP_DNSBL_ZONES", tt.dnsbl)
+			env := startModeServer(t, "warn", smtpserver.WithResolver(f.resolver))
+			n, err := nonce.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			env.ttlStore.SetWithValue("expected:"+n, "alice@forwarded.test", time.Minute)
+
+			msg := tt.headers + authMessage("alice@forwarded.test", n, "hello")
+			err = sendMessage(t, env.addr, "alice@forwarded.test", "verify+"+n+"@"+testDomain, msg)
+			if tt.wantCode != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantCode) {
+					t.Fatalf("expected %s rejection, got %v", tt.wantCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("send failed: %v", err)
+			}
+			if _, ok := awaitProof(env, n, time.Second); !ok {
+				t.Fatal("expected proof to be stored")
+			}
+		})
+	}
+}
+
+func TestVerify_EscalationIsPerTransaction(t *testing.T) {
+	f := newAuthFixture(t)
+	f.dns.Add(t, "relay.test.rhs.test. 300 IN A 127.0.1.2")
+	t.Setenv("SMTP_RHSBL_ZONES", "rhs.test:escalate")
+	env := startModeServer(t, "warn", smtpserver.WithResolver(f.resolver))
+	n, err := nonce.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	env.ttlStore.SetWithValue("expected:"+n, "alice@forwarded.test", time.Minute)
+
+	c, err := dialHello(t, env.addr)
+	if err != nil {
+		t.Fatalf("Hello failed: %v", err)
+	}
+	// a listed sender escalates its own transaction only
+	if err := c.Mail("alice@relay.test"); err != nil {
+		t.Fatalf("MAIL failed: %v", err)
+	}
+	if err := c.Reset(); err != nil {
+		t.Fatalf("RSET failed: %v", err)
+	}
+
+	// forwarded.test fails SPF, which warn mode only logs
+	if err := c.Mail("alice@forwarded.test"); err != nil {
+		t.Fatalf("MAIL failed: %v", err)
+	}
+	if err := c.Rcpt("verify+" + n + "@" + testDomain); err != nil {
+		t.Fatalf("RCPT failed: %v", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		t.Fatalf("DATA failed: %v", err)
+	}
+	if _, err := w.Write([]byte(authMessage("alice@forwarded.test", n, "hello"))); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("message rejected after an earlier escalated transaction: %v", err)
+	}
+	if _, ok := awaitProof(env, n, time.Second); !ok {
+		t.Fatal("expected proof to be stored")
+	}
+}
@@ -0,0 +1,106 @@
+package smtp_test
+
+import (
+	"net/smtp"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	"github.com/Goofygiraffe06/zinc/internal/utils"
+)
+
+func TestVerify_InternationalizedAddresses(t *testing.T) {
+	// POST /register stores the address the way utils.NormalizeEmail spells it
+	const registered = "josé@bücher.de"
+
+	tests := []struct {
+		name       string
+		envelope   string
+		headerFrom string
+		wantCode   int
+	}{
+		{name: "U-labels", envelope: "josé@bücher.de", headerFrom: "josé@bücher.de"},
+		{name: "A-labels", envelope: "josé@xn--bcher-kva.de", headerFrom: "josé@xn--bcher-kva.de"},
+		{name: "mixed forms", envelope: "josé@xn--bcher-kva.de", headerFrom: "José <josé@bücher.de>"},
+		{name: "upper case", envelope: "JOSÉ@BÜCHER.DE", headerFrom: "josé@Bücher.de"},
+		// e followed by a combining acute accent
+		{name: "decomposed local part", envelope: "jose\u0301@bücher.de", headerFrom: "josé@bücher.de"},
+		{name: "other mailbox", envelope: "jose@bücher.de", headerFrom: "jose@bücher.de", wantCode: 550},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SMTP_SYNC_VERDICTS", "true")
+			env := startVerifyServer(t)
+			expected, err := utils.NormalizeEmail(registered)
+			if err != nil {
+				t.Fatalf("NormalizeEmail failed: %v", err)
+			}
+			n := pendingNonce(t, env, expected)
+
+			// net/smtp asks for SMTPUTF8 whenever the server offers it
+			err = sendMessage(t, env.addr, tt.envelope, "verify+"+n+"@"+testDomain, verificationMessage(tt.headerFrom, n))
+			if smtpCode(err) != tt.wantCode {
+				t.Fatalf("reply = %v, want %d", err, tt.wantCode)
+			}
+			if tt.wantCode != 0 {
+				return
+			}
+			proof, ok := awaitProof(env, n, time.Second)
+			if !ok {
+				t.Fatal("expected proof to be stored")
+			}
+			if proof != expected {
+				t.Errorf("proof = %q, want %q", proof, expected)
+			}
+		})
+	}
+}
+
+func TestVerify_SMTPUTF8(t *testing.T) {
+	env := startVerifyServer(t)
+	c, err := dialHello(t, env.addr)
+	if err != nil {
+		t.Fatalf("Hello failed: %v", err)
+	}
+	for _, ext := range []string{"SMTPUTF8", "8BITMIME"} {
+		if ok, _ := c.Extension(ext); !ok {
+			t.Errorf("%s not advertised", ext)
+		}
+	}
+
+	n, err := nonce.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	tests := []struct {
+		name     string
+		cmd      string
+		wantCode int
+	}{
+		{name: "UTF-8 sender without SMTPUTF8", cmd: "MAIL FROM:<josé@bücher.de>", wantCode: 553},
+		{name: "ASCII sender", cmd: "MAIL FROM:<jose@xn--bcher-kva.de>", wantCode: 250},
+		{name: "UTF-8 recipient without SMTPUTF8", cmd: "RCPT TO:<verify+" + n + "@bücher.de>", wantCode: 553},
+		{name: "ASCII recipient", cmd: "RCPT TO:<verify+" + n + "@" + testDomain + ">", wantCode: 250},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := rawCommand(t, c, tt.cmd); code != tt.wantCode {
+				t.Errorf("%s = %d, want %d", tt.cmd, code, tt.wantCode)
+			}
+		})
+	}
+}
+
+// rawCommand sends cmd as written, bypassing the parameters net/smtp adds.
+func rawCommand(t *testing.T, c *smtp.Client, cmd string) int {
+	t.Helper()
+	id, err := c.Text.Cmd("%s", cmd)
+	if err != nil {
+		t.Fatalf("%s failed: %v", cmd, err)
+	}
+	c.Text.StartResponse(id)
+	defer c.Text.EndResponse(id)
+	code, _, _ := c.Text.ReadResponse(0)
+	return code
+}
@@ -0,0 +1,107 @@
+package smtp_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+)
+
+// TestCheckARC_Canonicalization changes sealed messages in ways the message
+// signature's canonicalization must or must not absorb.
+func TestCheckARC_Canonicalization(t *testing.T) {
+	f := newAuthFixture(t)
+
+	const (
+		relaxed = "relaxed/relaxed"
+		simple  = "simple/simple"
+		header  = "Received: from a\r\n" +
+			"Received: from b\r\n" +
+			"From: alice@forwarded.test\r\n" +
+			"To: verify+n@" + testDomain + "\r\n" +
+			"Subject: Hello World\r\n"
+		msg      = header + "\r\nHi\r\nthere\r\n"
+		emptyMsg = header + "\r\n"
+	)
+	std := []string{"from", "to", "subject"}
+	replace := func(old, new string) func(string) string {
+		return func(m string) string { return strings.Replace(m, old, new, 1) }
+	}
+	appendBody := func(extra string) func(string) string {
+		return func(m string) string { return m + extra }
+	}
+	// foldSeal splits the seal's b= value, its last tag, over two lines
+	foldSeal := func(m string) string {
+		start := strings.Index(m, "ARC-Seal:")
+		b := start + strings.Index(m[start:], "; b=") + len("; b=")
+		return m[:b+8] + "\r\n " + m[b+8:]
+	}
+
+	tests := []struct {
+		name    string
+		message string
+		canon   string
+		signed  []string
+		edit    func(string) string
+		want    smtpserver.ARCResult
+	}{
+		// relaxed header canonicalization
+		{"relaxed header unchanged", msg, relaxed, std, nil, smtpserver.ARCPass},
+		{"relaxed header lowercases name", msg, relaxed, std, replace("Subject:", "SUBJECT:"), smtpserver.ARCPass},
+		{"relaxed header compresses whitespace", msg, relaxed, std, replace("Subject: Hello World", "Subject:  Hello \t World "), smtpserver.ARCPass},
+		{"relaxed header unfolds", msg, relaxed, std, replace("Subject: Hello World", "Subject: Hello\r\n\tWorld"), smtpserver.ARCPass},
+		{"relaxed header trims around colon", msg, relaxed, std, replace("Subject: ", "Subject \t:  "), smtpserver.ARCPass},
+		{"relaxed header value changed", msg, relaxed, std, replace("Hello World", "Hello Word"), smtpserver.ARCFail},
+
+		// simple header canonicalization
+		{"simple header unchanged", msg, simple, std, nil, smtpserver.ARCPass},
+		{"simple header keeps case", msg, simple, std, replace("Subject:", "SUBJECT:"), smtpserver.ARCFail},
+		{"simple header keeps whitespace", msg, simple, std, replace("Hello World", "Hello  World"), smtpserver.ARCFail},
+		{"simple header keeps folding", msg, simple, std, replace("Hello World", "Hello\r\n World"), smtpserver.ARCFail},
+
+		// body canonicalization
+		{"relaxed body ignores trailing blank lines", msg, relaxed, std, appendBody("\r\n\r\n"), smtpserver.ARCPass},
+		{"relaxed body compresses whitespace", msg, relaxed, std, replace("\r\nthere\r\n", "\r\nthere \t \r\n"), smtpserver.ARCPass},
+		{"relaxed body keeps interior blank lines", msg, relaxed, std, replace("Hi\r\nthere", "Hi\r\n\r\nthere"), smtpserver.ARCFail},
+		{"relaxed body keeps leading whitespace", msg, relaxed, std, replace("\r\nthere\r\n", "\r\n  there\r\n"), smtpserver.ARCFail},
+		{"relaxed empty body", emptyMsg, relaxed, std, appendBody(" \r\n\t\r\n"), smtpserver.ARCPass},
+		{"simple body ignores trailing blank lines", msg, simple, std, appendBody("\r\n\r\n"), smtpserver.ARCPass},
+		{"simple body keeps whitespace", msg, simple, std, replace("\r\nthere\r\n", "\r\nthere \r\n"), smtpserver.ARCFail},
+		{"simple empty body", emptyMsg, simple, std, appendBody("\r\n\r\n"), smtpserver.ARCPass},
+
+		// h= selection
+		{"repeated names sign bottom up", msg, relaxed, []string{"received", "received", "from"}, nil, smtpserver.ARCPass},
+		{"repeated instances reordered", msg, relaxed, []string{"received", "received", "from"},
+			replace("Received: from a\r\nReceived: from b", "Received: from b\r\nReceived: from a"), smtpserver.ARCFail},
+		{"instance added above signed ones", msg, relaxed, []string{"received", "received", "from"},
+			replace("Received: from a", "Received: from c\r\nReceived: from a"), smtpserver.ARCPass},
+		{"instance added below signed ones", msg, relaxed, []string{"received", "received", "from"},
+			replace("Received: from b", "Received: from b\r\nReceived: from c"), smtpserver.ARCFail},
+		{"extra names are skipped", msg, relaxed, []string{"from", "from"}, nil, smtpserver.ARCPass},
+		{"missing names are skipped", msg, relaxed, []string{"cc", "subject"}, nil, smtpserver.ARCPass},
+		{"missing name added after sealing", msg, relaxed, []string{"cc", "subject"},
+			replace("Subject: Hello World\r\n", "Subject: Hello World\r\nCc: eve@forwarded.test\r\n"), smtpserver.ARCFail},
+		{"names are case insensitive", msg, relaxed, []string{"FROM", "Received"}, nil, smtpserver.ARCPass},
+
+		// b= removal
+		{"folded seal signature", msg, relaxed, std, foldSeal, smtpserver.ARCPass},
+	}
+
+	checker := smtpserver.NewDKIMChecker(f.resolver)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed := sealARCWith(f.listSealer(), tt.message, "lists.test; dmarc=pass", tt.canon, tt.signed)
+			if tt.edit != nil {
+				sealed = tt.edit(sealed)
+			}
+			eval := checker.CheckARC(context.Background(), []byte(sealed), nil)
+			if eval.Result != tt.want {
+				t.Fatalf("Result = %s (%s), want %s", eval.Result, eval.Reason, tt.want)
+			}
+			if tt.want == smtpserver.ARCFail && !strings.Contains(eval.Reason, "ams i=1") {
+				t.Errorf("Reason = %q, want the message signature to fail", eval.Reason)
+			}
+		})
+	}
+}
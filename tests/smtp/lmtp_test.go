@@ -0,0 +1,141 @@
+package smtp_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/internal/manager"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+	"github.com/Goofygiraffe06/zinc/store/ephemeral"
+	smtpcore "github.com/emersion/go-smtp"
+)
+
+func newUnrestrictedBackend(t *testing.T) (*smtpserver.Backend, *verifyEnv) {
+	t.Helper()
+	t.Setenv("SMTP_VERIFICATION_MODE", "unrestricted")
+	ttlStore := ephemeral.NewTTLStore()
+	registry := controller.NewVerificationRegistry()
+	mgr := manager.NewWorkManager()
+	t.Cleanup(mgr.Close)
+	b := smtpserver.NewBackend(ttlStore, registry, mgr, testDomain)
+	return b, &verifyEnv{ttlStore: ttlStore, registry: registry}
+}
+
+func pendingNonce(t *testing.T, env *verifyEnv, email string) string {
+	t.Helper()
+	n, err := nonce.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	env.ttlStore.SetWithValue("expected:"+n, email, time.Minute)
+	return n
+}
+
+func TestVerify_LMTP(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "zinc.sock")
+	t.Setenv("SMTP_LISTEN_ADDR", "off")
+	t.Setenv("SMTP_LMTP_SOCKET", socket)
+	b, env := newUnrestrictedBackend(t)
+	srv := smtpserver.NewServer(b)
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(srv.Stop)
+	if srv.ListenAddr() != nil {
+		t.Errorf("TCP listener started with SMTP_LISTEN_ADDR=off")
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	c := smtpcore.NewClientLMTP(conn)
+	defer c.Close()
+
+	n := pendingNonce(t, env, "alice@example.org")
+	good := "verify+" + n + "@" + testDomain
+	bad := "verify+not-a-nonce@" + testDomain
+
+	if err := c.Mail("alice@example.org", nil); err != nil {
+		t.Fatalf("MAIL failed: %v", err)
+	}
+	for _, rcpt := range []string{good, bad} {
+		if err := c.Rcpt(rcpt, nil); err != nil {
+			t.Fatalf("RCPT %s failed: %v", rcpt, err)
+		}
+	}
+	// the MTA in front already accepted this one, so it must be refused
+	if err := c.Rcpt("postmaster@"+testDomain, nil); smtpCode(err) != 550 {
+		t.Fatalf("RCPT to non-verify address = %v, want 550", err)
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		t.Fatalf("DATA failed: %v", err)
+	}
+	if _, err := fmt.Fprint(w, authMessage("alice@example.org", n, "hello")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	_, err = w.CloseWithLMTPResponse()
+	var lmtpErr smtpcore.LMTPDataError
+	if !errors.As(err, &lmtpErr) {
+		t.Fatalf("expected per-recipient errors, got %v", err)
+	}
+	if _, ok := lmtpErr[good]; ok {
+		t.Errorf("valid recipient was refused: %v", lmtpErr[good])
+	}
+	if e, ok := lmtpErr[bad]; !ok || e.Code != 550 {
+		t.Errorf("malformed nonce status = %v, want 550", e)
+	}
+
+	if r := awaitReport(env, n); r == nil {
+		t.Fatal("expected a report for the valid recipient")
+	}
+}
+
+func TestBackend_Ingest(t *testing.T) {
+	b, env := newUnrestrictedBackend(t)
+	n := pendingNonce(t, env, "alice@example.org")
+	msg := "Received: from mail.example.org (mail.example.org [192.0.2.1])\r\n" +
+		"\tby mx.zinc.test (Postfix) with ESMTPS id 4Xyz; Mon, 1 Jan 2024 00:00:00 +0000\r\n" +
+		authMessage("alice@example.org", n, "hello")
+
+	tests := []struct {
+		rcpt     string
+		wantCode int
+	}{
+		{rcpt: "verify+" + n + "@" + testDomain},
+		{rcpt: "verify+not-a-nonce@" + testDomain, wantCode: 550},
+		{rcpt: "postmaster@" + testDomain, wantCode: 550},
+	}
+	rcpts := make([]string, len(tests))
+	for i, tt := range tests {
+		rcpts[i] = tt.rcpt
+	}
+
+	errs, err := b.Ingest(strings.NewReader(msg), "alice@example.org", rcpts)
+	if err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+	for i, tt := range tests {
+		if smtpCode(errs[i]) != tt.wantCode {
+			t.Errorf("status for %s = %v, want %d", tt.rcpt, errs[i], tt.wantCode)
+		}
+	}
+
+	r := awaitReport(env, n)
+	if r == nil {
+		t.Fatal("expected a report")
+	}
+	// the origin comes from the Received header, not the pipe
+	if r.RemoteIP != "192.0.2.1" {
+		t.Errorf("report remote IP = %q, want 192.0.2.1", r.RemoteIP)
+	}
+}
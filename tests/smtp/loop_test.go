@@ -0,0 +1,106 @@
+package smtp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/internal/metrics"
+)
+
+func bounceMessage(n, reportType, statusType string) string {
+	return "From: alice@example.org\r\n" +
+		"To: verify+" + n + "@" + testDomain + "\r\n" +
+		"Subject: Undelivered Mail Returned to Sender\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/" + reportType + "; boundary=\"b1\"\r\n" +
+		"\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Your message could not be delivered.\r\n" +
+		"--b1\r\n" +
+		"Content-Type: " + statusType + "\r\n" +
+		"\r\n" +
+		"Reporting-MTA: dns; mx.example.org\r\n" +
+		"--b1--\r\n"
+}
+
+func TestVerify_DropsAutomatedMail(t *testing.T) {
+	tests := []struct {
+		name       string
+		from       string
+		message    func(n string) string
+		wantReason string
+	}{
+		{name: "plain", from: "alice@example.org",
+			message: func(n string) string { return verificationMessage("alice@example.org", n) }},
+		{name: "null sender", from: "", wantReason: "null_sender",
+			message: func(n string) string { return verificationMessage("alice@example.org", n) }},
+		{name: "return-path null", from: "alice@example.org", wantReason: "null_sender",
+			message: func(n string) string { return "Return-Path: <>\r\n" + verificationMessage("alice@example.org", n) }},
+		{name: "auto-submitted", from: "alice@example.org", wantReason: "auto_submitted",
+			message: func(n string) string {
+				return "Auto-Submitted: auto-replied (vacation)\r\n" + verificationMessage("alice@example.org", n)
+			}},
+		{name: "auto-submitted no", from: "alice@example.org",
+			message: func(n string) string { return "Auto-Submitted: no\r\n" + verificationMessage("alice@example.org", n) }},
+		{name: "precedence bulk", from: "alice@example.org", wantReason: "precedence",
+			message: func(n string) string { return "Precedence: bulk\r\n" + verificationMessage("alice@example.org", n) }},
+		{name: "precedence list", from: "alice@example.org", wantReason: "precedence",
+			message: func(n string) string { return "Precedence: List\r\n" + verificationMessage("alice@example.org", n) }},
+		{name: "list-id", from: "alice@example.org", wantReason: "list_id",
+			message: func(n string) string {
+				return "List-Id: Friends <friends.lists.example.org>\r\n" + verificationMessage("alice@example.org", n)
+			}},
+		{name: "multipart/report", from: "alice@example.org", wantReason: "delivery_status",
+			message: func(n string) string {
+				return bounceMessage(n, "report; report-type=delivery-status", "message/delivery-status")
+			}},
+		{name: "nested delivery-status", from: "alice@example.org", wantReason: "delivery_status",
+			message: func(n string) string { return bounceMessage(n, "mixed", "message/delivery-status") }},
+		{name: "unrelated multipart", from: "alice@example.org",
+			message: func(n string) string { return bounceMessage(n, "mixed", "text/html") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := startVerifyServer(t)
+			n := pendingNonce(t, env, "alice@example.org")
+
+			// dropped mail is still accepted so the sender has nothing to answer
+			if err := sendMessage(t, env.addr, tt.from, "verify+"+n+"@"+testDomain, tt.message(n)); err != nil {
+				t.Fatalf("send failed: %v", err)
+			}
+
+			if tt.wantReason == "" {
+				if _, ok := awaitProof(env, n, time.Second); !ok {
+					t.Fatal("expected the nonce to be verified")
+				}
+				return
+			}
+			if _, ok := awaitProof(env, n, 200*time.Millisecond); ok {
+				t.Fatal("automated mail verified the nonce")
+			}
+			if _, ok := controller.LoadReport(env.ttlStore, n); ok {
+				t.Error("automated mail left a report")
+			}
+			if !strings.Contains(scrapeMetrics(t), `zinc_smtp_dropped_messages_total{reason="`+tt.wantReason+`"}`) {
+				t.Errorf("no dropped-message count for reason %q", tt.wantReason)
+			}
+		})
+	}
+}
+
+func scrapeMetrics(t *testing.T) string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("metrics returned %d", rr.Code)
+	}
+	return rr.Body.String()
+}
@@ -0,0 +1,187 @@
+package smtp_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr string
+	}{
+		{name: "valid", policy: `{"rules":[{"name":"own","domains":["example.org","*.example.org"],"require":["tls","spf"],"ips":["192.0.2.0/24","2001:db8::1"]}]}`},
+		{name: "no rules", policy: `{"rules":[]}`, wantErr: "no rules"},
+		{name: "unknown field", policy: `{"rules":[{"domains":["*"],"requires":["spf"]}]}`, wantErr: "unknown field"},
+		{name: "unknown requirement", policy: `{"rules":[{"domains":["*"],"require":["bimi"]}]}`, wantErr: "unknown requirement"},
+		{name: "bad pattern", policy: `{"rules":[{"domains":["[example.org"],"require":["spf"]}]}`, wantErr: "invalid domain pattern"},
+		{name: "no domains", policy: `{"rules":[{"require":["spf"]}]}`, wantErr: "no domains"},
+		{name: "bad network", policy: `{"rules":[{"domains":["*"],"ips":["192.0.2.0/33"]}]}`, wantErr: "invalid network"},
+		{name: "bad action", policy: `{"rules":[{"domains":["*"],"require":["spf"],"action":"drop"}]}`, wantErr: "unknown action"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := smtpserver.ParsePolicy([]byte(tt.policy))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ParsePolicy failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPolicy_Match(t *testing.T) {
+	p, err := smtpserver.ParsePolicy([]byte(`{"rules":[
+		{"name":"gmail","domains":["gmail.com"],"require":["dkim_aligned"]},
+		{"name":"subdomains","domains":["*.example.org"],"require":["spf"]},
+		{"name":"default","domains":["*"],"require":["spf"]}
+	]}`))
+	if err != nil {
+		t.Fatalf("ParsePolicy failed: %v", err)
+	}
+
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{domain: "gmail.com", want: "gmail"},
+		{domain: "GMAIL.COM.", want: "gmail"},
+		{domain: "mail.example.org", want: "subdomains"},
+		{domain: "a.b.example.org", want: "subdomains"},
+		{domain: "example.org", want: "default"},
+		{domain: "unknown.test", want: "default"},
+	}
+	for _, tt := range tests {
+		rule := p.Match(tt.domain)
+		if rule == nil || rule.Name != tt.want {
+			t.Errorf("Match(%q) = %+v, want rule %q", tt.domain, rule, tt.want)
+		}
+	}
+}
+
+const testPolicy = `{"rules":[
+	{"name":"direct","domains":["direct.test"],"require":["dkim_aligned","spf"],"ips":["127.0.0.1"]},
+	{"name":"own","domains":["relay.test"],"require":["tls"]},
+	{"name":"lenient","domains":["lenient.test"],"require":["spf"],"action":"warn"},
+	{"name":"default","domains":["*"],"require":["spf"]}
+]}`
+
+func writePolicy(t *testing.T, file, policy string) {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(policy), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+}
+
+func TestVerify_Policy(t *testing.T) {
+	f := newAuthFixture(t)
+	file := filepath.Join(t.TempDir(), "policy.json")
+	writePolicy(t, file, testPolicy)
+
+	tests := []struct {
+		name       string
+		envelope   string
+		sign       bool
+		wantCode   string
+		wantPolicy string
+	}{
+		{name: "aligned DKIM from allowed IP", envelope: "alice@direct.test", sign: true, wantPolicy: "direct"},
+		{name: "missing DKIM", envelope: "alice@direct.test", wantCode: "550"},
+		{name: "plaintext from own domain", envelope: "alice@relay.test", wantCode: "550"},
+		{name: "warn rule", envelope: "alice@lenient.test", wantPolicy: "lenient"},
+		{name: "default rule SPF fail", envelope: "alice@forwarded.test", wantCode: "550"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SMTP_POLICY_FILE", file)
+			// the policy runs even though the global mode checks nothing
+			env := startModeServer(t, "unrestricted", smtpserver.WithResolver(f.resolver))
+			n, err := nonce.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			env.ttlStore.SetWithValue("expected:"+n, tt.envelope, time.Minute)
+
+			msg := authMessage(tt.envelope, n, "hello")
+			if tt.sign {
+				msg = f.dkimSign(t, msg)
+			}
+			err = sendMessage(t, env.addr, tt.envelope, "verify+"+n+"@"+testDomain, msg)
+			if tt.wantCode != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantCode) {
+					t.Fatalf("expected %s rejection, got %v", tt.wantCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("send failed: %v", err)
+			}
+			r := awaitReport(env, n)
+			if r == nil {
+				t.Fatal("expected a report")
+			}
+			if r.Policy != tt.wantPolicy {
+				t.Errorf("report policy = %q, want %q", r.Policy, tt.wantPolicy)
+			}
+		})
+	}
+}
+
+func TestVerify_PolicyReload(t *testing.T) {
+	f := newAuthFixture(t)
+	file := filepath.Join(t.TempDir(), "policy.json")
+	writePolicy(t, file, `{"rules":[{"name":"strict","domains":["*"],"require":["spf"]}]}`)
+	t.Setenv("SMTP_POLICY_FILE", file)
+	t.Setenv("SMTP_POLICY_RELOAD_INTERVAL", "20ms")
+	env := startModeServer(t, "unrestricted", smtpserver.WithResolver(f.resolver))
+
+	send := func() error {
+		n, err := nonce.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		env.ttlStore.SetWithValue("expected:"+n, "alice@forwarded.test", time.Minute)
+		return sendMessage(t, env.addr, "alice@forwarded.test", "verify+"+n+"@"+testDomain,
+			authMessage("alice@forwarded.test", n, "hello"))
+	}
+	awaitSend := func(wantErr bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			err := send()
+			if (err != nil) == wantErr {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("send error = %v, want error %v", err, wantErr)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	awaitSend(true)
+
+	writePolicy(t, file, `{"rules":[{"name":"relaxed","domains":["*"],"require":["spf"],"action":"warn"}]}`)
+	awaitSend(false)
+
+	// an invalid file is rejected and the relaxed policy stays in force
+	writePolicy(t, file, `{"rules":[{"name":"broken","domains":["*"],"require":["nonsense"]}]}`)
+	time.Sleep(100 * time.Millisecond)
+	if err := send(); err != nil {
+		t.Fatalf("invalid policy replaced the previous one: %v", err)
+	}
+}
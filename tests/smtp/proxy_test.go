@@ -0,0 +1,167 @@
+package smtp_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+	"github.com/pires/go-proxyproto"
+)
+
+// sendProxied delivers a message after writing header, if any, on a raw connection.
+func sendProxied(t *testing.T, addr string, header []byte, envelopeFrom, rcpt, msg string) error {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	if len(header) > 0 {
+		if _, err := conn.Write(header); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	c, err := smtp.NewClient(conn, "127.0.0.1")
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := c.Mail(envelopeFrom); err != nil {
+		return err
+	}
+	if err := c.Rcpt(rcpt); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprint(w, msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func proxyHeader(t *testing.T, version byte, clientIP string) []byte {
+	t.Helper()
+	h := &proxyproto.Header{
+		Version:           version,
+		Command:           proxyproto.PROXY,
+		TransportProtocol: proxyproto.TCPv4,
+		SourceAddr:        &net.TCPAddr{IP: net.ParseIP(clientIP), Port: 40000},
+		DestinationAddr:   &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 25},
+	}
+	b, err := h.Format()
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	return b
+}
+
+func TestVerify_ProxyProtocol(t *testing.T) {
+	f := newAuthFixture(t)
+
+	tests := []struct {
+		name     string
+		trusted  string
+		header   func(t *testing.T) []byte
+		wantIP   string
+		wantCode string
+	}{
+		// forwarded.test only authorizes 192.0.2.1, so SPF passes only when the
+		// header's client address is used
+		{name: "v1 header from trusted proxy", trusted: "127.0.0.0/8",
+			header: func(t *testing.T) []byte { return proxyHeader(t, 1, "192.0.2.1") }, wantIP: "192.0.2.1"},
+		{name: "v2 header from trusted proxy", trusted: "127.0.0.1",
+			header: func(t *testing.T) []byte { return proxyHeader(t, 2, "192.0.2.1") }, wantIP: "192.0.2.1"},
+		{name: "no header from untrusted peer", trusted: "10.0.0.0/8", wantCode: "550"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SMTP_PROXY_TRUSTED_CIDRS", tt.trusted)
+			env := startModeServer(t, "strict", smtpserver.WithResolver(f.resolver))
+			n, err := nonce.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			env.ttlStore.SetWithValue("expected:"+n, "alice@forwarded.test", time.Minute)
+
+			var header []byte
+			if tt.header != nil {
+				header = tt.header(t)
+			}
+			err = sendProxied(t, env.addr, header, "alice@forwarded.test", "verify+"+n+"@"+testDomain,
+				authMessage("alice@forwarded.test", n, "hello"))
+			if tt.wantCode != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantCode) {
+					t.Fatalf("expected %s rejection, got %v", tt.wantCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("send failed: %v", err)
+			}
+			r := awaitReport(env, n)
+			if r == nil {
+				t.Fatal("expected a report")
+			}
+			if r.RemoteIP != tt.wantIP {
+				t.Errorf("report remote IP = %q, want %q", r.RemoteIP, tt.wantIP)
+			}
+		})
+	}
+}
+
+func TestVerify_ProxyProtocolRaw(t *testing.T) {
+	tests := []struct {
+		name      string
+		trusted   string
+		sendProxy bool
+		wantReply string
+	}{
+		// the proxy's own address must never be used for a session
+		{name: "trusted peer without header", trusted: "127.0.0.0/8", wantReply: "421"},
+		// an untrusted peer's header is just a malformed SMTP command
+		{name: "untrusted peer with header", trusted: "10.0.0.0/8", sendProxy: true, wantReply: "5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SMTP_PROXY_TRUSTED_CIDRS", tt.trusted)
+			t.Setenv("SMTP_PROXY_HEADER_TIMEOUT", "200ms")
+			env := startVerifyServer(t)
+
+			conn, err := net.Dial("tcp", env.addr)
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			r := bufio.NewReader(conn)
+			if line, err := r.ReadString('\n'); err != nil || !strings.HasPrefix(line, "220") {
+				t.Fatalf("greeting = %q, %v", line, err)
+			}
+			out := []byte("EHLO client.test\r\n")
+			if tt.sendProxy {
+				out = proxyHeader(t, 1, "192.0.2.1")
+			}
+			if _, err := conn.Write(out); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			line, err := r.ReadString('\n')
+			if err != nil || !strings.HasPrefix(line, tt.wantReply) {
+				t.Fatalf("reply = %q, %v; want %s", line, err, tt.wantReply)
+			}
+		})
+	}
+}
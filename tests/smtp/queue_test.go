@@ -0,0 +1,206 @@
+package smtp_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/internal/manager"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+	"github.com/Goofygiraffe06/zinc/store"
+	"github.com/Goofygiraffe06/zinc/store/ephemeral"
+)
+
+func newWorkQueue(t *testing.T) *store.SQLiteWorkQueue {
+	t.Helper()
+	s, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore failed: %v", err)
+	}
+	return store.NewSQLiteWorkQueue(s)
+}
+
+func queueLen(t *testing.T, q *store.SQLiteWorkQueue) int {
+	t.Helper()
+	tasks, err := q.Claim(time.Now().Add(time.Hour), 0, 100)
+	if err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+	return len(tasks)
+}
+
+func TestBackend_ReplaysQueueOnStart(t *testing.T) {
+	tests := []struct {
+		name        string
+		proofStored bool
+	}{
+		{name: "unprocessed"},
+		// the previous process stored the proof but died before completing the task
+		{name: "already processed", proofStored: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SMTP_VERIFICATION_MODE", "unrestricted")
+			ttlStore := ephemeral.NewTTLStore()
+			registry := controller.NewVerificationRegistry()
+			env := &verifyEnv{ttlStore: ttlStore, registry: registry}
+			n := pendingNonce(t, env, "alice@example.org")
+			if tt.proofStored {
+				ttlStore.SetWithValue(n, "alice@example.org", time.Minute)
+			}
+			wait := registry.Register(n)
+			defer registry.Delete(n)
+
+			// left leased by a process that crashed mid-task
+			q := newWorkQueue(t)
+			report := models.VerificationReport{EnvelopeFrom: "alice@example.org", HeaderFrom: "alice@example.org"}
+			if _, err := q.Enqueue(models.VerifyTask{Nonce: n, Report: report, NextAttemptAt: time.Now().Add(time.Minute)}); err != nil {
+				t.Fatalf("Enqueue failed: %v", err)
+			}
+
+			mgr := manager.NewWorkManager()
+			t.Cleanup(mgr.Close)
+			b := smtpserver.NewBackend(ttlStore, registry, mgr, testDomain, smtpserver.WithWorkQueue(q))
+			b.StartQueue()
+			defer b.StopQueue()
+
+			select {
+			case <-wait:
+			case <-time.After(2 * time.Second):
+				t.Fatal("expected the waiting registration to be notified")
+			}
+			if v, ok := ttlStore.Get(n); !ok || v != "alice@example.org" {
+				t.Errorf("proof = %q, %v", v, ok)
+			}
+			deadline := time.Now().Add(time.Second)
+			for queueLen(t, q) != 0 {
+				if time.Now().After(deadline) {
+					t.Fatal("task was not completed")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestVerify_QueueSurvivesFullPool(t *testing.T) {
+	t.Setenv("SMTP_LISTEN_ADDR", "127.0.0.1:0")
+	t.Setenv("SMTP_VERIFICATION_MODE", "unrestricted")
+	t.Setenv("SMTP_QUEUE_POLL_INTERVAL", "20ms")
+
+	ttlStore := ephemeral.NewTTLStore()
+	registry := controller.NewVerificationRegistry()
+	mgr := manager.NewWorkManager(manager.WithSMTPWorkers(1), manager.WithQueueSize(1))
+	t.Cleanup(mgr.Close)
+
+	// occupy the only worker and the only queue slot
+	release := make(chan struct{})
+	started := make(chan struct{})
+	block := func(ctx context.Context) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+	}
+	if err := mgr.SubmitSMTP(block); err != nil {
+		t.Fatalf("SubmitSMTP failed: %v", err)
+	}
+	<-started
+	if err := mgr.SubmitSMTP(block); err != nil {
+		t.Fatalf("SubmitSMTP failed: %v", err)
+	}
+
+	q := newWorkQueue(t)
+	b := smtpserver.NewBackend(ttlStore, registry, mgr, testDomain, smtpserver.WithWorkQueue(q))
+	b.StartQueue()
+	defer b.StopQueue()
+	srv := smtpserver.NewServer(b)
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(srv.Stop)
+
+	env := &verifyEnv{addr: srv.ListenAddr().String(), ttlStore: ttlStore, registry: registry}
+	n := pendingNonce(t, env, "alice@example.org")
+	if err := sendMessage(t, env.addr, "alice@example.org", "verify+"+n+"@"+testDomain, verificationMessage("alice@example.org", n)); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if _, ok := awaitProof(env, n, 100*time.Millisecond); ok {
+		t.Fatal("nonce processed while the pool was blocked")
+	}
+
+	close(release)
+	if _, ok := awaitProof(env, n, 2*time.Second); !ok {
+		t.Fatal("expected the queued nonce to be processed once the pool drained")
+	}
+}
+
+func TestVerify_QueueSurvivesServiceOutage(t *testing.T) {
+	t.Setenv("SMTP_LISTEN_ADDR", "127.0.0.1:0")
+	t.Setenv("SMTP_VERIFICATION_MODE", "unrestricted")
+	t.Setenv("SMTP_SYNC_VERDICTS", "true")
+
+	// the verification service of a ZINC_ROLE=smtp listener
+	dir := t.TempDir()
+	userStore, err := store.NewSQLiteStore(filepath.Join(dir, "users.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore failed: %v", err)
+	}
+	t.Cleanup(func() { userStore.Close() })
+	proofs := store.NewSQLiteProofStore(userStore)
+	addr := "unix:" + filepath.Join(dir, "verify.sock")
+	ln, err := controller.ListenService(addr)
+	if err != nil {
+		t.Fatalf("ListenService failed: %v", err)
+	}
+	svc := controller.NewRemoteServer(controller.NewVerificationRegistry(), proofs, "secret")
+	if err := svc.Start(ln); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	client := controller.NewRemoteClient(addr, "secret", time.Second)
+	t.Cleanup(func() { client.Close() })
+
+	mgr := manager.NewWorkManager()
+	t.Cleanup(mgr.Close)
+	q := newWorkQueue(t)
+	b := smtpserver.NewBackend(client, client, mgr, testDomain, smtpserver.WithWorkQueue(q))
+	srv := smtpserver.NewServer(b)
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(srv.Stop)
+
+	n, err := nonce.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	proofs.SetWithValue("expected:"+n, "alice@example.org", time.Minute)
+	svc.Stop()
+
+	err = sendMessage(t, srv.ListenAddr().String(), "alice@example.org", "verify+"+n+"@"+testDomain, verificationMessage("alice@example.org", n))
+	if smtpCode(err) != 451 {
+		t.Fatalf("reply during the outage = %v, want 451", err)
+	}
+
+	// the attempt is recorded and the task kept for a retry
+	deadline := time.Now().Add(time.Second)
+	for {
+		tasks, err := q.Claim(time.Now().Add(time.Hour), 0, 10)
+		if err != nil {
+			t.Fatalf("Claim failed: %v", err)
+		}
+		if len(tasks) == 1 && tasks[0].Nonce == n && tasks[0].Attempts == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("queued tasks = %+v, want the nonce kept after one attempt", tasks)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,190 @@
+package smtp_test
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+	"github.com/Goofygiraffe06/zinc/store"
+)
+
+// registrationBody lists the fields the way a CLI client would write them.
+func registrationBody(username, pub, sig string) string {
+	return "Username: " + username + "\r\n" +
+		"Public-Key: " + pub + "\r\n" +
+		"Signature: " + sig + "\r\n"
+}
+
+// signNonce signs n with a fresh key and returns both, base64 encoded.
+func signNonce(t *testing.T, n string) (pub, sig string) {
+	t.Helper()
+	pk, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(pk), base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(n)))
+}
+
+func registrationMessage(from, n, body string) string {
+	return "From: " + from + "\r\n" +
+		"To: verify+" + n + "@" + testDomain + "\r\n" +
+		"Subject: register\r\n" +
+		"\r\n" + body
+}
+
+// registrationPart puts the fields in a base64 application/zinc-registration
+// part next to a human-readable one.
+func registrationPart(from, n, body string) string {
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	return "From: " + from + "\r\n" +
+		"To: verify+" + n + "@" + testDomain + "\r\n" +
+		"Subject: register\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+		"\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Sent by zinc-cli.\r\n" +
+		"--b1\r\n" +
+		"Content-Type: " + smtpserver.RegistrationContentType + "\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		encoded[:20] + "\r\n" + encoded[20:] + "\r\n" +
+		"--b1--\r\n"
+}
+
+func TestVerify_EmailRegistration(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	pubB64 := base64.StdEncoding.EncodeToString(pub)
+	sign := func(n string) string { return base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(n))) }
+
+	tests := []struct {
+		name       string
+		from       string // envelope sender; the header From is alice's
+		existing   bool   // alice already has an account
+		pending    bool   // POST /register is waiting on the nonce
+		message    func(n string) string
+		wantCode   int
+		wantStatus string // stored outcome; empty means none
+		wantUser   bool
+	}{
+		{name: "text body", from: "alice@example.org", wantStatus: "ok", wantUser: true,
+			message: func(n string) string {
+				return registrationMessage("alice@example.org", n, registrationBody("Alice", pubB64, sign(n)))
+			}},
+		{name: "wrapped signature", from: "alice@example.org", wantStatus: "ok", wantUser: true,
+			message: func(n string) string {
+				sig := sign(n)
+				return registrationMessage("alice@example.org", n, registrationBody("alice", pubB64, sig[:40]+"\r\n "+sig[40:]))
+			}},
+		{name: "registration part", from: "alice@example.org", wantStatus: "ok", wantUser: true,
+			message: func(n string) string {
+				return registrationPart("alice@example.org", n, registrationBody("alice", pubB64, sign(n)))
+			}},
+		{name: "signature over another nonce", from: "alice@example.org", wantCode: 550, wantStatus: "failed",
+			message: func(n string) string {
+				return registrationMessage("alice@example.org", n, registrationBody("alice", pubB64, sign("other")))
+			}},
+		{name: "already registered", from: "alice@example.org", existing: true, wantCode: 550, wantStatus: "failed",
+			message: func(n string) string {
+				return registrationMessage("alice@example.org", n, registrationBody("alice", pubB64, sign(n)))
+			}},
+		{name: "header From mismatch", from: "mallory@example.org", wantCode: 550, wantStatus: "failed",
+			message: func(n string) string {
+				return registrationMessage("alice@example.org", n, registrationBody("alice", pubB64, sign(n)))
+			}},
+		{name: "missing field", from: "alice@example.org", wantCode: 550,
+			message: func(n string) string {
+				return registrationMessage("alice@example.org", n, "Username: alice\r\nPublic-Key: "+pubB64+"\r\n")
+			}},
+		// POST /register owns the nonce and the message only verifies it
+		{name: "pending registration", from: "alice@example.org", pending: true,
+			message: func(n string) string {
+				return registrationMessage("alice@example.org", n, registrationBody("alice", pubB64, sign(n)))
+			}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SMTP_SYNC_VERDICTS", "true")
+			users, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "users.db"))
+			if err != nil {
+				t.Fatalf("NewSQLiteStore failed: %v", err)
+			}
+			if tt.existing {
+				if err := users.AddUser(models.User{Email: "alice@example.org", Username: "alice", PublicKey: pubB64}); err != nil {
+					t.Fatalf("AddUser failed: %v", err)
+				}
+			}
+			env := startModeServer(t, "unrestricted", smtpserver.WithRegistrar(users))
+			n, err := nonce.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			if tt.pending {
+				env.ttlStore.SetWithValue("expected:"+n, "alice@example.org", time.Minute)
+			}
+
+			err = sendMessage(t, env.addr, tt.from, "verify+"+n+"@"+testDomain, tt.message(n))
+			if smtpCode(err) != tt.wantCode {
+				t.Fatalf("reply = %v, want %d", err, tt.wantCode)
+			}
+
+			o, ok := controller.LoadOutcome(env.ttlStore, n)
+			if tt.wantStatus == "" {
+				if ok {
+					t.Errorf("unexpected outcome %+v", o)
+				}
+			} else if !ok || o.Status != tt.wantStatus {
+				t.Fatalf("outcome = %+v, want status %q", o, tt.wantStatus)
+			}
+			if ok && o.Verification == nil {
+				t.Error("outcome has no verification report")
+			}
+
+			user, found := users.GetUser("alice@example.org")
+			if tt.wantUser {
+				if !found || user.Username != "alice" || user.PublicKey != pubB64 {
+					t.Fatalf("user = %+v (found %t), want alice's account", user, found)
+				}
+				if user.VerificationReport == nil || user.VerificationReport.Decision != models.DecisionAccepted {
+					t.Errorf("user report = %+v, want accepted", user.VerificationReport)
+				}
+			} else if found && !tt.existing {
+				t.Error("unexpected account created")
+			}
+			if tt.pending {
+				if _, ok := env.ttlStore.Get(n); !ok {
+					t.Error("expected a stored proof for the pending registration")
+				}
+			}
+		})
+	}
+}
+
+func TestVerify_EmailRegistrationDisabled(t *testing.T) {
+	t.Setenv("SMTP_SYNC_VERDICTS", "true")
+	env := startVerifyServer(t)
+	n, err := nonce.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	pub, sig := signNonce(t, n)
+	body := registrationBody("alice", pub, sig)
+
+	err = sendMessage(t, env.addr, "alice@example.org", "verify+"+n+"@"+testDomain, registrationMessage("alice@example.org", n, body))
+	if smtpCode(err) != 550 || !strings.Contains(err.Error(), "Verification expired") {
+		t.Fatalf("reply = %v, want the ordinary expired verdict", err)
+	}
+	if _, ok := controller.LoadOutcome(env.ttlStore, n); ok {
+		t.Error("outcome stored without a registrar")
+	}
+}
@@ -0,0 +1,88 @@
+package smtp_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+)
+
+func TestVerify_TrustedRelay(t *testing.T) {
+	f := newAuthFixture(t)
+	const (
+		// forwarded.test only authorizes 192.0.2.1
+		originHop = "Received: from mail.forwarded.test (mail.forwarded.test [192.0.2.1])\r\n" +
+			"\tby mx.zinc.test (Postfix) with ESMTPS id 4Xyz; Mon, 1 Jan 2024 00:00:00 +0000\r\n"
+		spoofedHop = "Received: from mail.forwarded.test (unknown [198.51.100.7])\r\n" +
+			"\tby mx.zinc.test (Postfix) with ESMTP id 4Xyz; Mon, 1 Jan 2024 00:00:00 +0000\r\n"
+		eximHop = "Received: from [192.0.2.1] (helo=exim.forwarded.test)\r\n" +
+			"\tby mx.zinc.test with esmtp (Exim 4.96); Mon, 1 Jan 2024 00:00:00 +0000\r\n"
+		internalHop = "Received: from mx.zinc.test (mx.zinc.test [127.0.0.2])\r\n" +
+			"\tby filter.zinc.test (Postfix) with ESMTP id 5Abc; Mon, 1 Jan 2024 00:00:01 +0000\r\n"
+		relayAR  = "Authentication-Results: mx.zinc.test; spf=pass smtp.mailfrom=alice@forwarded.test\r\n"
+		otherAR  = "Authentication-Results: elsewhere.test; spf=pass smtp.mailfrom=alice@forwarded.test\r\n"
+		trustIDs = "mx.zinc.test"
+	)
+
+	tests := []struct {
+		name     string
+		relays   string
+		ids      string
+		headers  string
+		wantIP   string
+		wantHELO string
+		wantCode string
+	}{
+		{name: "origin from Received", relays: "127.0.0.0/8", headers: originHop,
+			wantIP: "192.0.2.1", wantHELO: "mail.forwarded.test"},
+		{name: "exim Received", relays: "127.0.0.0/8", headers: eximHop,
+			wantIP: "192.0.2.1", wantHELO: "exim.forwarded.test"},
+		{name: "hops between relays are skipped", relays: "127.0.0.0/8", headers: internalHop + originHop,
+			wantIP: "192.0.2.1", wantHELO: "mail.forwarded.test"},
+		{name: "origin not authorized by SPF", relays: "127.0.0.0/8", headers: spoofedHop, wantCode: "550"},
+		{name: "peer is not a trusted relay", relays: "10.0.0.0/8", headers: originHop, wantCode: "550"},
+		{name: "no Received header", relays: "127.0.0.0/8", wantCode: "550"},
+		{name: "relay Authentication-Results trusted", relays: "127.0.0.0/8", ids: trustIDs, headers: relayAR + spoofedHop,
+			wantIP: "198.51.100.7", wantHELO: "mail.forwarded.test"},
+		{name: "Authentication-Results below origin hop ignored", relays: "127.0.0.0/8", ids: trustIDs, headers: spoofedHop + relayAR,
+			wantCode: "550"},
+		{name: "Authentication-Results from other server ignored", relays: "127.0.0.0/8", ids: trustIDs, headers: otherAR + spoofedHop,
+			wantCode: "550"},
+		{name: "Authentication-Results not trusted without ids", relays: "127.0.0.0/8", headers: relayAR + spoofedHop,
+			wantCode: "550"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SMTP_TRUSTED_RELAYS", tt.relays)
+			t.Setenv("SMTP_TRUSTED_RELAY_AUTHSERV_IDS", tt.ids)
+			env := startModeServer(t, "strict", smtpserver.WithResolver(f.resolver))
+			n, err := nonce.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			env.ttlStore.SetWithValue("expected:"+n, "alice@forwarded.test", time.Minute)
+
+			msg := tt.headers + authMessage("alice@forwarded.test", n, "hello")
+			err = sendMessage(t, env.addr, "alice@forwarded.test", "verify+"+n+"@"+testDomain, msg)
+			if tt.wantCode != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantCode) {
+					t.Fatalf("expected %s rejection, got %v", tt.wantCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("send failed: %v", err)
+			}
+			r := awaitReport(env, n)
+			if r == nil {
+				t.Fatal("expected a report")
+			}
+			if r.RemoteIP != tt.wantIP || r.HELO != tt.wantHELO {
+				t.Errorf("report origin = %s/%s, want %s/%s", r.RemoteIP, r.HELO, tt.wantIP, tt.wantHELO)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package smtp_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+)
+
+func TestVerify_Replay(t *testing.T) {
+	f := newAuthFixture(t)
+	env := startModeServer(t, "strict", smtpserver.WithResolver(f.resolver))
+
+	first := pendingNonce(t, env, "alice@direct.test")
+	signed := f.dkimSign(t, authMessage("alice@direct.test", first, "hello"))
+	tagged := "Message-ID: <m1@direct.test>\r\n" + authMessage("alice@direct.test", first, "hello")
+	for _, msg := range []string{signed, tagged} {
+		if err := sendMessage(t, env.addr, "alice@direct.test", "verify+"+first+"@"+testDomain, msg); err != nil {
+			t.Fatalf("first delivery failed: %v", err)
+		}
+	}
+	if _, ok := awaitProof(env, first, time.Second); !ok {
+		t.Fatal("expected the original message to verify")
+	}
+
+	tests := []struct {
+		name    string
+		message string
+	}{
+		{name: "identical copy", message: signed},
+		// the signature does not cover Message-ID, so a new one is no disguise
+		{name: "new Message-ID", message: "Message-ID: <m2@direct.test>\r\n" + signed},
+		{name: "reused Message-ID", message: tagged},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := pendingNonce(t, env, "alice@direct.test")
+			err := sendMessage(t, env.addr, "alice@direct.test", "verify+"+n+"@"+testDomain, tt.message)
+			if smtpCode(err) != 550 {
+				t.Fatalf("replay = %v, want 550", err)
+			}
+			r := awaitReport(env, n)
+			if r == nil || r.Decision != models.DecisionRejected {
+				t.Fatalf("expected a rejected report, got %+v", r)
+			}
+			if _, ok := env.ttlStore.Get(n); ok {
+				t.Error("replayed message verified the nonce")
+			}
+		})
+	}
+}
+
+func TestVerify_MessagePredatesRegistration(t *testing.T) {
+	dkimHeader := func(at time.Time) string {
+		return "DKIM-Signature: v=1; a=rsa-sha256; d=example.org; s=sel; t=" +
+			strconv.FormatInt(at.Unix(), 10) + "; h=from; bh=; b=c2ln\r\n"
+	}
+
+	tests := []struct {
+		name         string
+		header       func(opened time.Time) string
+		wantDecision string
+	}{
+		{name: "current Date", wantDecision: models.DecisionAccepted,
+			header: func(opened time.Time) string { return "Date: " + opened.Format(time.RFC1123Z) + "\r\n" }},
+		{name: "Date within clock skew", wantDecision: models.DecisionAccepted,
+			header: func(opened time.Time) string {
+				return "Date: " + opened.Add(-time.Minute).Format(time.RFC1123Z) + "\r\n"
+			}},
+		{name: "old Date", wantDecision: models.DecisionFailed,
+			header: func(opened time.Time) string { return "Date: " + opened.Add(-time.Hour).Format(time.RFC1123Z) + "\r\n" }},
+		{name: "old DKIM t=", wantDecision: models.DecisionFailed,
+			header: func(opened time.Time) string {
+				return dkimHeader(opened.Add(-time.Hour)) + "Date: " + opened.Format(time.RFC1123Z) + "\r\n"
+			}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := startVerifyServer(t)
+			n := pendingNonce(t, env, "alice@example.org")
+			opened := time.Now()
+			if err := controller.SaveIssued(env.ttlStore, n, opened, time.Minute); err != nil {
+				t.Fatalf("SaveIssued failed: %v", err)
+			}
+
+			msg := tt.header(opened) + verificationMessage("alice@example.org", n)
+			if err := sendMessage(t, env.addr, "alice@example.org", "verify+"+n+"@"+testDomain, msg); err != nil {
+				t.Fatalf("send failed: %v", err)
+			}
+			r := awaitReport(env, n)
+			if r == nil {
+				t.Fatal("expected a report")
+			}
+			if r.Decision != tt.wantDecision {
+				t.Errorf("decision = %q, want %q (reason %q)", r.Decision, tt.wantDecision, r.Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package smtp_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+	"github.com/Goofygiraffe06/zinc/store"
+)
+
+func TestVerify_ReviewMode(t *testing.T) {
+	f := newAuthFixture(t)
+	// soft.test publishes no DMARC record, so its softfail is never enforced
+	f.dns.AddTXT(t, "soft.test", 300, "v=spf1 ip4:192.0.2.1 ~all")
+
+	tests := []struct {
+		name       string
+		envelope   string
+		build      func(n string) string
+		wantCode   int
+		wantReason string // empty means the proof is stored as usual
+	}{
+		{
+			name:     "aligned SPF and DKIM",
+			envelope: "alice@direct.test",
+			build:    func(n string) string { return f.dkimSign(t, authMessage("alice@direct.test", n, "hello")) },
+		},
+		{
+			name:       "SPF softfail",
+			envelope:   "alice@soft.test",
+			build:      func(n string) string { return authMessage("alice@soft.test", n, "hello") },
+			wantReason: "SPF softfail",
+		},
+		{
+			name:     "DKIM body modified",
+			envelope: "alice@direct.test",
+			build: func(n string) string {
+				return f.dkimSign(t, authMessage("alice@direct.test", n, "hello")) + "tampered\r\n"
+			},
+			wantReason: "DKIM fail",
+		},
+		// hard failures are still refused outright
+		{
+			name:     "SPF fail",
+			envelope: "alice@forwarded.test",
+			build:    func(n string) string { return authMessage("alice@forwarded.test", n, "hello") },
+			wantCode: 550,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SMTP_SYNC_VERDICTS", "true")
+			env := startModeServer(t, "review", smtpserver.WithResolver(f.resolver))
+			n := pendingNonce(t, env, tt.envelope)
+
+			err := sendMessage(t, env.addr, tt.envelope, "verify+"+n+"@"+testDomain, tt.build(n))
+			if smtpCode(err) != tt.wantCode {
+				t.Fatalf("reply = %v, want %d", err, tt.wantCode)
+			}
+			if tt.wantCode != 0 {
+				return
+			}
+
+			report := awaitReport(env, n)
+			if report == nil {
+				t.Fatal("expected a verification report")
+			}
+			if tt.wantReason == "" {
+				if _, ok := awaitProof(env, n, time.Second); !ok {
+					t.Fatal("expected proof to be stored")
+				}
+				return
+			}
+			if report.Decision != models.DecisionReview || !strings.Contains(report.Reason, tt.wantReason) {
+				t.Errorf("report = %s %q, want review for %q", report.Decision, report.Reason, tt.wantReason)
+			}
+			if _, ok := env.ttlStore.Get(n); ok {
+				t.Error("proof stored for a message held for review")
+			}
+		})
+	}
+}
+
+func TestVerify_EmailRegistrationReview(t *testing.T) {
+	f := newAuthFixture(t)
+	f.dns.AddTXT(t, "soft.test", 300, "v=spf1 ip4:192.0.2.1 ~all")
+	t.Setenv("SMTP_SYNC_VERDICTS", "true")
+
+	users, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore failed: %v", err)
+	}
+	env := startModeServer(t, "review", smtpserver.WithResolver(f.resolver), smtpserver.WithRegistrar(users))
+	n, err := nonce.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	pub, sig := signNonce(t, n)
+
+	msg := registrationMessage("alice@soft.test", n, registrationBody("alice", pub, sig))
+	if err := sendMessage(t, env.addr, "alice@soft.test", "verify+"+n+"@"+testDomain, msg); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	r, held, err := users.GetReview(n)
+	if err != nil || !held {
+		t.Fatalf("GetReview = %t, %v, want a held registration", held, err)
+	}
+	if r.Status != models.ReviewPending || r.Email != "alice@soft.test" || r.Username != "alice" || r.PublicKey != pub {
+		t.Errorf("review = %+v", r)
+	}
+	if users.Exists("alice@soft.test") {
+		t.Error("account created before review")
+	}
+}
@@ -0,0 +1,74 @@
+package smtp_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+)
+
+func TestVerify_SyncVerdicts(t *testing.T) {
+	tests := []struct {
+		name       string
+		sync       string
+		expected   string // pending registration email; empty means none
+		envelope   string
+		rcpt       string // empty means the nonce's verification address
+		headerFrom string
+		wantCode   int
+		wantReason string
+	}{
+		{name: "verified", sync: "true", expected: "alice@example.org",
+			envelope: "alice@example.org", headerFrom: "alice@example.org"},
+		{name: "sender mismatch", sync: "true", expected: "bob@example.org",
+			envelope: "alice@example.org", headerFrom: "alice@example.org",
+			wantCode: 550, wantReason: "Sender does not match pending registration"},
+		{name: "header From mismatch", sync: "true", expected: "alice@example.org",
+			envelope: "alice@example.org", headerFrom: "mallory@example.org",
+			wantCode: 550, wantReason: "From header does not match pending registration"},
+		{name: "second From field", sync: "true", expected: "alice@example.org",
+			envelope: "alice@example.org", headerFrom: "alice@example.org\r\nFrom: mallory@example.org",
+			wantCode: 550, wantReason: "From header does not match pending registration"},
+		{name: "no pending registration", sync: "true",
+			envelope: "alice@example.org", headerFrom: "alice@example.org",
+			wantCode: 550, wantReason: "Verification expired"},
+		// accepted silently like any other address that is not a verification one
+		{name: "no verification recipient", sync: "true", expected: "alice@example.org",
+			envelope: "alice@example.org", rcpt: "postmaster@" + testDomain, headerFrom: "alice@example.org"},
+		{name: "asynchronous mode hides the verdict", sync: "false", expected: "bob@example.org",
+			envelope: "alice@example.org", headerFrom: "alice@example.org"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SMTP_SYNC_VERDICTS", tt.sync)
+			env := startVerifyServer(t)
+			n, err := nonce.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			if tt.expected != "" {
+				env.ttlStore.SetWithValue("expected:"+n, tt.expected, time.Minute)
+			}
+
+			rcpt := tt.rcpt
+			if rcpt == "" {
+				rcpt = "verify+" + n + "@" + testDomain
+			}
+			err = sendMessage(t, env.addr, tt.envelope, rcpt, verificationMessage(tt.headerFrom, n))
+			if smtpCode(err) != tt.wantCode {
+				t.Fatalf("reply = %v, want %d", err, tt.wantCode)
+			}
+			if tt.wantReason != "" && !strings.Contains(err.Error(), tt.wantReason) {
+				t.Errorf("reply = %q, want it to say %q", err, tt.wantReason)
+			}
+			// the proof is in place by the time a synchronous reply arrives
+			if tt.sync == "true" && tt.wantCode == 0 && tt.rcpt == "" {
+				if _, ok := env.ttlStore.Get(n); !ok {
+					t.Error("expected a stored proof before the reply")
+				}
+			}
+		})
+	}
+}
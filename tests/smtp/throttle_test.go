@@ -0,0 +1,183 @@
+package smtp_test
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	smtpcore "github.com/emersion/go-smtp"
+)
+
+func smtpCode(err error) int {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return tpErr.Code
+	}
+	var smtpErr *smtpcore.SMTPError
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code
+	}
+	return 0
+}
+
+func dialHello(t *testing.T, addr string) (*smtp.Client, error) {
+	t.Helper()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, c.Hello("client.test")
+}
+
+func TestThrottle_ConcurrencyCap(t *testing.T) {
+	t.Setenv("SMTP_MAX_CONNS_PER_IP", "1")
+	env := startVerifyServer(t)
+
+	first, err := dialHello(t, env.addr)
+	if err != nil {
+		t.Fatalf("first session refused: %v", err)
+	}
+	if _, err := dialHello(t, env.addr); smtpCode(err) != 421 {
+		t.Fatalf("second concurrent session: got %v, want 421", err)
+	}
+
+	if err := first.Quit(); err != nil {
+		t.Fatalf("Quit failed: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, err := dialHello(t, env.addr)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("slot not released after QUIT: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestThrottle_ConnectionRate(t *testing.T) {
+	t.Setenv("SMTP_CONN_RATE_LIMIT", "2")
+	env := startVerifyServer(t)
+
+	for i := 0; i < 2; i++ {
+		c, err := dialHello(t, env.addr)
+		if err != nil {
+			t.Fatalf("session %d refused: %v", i+1, err)
+		}
+		c.Quit()
+	}
+	if _, err := dialHello(t, env.addr); smtpCode(err) != 421 {
+		t.Fatalf("session over rate: got %v, want 421", err)
+	}
+}
+
+func TestThrottle_Greylist(t *testing.T) {
+	t.Setenv("SMTP_GREYLIST_ENABLED", "true")
+	t.Setenv("SMTP_GREYLIST_DELAY", "300ms")
+	env := startVerifyServer(t)
+
+	rcpt := "verify+abc@" + testDomain
+	attempt := func() error {
+		c, err := dialHello(t, env.addr)
+		if err != nil {
+			t.Fatalf("Hello failed: %v", err)
+		}
+		defer c.Quit()
+		if err := c.Mail("alice@example.com"); err != nil {
+			t.Fatalf("Mail failed: %v", err)
+		}
+		return c.Rcpt(rcpt)
+	}
+
+	if err := attempt(); smtpCode(err) != 451 {
+		t.Fatalf("first attempt: got %v, want 451", err)
+	}
+	if err := attempt(); smtpCode(err) != 451 {
+		t.Fatalf("early retry: got %v, want 451", err)
+	}
+	time.Sleep(350 * time.Millisecond)
+	if err := attempt(); err != nil {
+		t.Fatalf("retry after delay rejected: %v", err)
+	}
+	if err := attempt(); err != nil {
+		t.Fatalf("passed triplet rejected: %v", err)
+	}
+	// a later registration from the same client and sender is not deferred again
+	rcpt = "verify+def@" + testDomain
+	if err := attempt(); err != nil {
+		t.Fatalf("new registration from a passed sender rejected: %v", err)
+	}
+}
+
+func TestThrottle_Tarpit(t *testing.T) {
+	t.Setenv("SMTP_TARPIT_DELAY", "100ms")
+	t.Setenv("SMTP_TARPIT_MAX_DELAY", "150ms")
+	env := startVerifyServer(t)
+
+	c, err := dialHello(t, env.addr)
+	if err != nil {
+		t.Fatalf("Hello failed: %v", err)
+	}
+	if err := c.Mail("alice@example.com"); err != nil {
+		t.Fatalf("Mail failed: %v", err)
+	}
+	want := []time.Duration{100 * time.Millisecond, 150 * time.Millisecond, 150 * time.Millisecond}
+	for i, min := range want {
+		start := time.Now()
+		if err := c.Rcpt("nobody@" + testDomain); err != nil {
+			t.Fatalf("Rcpt %d failed: %v", i+1, err)
+		}
+		if elapsed := time.Since(start); elapsed < min {
+			t.Errorf("invalid rcpt %d answered after %s, want at least %s", i+1, elapsed, min)
+		}
+	}
+}
+
+func TestThrottle_GreetDelay(t *testing.T) {
+	t.Setenv("SMTP_GREET_DELAY", "300ms")
+	env := startVerifyServer(t)
+
+	tests := []struct {
+		name      string
+		talkEarly bool
+		wantCode  string
+	}{
+		{name: "patient client is greeted", wantCode: "220"},
+		{name: "early talker is rejected", talkEarly: true, wantCode: "554"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", env.addr)
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			defer conn.Close()
+			if tt.talkEarly {
+				if _, err := conn.Write([]byte("EHLO client.test\r\n")); err != nil {
+					t.Fatalf("Write failed: %v", err)
+				}
+			}
+			start := time.Now()
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			if err != nil {
+				t.Fatalf("ReadString failed: %v", err)
+			}
+			if !strings.HasPrefix(line, tt.wantCode) {
+				t.Fatalf("got %q, want %s reply", line, tt.wantCode)
+			}
+			if !tt.talkEarly && time.Since(start) < 250*time.Millisecond {
+				t.Errorf("greeting sent after %s, want delay", time.Since(start))
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package smtp_test
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/internal/manager"
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+	"github.com/Goofygiraffe06/zinc/store/ephemeral"
+)
+
+// writeCert writes a self-signed certificate with the given serial to dir.
+func writeCert(t *testing.T, dir string, serial int64) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "zinc.test"},
+		DNSNames:     []string{"zinc.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey failed: %v", err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	// Write the key first so the watcher never pairs a new cert with an old key
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("write key failed: %v", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("write cert failed: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func startTLSServer(t *testing.T, certFile, keyFile string) *smtpserver.Server {
+	t.Helper()
+	t.Setenv("SMTP_LISTEN_ADDR", "127.0.0.1:0")
+	t.Setenv("SMTP_TLS_LISTEN_ADDR", "127.0.0.1:0")
+	t.Setenv("SMTP_TLS_CERT_FILE", certFile)
+	t.Setenv("SMTP_TLS_KEY_FILE", keyFile)
+	t.Setenv("SMTP_TLS_RELOAD_INTERVAL", "20ms")
+
+	mgr := manager.NewWorkManager()
+	t.Cleanup(mgr.Close)
+	backend := smtpserver.NewBackend(ephemeral.NewTTLStore(), controller.NewVerificationRegistry(), mgr, "zinc.test")
+	srv := smtpserver.NewServer(backend)
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(srv.Stop)
+	return srv
+}
+
+func startTLSSerial(t *testing.T, addr string) int64 {
+	t.Helper()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); !ok {
+		t.Fatal("expected STARTTLS to be advertised")
+	}
+	if err := c.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
+		t.Fatalf("StartTLS failed: %v", err)
+	}
+	state, ok := c.TLSConnectionState()
+	if !ok {
+		t.Fatal("expected TLS connection state")
+	}
+	return state.PeerCertificates[0].SerialNumber.Int64()
+}
+
+func TestSMTPServer_STARTTLSAndReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, 1)
+	srv := startTLSServer(t, certFile, keyFile)
+	addr := srv.ListenAddr().String()
+
+	if got := startTLSSerial(t, addr); got != 1 {
+		t.Fatalf("expected serial 1, got %d", got)
+	}
+
+	// Ensure the rewrite lands on a different mtime
+	time.Sleep(20 * time.Millisecond)
+	writeCert(t, dir, 2)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if startTLSSerial(t, addr) == 2 {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("certificate was not hot-reloaded")
+}
+
+func TestSMTPServer_ImplicitTLS(t *testing.T) {
+	certFile, keyFile := writeCert(t, t.TempDir(), 7)
+	srv := startTLSServer(t, certFile, keyFile)
+
+	if srv.TLSListenAddr() == nil {
+		t.Fatal("expected implicit TLS listener")
+	}
+	conn, err := tls.Dial("tcp", srv.TLSListenAddr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("tls.Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	greeting, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading greeting failed: %v", err)
+	}
+	if !strings.HasPrefix(greeting, "220 ") {
+		t.Fatalf("unexpected greeting %q", greeting)
+	}
+}
+
+func TestSMTPServer_StrictRequiresTLS(t *testing.T) {
+	certFile, keyFile := writeCert(t, t.TempDir(), 3)
+	t.Setenv("SMTP_VERIFICATION_MODE", "strict")
+	t.Setenv("SMTP_REQUIRE_TLS", "true")
+	srv := startTLSServer(t, certFile, keyFile)
+
+	c, err := smtp.Dial(srv.ListenAddr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+	if err := c.Hello("client.test"); err != nil {
+		t.Fatalf("Hello failed: %v", err)
+	}
+	err = c.Mail("user@example.com")
+	if err == nil || !strings.HasPrefix(err.Error(), "530") {
+		t.Fatalf("expected 530 for plaintext MAIL, got %v", err)
+	}
+
+	if err := c.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
+		t.Fatalf("StartTLS failed: %v", err)
+	}
+	if err := c.Mail("user@example.com"); err != nil {
+		t.Fatalf("expected MAIL over TLS to be accepted, got %v", err)
+	}
+}
+
+func TestSMTPServer_STARTTLSChargedOnce(t *testing.T) {
+	certFile, keyFile := writeCert(t, t.TempDir(), 4)
+	t.Setenv("SMTP_CONN_RATE_LIMIT", "2")
+	srv := startTLSServer(t, certFile, keyFile)
+	addr := srv.ListenAddr().String()
+
+	// the EHLO after STARTTLS opens a second session on the same connection
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+	if err := c.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
+		t.Fatalf("StartTLS failed: %v", err)
+	}
+	if err := c.Mail("user@example.com"); err != nil {
+		t.Fatalf("MAIL over TLS failed: %v", err)
+	}
+
+	if _, err := dialHello(t, addr); err != nil {
+		t.Fatalf("second connection refused: %v", err)
+	}
+	if _, err := dialHello(t, addr); smtpCode(err) != 421 {
+		t.Fatalf("third connection: got %v, want 421", err)
+	}
+}
@@ -0,0 +1,133 @@
+package smtp_test
+
+import (
+	"fmt"
+	"net/smtp"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/controller"
+	"github.com/Goofygiraffe06/zinc/internal/manager"
+	"github.com/Goofygiraffe06/zinc/internal/nonce"
+	smtpserver "github.com/Goofygiraffe06/zinc/internal/smtp"
+	"github.com/Goofygiraffe06/zinc/store/ephemeral"
+)
+
+const testDomain = "zinc.test"
+
+type verifyEnv struct {
+	addr     string
+	ttlStore *ephemeral.TTLStore
+	registry *controller.VerificationRegistry
+}
+
+// startVerifyServer runs an unrestricted-mode listener so no DNS is needed.
+func startVerifyServer(t *testing.T) *verifyEnv {
+	t.Helper()
+	return startModeServer(t, "unrestricted")
+}
+
+func startModeServer(t *testing.T, mode string, opts ...smtpserver.BackendOption) *verifyEnv {
+	t.Helper()
+	t.Setenv("SMTP_LISTEN_ADDR", "127.0.0.1:0")
+	t.Setenv("SMTP_VERIFICATION_MODE", mode)
+
+	ttlStore := ephemeral.NewTTLStore()
+	registry := controller.NewVerificationRegistry()
+	mgr := manager.NewWorkManager()
+	t.Cleanup(mgr.Close)
+
+	srv := smtpserver.NewServer(smtpserver.NewBackend(ttlStore, registry, mgr, testDomain, opts...))
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(srv.Stop)
+	return &verifyEnv{addr: srv.ListenAddr().String(), ttlStore: ttlStore, registry: registry}
+}
+
+func sendMessage(t *testing.T, addr, envelopeFrom, rcpt, msg string) error {
+	t.Helper()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+	if err := c.Mail(envelopeFrom); err != nil {
+		return err
+	}
+	if err := c.Rcpt(rcpt); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprint(w, msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func verificationMessage(headerFrom, nonce string) string {
+	return "From: " + headerFrom + "\r\n" +
+		"To: verify+" + nonce + "@" + testDomain + "\r\n" +
+		"Subject: verify\r\n" +
+		"\r\n" +
+		"hello\r\n"
+}
+
+// awaitProof waits for the asynchronous nonce processing to store its proof.
+func awaitProof(env *verifyEnv, nonce string, wait time.Duration) (string, bool) {
+	deadline := time.Now().Add(wait)
+	for time.Now().Before(deadline) {
+		if v, ok := env.ttlStore.Get(nonce); ok {
+			return v, true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return "", false
+}
+
+func TestVerify_HeaderFromMustMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		headerFrom string
+		wantProof  bool
+	}{
+		{name: "matching header From", headerFrom: "Alice <alice@example.com>", wantProof: true},
+		{name: "header From differs from envelope", headerFrom: "victim@example.org", wantProof: false},
+		{name: "multiple authors", headerFrom: "alice@example.com, bob@example.com", wantProof: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := startVerifyServer(t)
+			nonce, err := nonce.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			env.ttlStore.SetWithValue("expected:"+nonce, "alice@example.com", time.Minute)
+
+			err = sendMessage(t, env.addr, "alice@example.com", "verify+"+nonce+"@"+testDomain,
+				verificationMessage(tt.headerFrom, nonce))
+			if err != nil {
+				t.Fatalf("send failed: %v", err)
+			}
+
+			wait := time.Second
+			if !tt.wantProof {
+				wait = 200 * time.Millisecond
+			}
+			v, ok := awaitProof(env, nonce, wait)
+			if ok != tt.wantProof {
+				t.Fatalf("proof stored=%v, want %v", ok, tt.wantProof)
+			}
+			if ok && v != "alice@example.com" {
+				t.Errorf("unexpected proof value %q", v)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package store_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/store"
+)
+
+func TestNewSQLiteStore_NormalizesStoredEmails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	old, err := store.NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore failed: %v", err)
+	}
+	// Accounts as earlier releases stored them: lower-cased but in U-labels
+	for _, email := range []string{"josé@bücher.de", "anna@münchen.de", "anna@xn--mnchen-3ya.de", "bob@example.com"} {
+		if err := old.AddUser(models.User{Email: email, Username: "u", PublicKey: "pk"}); err != nil {
+			t.Fatalf("AddUser(%s) failed: %v", email, err)
+		}
+	}
+	old.Close()
+
+	s, err := store.NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		email string
+		want  bool
+	}{
+		{email: "josé@xn--bcher-kva.de", want: true},
+		{email: "josé@bücher.de", want: false},
+		{email: "bob@example.com", want: true},
+		// the normalized form was taken, so the old row stays as it was
+		{email: "anna@münchen.de", want: true},
+		{email: "anna@xn--mnchen-3ya.de", want: true},
+	}
+	for _, tt := range tests {
+		if got := s.Exists(tt.email); got != tt.want {
+			t.Errorf("Exists(%s) = %t, want %t", tt.email, got, tt.want)
+		}
+	}
+}
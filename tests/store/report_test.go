@@ -0,0 +1,82 @@
+package store_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/store"
+)
+
+func TestVerificationReportRoundTrip(t *testing.T) {
+	storeInstance, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	report := &models.VerificationReport{
+		ReceivedAt:            time.Now().UTC().Truncate(time.Second),
+		RemoteIP:              "192.0.2.1",
+		EnvelopeFrom:          "alice@example.com",
+		SPF:                   models.AuthCheck{Result: "pass", Domains: []string{"example.com"}},
+		Decision:              models.DecisionAccepted,
+		AuthenticationResults: "zinc.test; spf=pass smtp.mailfrom=alice@example.com",
+	}
+	if err := storeInstance.AddUser(models.User{Email: "alice@example.com", Username: "alice", PublicKey: "key",
+		VerificationReport: report, Assurance: models.AssuranceMedium}); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+	if err := storeInstance.AddUser(models.User{Email: "bob@example.com", Username: "bob", PublicKey: "key"}); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+
+	got, ok := storeInstance.GetUser("alice@example.com")
+	if !ok || got.VerificationReport == nil {
+		t.Fatal("expected stored verification report")
+	}
+	if got.VerificationReport.AuthenticationResults != report.AuthenticationResults ||
+		!got.VerificationReport.ReceivedAt.Equal(report.ReceivedAt) ||
+		got.VerificationReport.SPF.Domains[0] != "example.com" {
+		t.Errorf("report mismatch: %+v", got.VerificationReport)
+	}
+	if got.Assurance != models.AssuranceMedium {
+		t.Errorf("assurance = %q, want %q", got.Assurance, models.AssuranceMedium)
+	}
+
+	got, ok = storeInstance.GetUser("bob@example.com")
+	if !ok || got.VerificationReport != nil {
+		t.Errorf("expected no report for bob, got %+v", got.VerificationReport)
+	}
+}
+
+func TestNewSQLiteStore_AddsReportColumn(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "old.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	_, err = db.Exec(`CREATE TABLE users (
+		email TEXT PRIMARY KEY NOT NULL,
+		username TEXT NOT NULL,
+		public_key TEXT NOT NULL
+	);
+	INSERT INTO users VALUES ('old@example.com', 'old', 'key');`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("seeding old schema failed: %v", err)
+	}
+
+	storeInstance, err := store.NewSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore on old schema failed: %v", err)
+	}
+	defer storeInstance.Close()
+
+	if u, ok := storeInstance.GetUser("old@example.com"); !ok || u.VerificationReport != nil || u.Assurance != "" {
+		t.Fatalf("expected existing user without report, got %+v ok=%v", u, ok)
+	}
+	report := &models.VerificationReport{Decision: models.DecisionAccepted}
+	if err := storeInstance.AddUser(models.User{Email: "new@example.com", Username: "new", PublicKey: "key", VerificationReport: report}); err != nil {
+		t.Fatalf("AddUser after migration failed: %v", err)
+	}
+}
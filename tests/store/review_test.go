@@ -0,0 +1,89 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/store"
+)
+
+func TestReviews_HoldAndDecide(t *testing.T) {
+	storeInstance, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now().Truncate(time.Millisecond)
+	held := models.Review{
+		Nonce:     "n1",
+		Email:     "alice@example.com",
+		Username:  "alice",
+		PublicKey: "pk",
+		Report:    &models.VerificationReport{Decision: models.DecisionReview, Reason: "SPF softfail"},
+		CreatedAt: now,
+	}
+	// a replayed task holds the same nonce twice
+	for i := 0; i < 2; i++ {
+		if err := storeInstance.AddReview(held); err != nil {
+			t.Fatalf("AddReview failed: %v", err)
+		}
+	}
+	if err := storeInstance.AddReview(models.Review{Nonce: "n2", Email: "bob@example.com", Username: "bob", PublicKey: "pk", CreatedAt: now}); err != nil {
+		t.Fatalf("AddReview failed: %v", err)
+	}
+
+	pending, err := storeInstance.ListReviews(models.ReviewPending)
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("ListReviews = %d reviews (%v), want 2", len(pending), err)
+	}
+	if r := pending[0]; r.Nonce != "n1" || r.Report == nil || r.Report.Reason != "SPF softfail" || !r.CreatedAt.Equal(now) {
+		t.Errorf("review = %+v", r)
+	}
+
+	user := models.User{Email: "alice@example.com", Username: "alice", PublicKey: "pk"}
+	if err := storeInstance.DecideReview("n1", models.ReviewApproved, "carol", "ok", now, &user); err != nil {
+		t.Fatalf("DecideReview failed: %v", err)
+	}
+	if !storeInstance.Exists("alice@example.com") {
+		t.Error("approval did not create the account")
+	}
+	if err := storeInstance.DecideReview("n2", models.ReviewDenied, "carol", "", now, nil); err != nil {
+		t.Fatalf("DecideReview failed: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		nonce string
+		want  error
+	}{
+		{name: "already decided", nonce: "n1", want: store.ErrReviewDecided},
+		{name: "unknown nonce", nonce: "n3", want: store.ErrReviewNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := storeInstance.DecideReview(tt.nonce, models.ReviewDenied, "carol", "", now, nil)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("DecideReview = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	r, ok, err := storeInstance.GetReview("n1")
+	if err != nil || !ok || r.Status != models.ReviewApproved || r.DecidedBy != "carol" || r.DecidedAt == nil {
+		t.Errorf("GetReview = %+v, %t, %v", r, ok, err)
+	}
+
+	audit, err := storeInstance.AuditLog(10)
+	if err != nil {
+		t.Fatalf("AuditLog failed: %v", err)
+	}
+	wantActions := []string{store.AuditReviewDenied, store.AuditReviewApproved, store.AuditReviewQueued, store.AuditReviewQueued}
+	if len(audit) != len(wantActions) {
+		t.Fatalf("audit = %+v, want %d entries", audit, len(wantActions))
+	}
+	for i, want := range wantActions {
+		if audit[i].Action != want {
+			t.Errorf("audit[%d] = %s, want %s", i, audit[i].Action, want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/store"
+)
+
+func TestWorkQueue_ClaimLeaseRetryComplete(t *testing.T) {
+	storeInstance, cleanup := setupTestDB(t)
+	defer cleanup()
+	q := store.NewSQLiteWorkQueue(storeInstance)
+
+	now := time.Now()
+	sent := now.Add(-time.Minute).Truncate(time.Millisecond)
+	id, err := q.Enqueue(models.VerifyTask{
+		Nonce:         "n1",
+		Report:        models.VerificationReport{EnvelopeFrom: "alice@example.com", Decision: models.DecisionAccepted},
+		SentAt:        sent,
+		Registration:  &models.EmailRegistration{Username: "alice", PublicKey: "pk", Signature: "sig"},
+		NextAttemptAt: now,
+	})
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	if _, err := q.Enqueue(models.VerifyTask{Nonce: "later", NextAttemptAt: now.Add(time.Hour)}); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	tasks, err := q.Claim(now, time.Minute, 10)
+	if err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].ID != id || tasks[0].Nonce != "n1" {
+		t.Fatalf("claimed %+v, want only n1", tasks)
+	}
+	if !tasks[0].SentAt.Equal(sent) || tasks[0].Report.EnvelopeFrom != "alice@example.com" ||
+		tasks[0].Registration == nil || tasks[0].Registration.PublicKey != "pk" {
+		t.Errorf("task did not round-trip: %+v", tasks[0])
+	}
+
+	// the lease hides it until it runs out
+	if tasks, _ := q.Claim(now.Add(30*time.Second), time.Minute, 10); len(tasks) != 0 {
+		t.Fatalf("leased task claimed again: %+v", tasks)
+	}
+
+	if err := q.Retry(id, 1, now.Add(time.Second), "busy"); err != nil {
+		t.Fatalf("Retry failed: %v", err)
+	}
+	tasks, err = q.Claim(now.Add(2*time.Second), time.Minute, 10)
+	if err != nil || len(tasks) != 1 || tasks[0].Attempts != 1 || tasks[0].LastError != "busy" {
+		t.Fatalf("retried task = %+v (%v)", tasks, err)
+	}
+
+	if err := q.Complete(id); err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	if tasks, _ := q.Claim(now.Add(time.Hour), time.Minute, 10); len(tasks) != 1 || tasks[0].Nonce != "later" {
+		t.Fatalf("after Complete claimed %+v, want only later", tasks)
+	}
+}
@@ -0,0 +1,233 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Goofygiraffe06/zinc/internal/auth"
+	"github.com/Goofygiraffe06/zinc/internal/manager"
+	"github.com/Goofygiraffe06/zinc/internal/models"
+	"github.com/Goofygiraffe06/zinc/internal/webhook"
+	"github.com/Goofygiraffe06/zinc/store"
+)
+
+func setupStore(t *testing.T) *store.SQLiteStore {
+	t.Helper()
+	s, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func registerUser(t *testing.T, s *store.SQLiteStore, email string) models.OutboxEvent {
+	t.Helper()
+	user := models.User{Email: email, Username: "hooked", PublicKey: "pk"}
+	ev, err := webhook.UserEvent(webhook.EventUserRegistered, user)
+	if err != nil {
+		t.Fatalf("UserEvent failed: %v", err)
+	}
+	if err := s.AddUserWithEvents(user, ev); err != nil {
+		t.Fatalf("AddUserWithEvents failed: %v", err)
+	}
+	return ev
+}
+
+func TestDispatcher_RetriesAndSigns(t *testing.T) {
+	auth.InitSigningKey()
+	s := setupStore(t)
+	mgr := manager.NewWorkManager()
+	defer mgr.Close()
+
+	var calls int32
+	received := make(chan webhook.Envelope, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := webhook.Verify(auth.GetSigningKey().PublicKey, r.Header.Get(webhook.SignatureHeader), body, time.Minute); err != nil {
+			t.Errorf("signature did not verify: %v", err)
+		}
+		// Fail the first attempt to exercise the retry path
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var env webhook.Envelope
+		if err := json.Unmarshal(body, &env); err != nil {
+			t.Errorf("payload not valid JSON: %v", err)
+		}
+		received <- env
+	}))
+	defer srv.Close()
+
+	ev := registerUser(t, s, "hook@example.com")
+
+	d := webhook.NewDispatcher(s, mgr,
+		webhook.WithEndpoints([]string{srv.URL}),
+		webhook.WithRetryBackoff(10*time.Millisecond, 50*time.Millisecond),
+		webhook.WithPollInterval(10*time.Millisecond),
+		webhook.WithMaxAttempts(5),
+	)
+	d.Start()
+	defer d.Stop()
+
+	select {
+	case env := <-received:
+		if env.ID != ev.ID || env.Type != webhook.EventUserRegistered {
+			t.Errorf("unexpected envelope: %+v", env)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timeout waiting for webhook delivery")
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("expected 2 attempts, got %d", got)
+	}
+}
+
+func TestDispatcher_DeadLetter(t *testing.T) {
+	auth.InitSigningKey()
+	s := setupStore(t)
+	mgr := manager.NewWorkManager()
+	defer mgr.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	ev := registerUser(t, s, "dead@example.com")
+
+	d := webhook.NewDispatcher(s, mgr,
+		webhook.WithEndpoints([]string{srv.URL}),
+		webhook.WithRetryBackoff(5*time.Millisecond, 5*time.Millisecond),
+		webhook.WithPollInterval(10*time.Millisecond),
+		webhook.WithMaxAttempts(3),
+	)
+	d.Start()
+	defer d.Stop()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		dead, err := s.DeadLetters(10)
+		if err != nil {
+			t.Fatalf("DeadLetters failed: %v", err)
+		}
+		if len(dead) == 1 {
+			if dead[0].EventID != ev.ID || dead[0].Attempts != 3 {
+				t.Errorf("unexpected dead letter: %+v", dead[0])
+			}
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("Timeout waiting for dead letter")
+}
+
+func TestDispatcher_SurvivesRestart(t *testing.T) {
+	auth.InitSigningKey()
+	s := setupStore(t)
+
+	// Event committed while no dispatcher is running
+	ev := registerUser(t, s, "restart@example.com")
+
+	received := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get("X-Zinc-Delivery")
+	}))
+	defer srv.Close()
+
+	mgr := manager.NewWorkManager()
+	defer mgr.Close()
+	d := webhook.NewDispatcher(s, mgr,
+		webhook.WithEndpoints([]string{srv.URL}),
+		webhook.WithPollInterval(10*time.Millisecond),
+	)
+	d.Start()
+	defer d.Stop()
+
+	select {
+	case id := <-received:
+		if id != ev.ID {
+			t.Errorf("expected delivery of %s, got %s", ev.ID, id)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timeout waiting for backlog delivery")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{10, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := webhook.Backoff(time.Second, time.Minute, tt.attempt); got != tt.want {
+			t.Errorf("Backoff(attempt=%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestUserEvent_DisplayEmail(t *testing.T) {
+	tests := []struct {
+		name        string
+		email       string
+		wantDisplay string
+	}{
+		{name: "ASCII domain", email: "alice@example.com"},
+		{name: "IDN domain", email: "josé@xn--bcher-kva.de", wantDisplay: "josé@bücher.de"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev, err := webhook.UserEvent(webhook.EventUserRegistered, models.User{Email: tt.email, Username: "u"})
+			if err != nil {
+				t.Fatalf("UserEvent failed: %v", err)
+			}
+			var env webhook.Envelope
+			var data webhook.UserData
+			if err := json.Unmarshal([]byte(ev.Payload), &env); err != nil {
+				t.Fatalf("decode envelope: %v", err)
+			}
+			if err := json.Unmarshal(env.Data, &data); err != nil {
+				t.Fatalf("decode data: %v", err)
+			}
+			if data.Email != tt.email || data.DisplayEmail != tt.wantDisplay {
+				t.Errorf("email = %q display = %q, want %q and %q", data.Email, data.DisplayEmail, tt.email, tt.wantDisplay)
+			}
+		})
+	}
+}
+
+func TestUserEvents_WebhooksDisabled(t *testing.T) {
+	tests := []struct {
+		name string
+		urls string
+		want int
+	}{
+		{name: "no endpoints", urls: "", want: 0},
+		{name: "endpoint configured", urls: "https://hooks.example.com/zinc", want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WEBHOOK_URLS", tt.urls)
+			events, err := webhook.UserEvents(webhook.EventUserRegistered, models.User{Email: "alice@example.com", Username: "u"})
+			if err != nil {
+				t.Fatalf("UserEvents failed: %v", err)
+			}
+			if len(events) != tt.want {
+				t.Errorf("got %d events, want %d", len(events), tt.want)
+			}
+		})
+	}
+}